@@ -0,0 +1,102 @@
+// Package clock provides an abstraction of time, so the safe containers
+// which depend on time can be tested with a fake clock.
+package clock
+
+import (
+	"time"
+)
+
+// Clock allows for injecting fake or real clocks into code that
+// needs to do arbitrary things based on time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// Since returns time since the specified timestamp.
+	Since(t time.Time) time.Duration
+	// After waits for the duration to elapse and then sends the current time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+	// NewTimer creates a new Timer that will send the current time on its channel after at least duration d.
+	NewTimer(d time.Duration) Timer
+	// AfterFunc waits for the duration to elapse and then calls f in its own goroutine.
+	AfterFunc(d time.Duration, f func()) Timer
+	// NewTicker returns a new Ticker containing a channel that will send the time with a period specified by d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer allows for injecting fake or real timers into code that
+// needs to do arbitrary things based on time.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	// It is nil for a Timer created by AfterFunc.
+	C() <-chan time.Time
+	// Stop prevents the Timer from firing.
+	// It returns true if the call stops the timer, false if the timer has already expired or been stopped.
+	Stop() bool
+	// Reset changes the timer to expire after duration d.
+	// It returns true if the timer had been active, false if the timer had expired or been stopped.
+	Reset(d time.Duration) bool
+}
+
+// Ticker allows for injecting fake or real tickers into code that
+// needs to do arbitrary things based on time.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+	// Stop turns off a ticker.
+	Stop()
+}
+
+// RealClock really calls time.Now()
+var _ Clock = RealClock{}
+
+// RealClock really calls time.Now()
+type RealClock struct{}
+
+// Now returns the current time.
+func (RealClock) Now() time.Time { return time.Now() }
+
+// Since returns time since the specified timestamp.
+func (RealClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+// After is the same as time.After(d).
+func (RealClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// NewTimer is the same as time.NewTimer(d)
+func (RealClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{timer: time.NewTimer(d)}
+}
+
+// AfterFunc is the same as time.AfterFunc(d, f).
+func (RealClock) AfterFunc(d time.Duration, f func()) Timer {
+	return &realTimer{timer: time.AfterFunc(d, f)}
+}
+
+// NewTicker is the same as time.NewTicker(d)
+func (RealClock) NewTicker(d time.Duration) Ticker {
+	return &realTicker{ticker: time.NewTicker(d)}
+}
+
+// realTimer is backed by an actual time.Timer.
+type realTimer struct {
+	timer *time.Timer
+}
+
+// C returns the underlying timer's channel.
+func (r *realTimer) C() <-chan time.Time { return r.timer.C }
+
+// Stop calls Stop() on the underlying timer.
+func (r *realTimer) Stop() bool { return r.timer.Stop() }
+
+// Reset calls Reset() on the underlying timer.
+func (r *realTimer) Reset(d time.Duration) bool { return r.timer.Reset(d) }
+
+// realTicker is backed by an actual time.Ticker.
+type realTicker struct {
+	ticker *time.Ticker
+}
+
+// C returns the underlying ticker's channel.
+func (r *realTicker) C() <-chan time.Time { return r.ticker.C }
+
+// Stop calls Stop() on the underlying ticker.
+func (r *realTicker) Stop() { r.ticker.Stop() }
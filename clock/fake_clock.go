@@ -0,0 +1,201 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock is a Clock
+var _ Clock = (*FakeClock)(nil)
+
+// FakeClock implements Clock, but returns an arbitrary time which only
+// moves when Step or SetTime is called. It is meant for tests.
+type FakeClock struct {
+	mu      sync.RWMutex
+	time    time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a pending timer, ticker or AfterFunc of a FakeClock.
+type fakeWaiter struct {
+	targetTime   time.Time
+	stepInterval time.Duration
+	destChan     chan time.Time
+	afterFunc    func()
+}
+
+// NewFakeClock returns a new FakeClock which starts at t.
+func NewFakeClock(t time.Time) *FakeClock {
+	return &FakeClock{time: t}
+}
+
+// Now returns f's time.
+func (f *FakeClock) Now() time.Time {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.time
+}
+
+// Since returns time since the time in f.
+func (f *FakeClock) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After is the fake version of time.After(d).
+func (f *FakeClock) After(d time.Duration) <-chan time.Time {
+	return f.NewTimer(d).C()
+}
+
+// NewTimer constructs a fake timer, akin to time.NewTimer(d).
+// Like the real one, it fires at once if d <= 0.
+func (f *FakeClock) NewTimer(d time.Duration) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{
+		targetTime: f.time.Add(d),
+		destChan:   make(chan time.Time, 1), // Don't block!
+	}
+	f.addWaiterLocked(w)
+	return &fakeTimer{clock: f, waiter: w}
+}
+
+// AfterFunc is the fake version of time.AfterFunc(d, f).
+// Like the real one, it calls cb at once if d <= 0.
+func (f *FakeClock) AfterFunc(d time.Duration, cb func()) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{
+		targetTime: f.time.Add(d),
+		afterFunc:  cb,
+	}
+	f.addWaiterLocked(w)
+	return &fakeTimer{clock: f, waiter: w}
+}
+
+// NewTicker constructs a fake ticker, akin to time.NewTicker(d).
+func (f *FakeClock) NewTicker(d time.Duration) Ticker {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{
+		targetTime:   f.time.Add(d),
+		stepInterval: d,
+		destChan:     make(chan time.Time, 1), // hold one tick
+	}
+	f.waiters = append(f.waiters, w)
+	return &fakeTicker{clock: f, waiter: w}
+}
+
+// Step moves the clock by duration d, firing every timer, ticker or AfterFunc
+// that becomes due.
+func (f *FakeClock) Step(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setTimeLocked(f.time.Add(d))
+}
+
+// SetTime sets the time, firing every timer, ticker or AfterFunc that becomes due.
+func (f *FakeClock) SetTime(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.setTimeLocked(t)
+}
+
+// HasWaiters returns true if there are any pending timers, tickers or AfterFuncs.
+func (f *FakeClock) HasWaiters() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.waiters) > 0
+}
+
+// setTimeLocked actually changes the time and fires the waiters,
+// the caller must hold the lock.
+func (f *FakeClock) setTimeLocked(t time.Time) {
+	f.time = t
+	newWaiters := make([]*fakeWaiter, 0, len(f.waiters))
+	for _, w := range f.waiters {
+		if w.targetTime.After(t) {
+			newWaiters = append(newWaiters, w)
+			continue
+		}
+		w.fire(t)
+		if w.stepInterval > 0 {
+			for !w.targetTime.After(t) {
+				w.targetTime = w.targetTime.Add(w.stepInterval)
+			}
+			newWaiters = append(newWaiters, w)
+		}
+	}
+	f.waiters = newWaiters
+}
+
+// addWaiterLocked adds w to the pending waiters, or fires it at once if it
+// is already due. The caller must hold the lock.
+func (f *FakeClock) addWaiterLocked(w *fakeWaiter) {
+	if !w.targetTime.After(f.time) {
+		w.fire(f.time)
+		return
+	}
+	f.waiters = append(f.waiters, w)
+}
+
+// fire sends t to the channel of w, or calls its AfterFunc.
+func (w *fakeWaiter) fire(t time.Time) {
+	if w.afterFunc != nil {
+		go w.afterFunc()
+		return
+	}
+	// Don't block if the receiver is not keeping up, like time.Ticker.
+	select {
+	case w.destChan <- t:
+	default:
+	}
+}
+
+// removeWaiter removes w from the pending waiters.
+// It returns true if w was pending.
+func (f *FakeClock) removeWaiter(w *fakeWaiter) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, v := range f.waiters {
+		if v == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTimer implements Timer based on a FakeClock.
+type fakeTimer struct {
+	clock  *FakeClock
+	waiter *fakeWaiter
+}
+
+// C returns the channel that notifies when this timer has fired.
+func (t *fakeTimer) C() <-chan time.Time { return t.waiter.destChan }
+
+// Stop prevents the timer from firing.
+func (t *fakeTimer) Stop() bool { return t.clock.removeWaiter(t.waiter) }
+
+// Reset changes the timer to expire after duration d.
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	active := t.clock.removeWaiter(t.waiter)
+
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.waiter.targetTime = t.clock.time.Add(d)
+	t.clock.addWaiterLocked(t.waiter)
+	return active
+}
+
+// fakeTicker implements Ticker based on a FakeClock.
+type fakeTicker struct {
+	clock  *FakeClock
+	waiter *fakeWaiter
+}
+
+// C returns the channel that notifies when this ticker has ticked.
+func (t *fakeTicker) C() <-chan time.Time { return t.waiter.destChan }
+
+// Stop turns off the ticker.
+func (t *fakeTicker) Stop() { t.clock.removeWaiter(t.waiter) }
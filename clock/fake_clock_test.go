@@ -0,0 +1,145 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_FakeClock(t *testing.T) {
+	start := time.Now()
+	fc := NewFakeClock(start)
+
+	require.Equal(t, start, fc.Now())
+	fc.Step(time.Second)
+	require.Equal(t, start.Add(time.Second), fc.Now())
+	require.Equal(t, time.Second, fc.Since(start))
+
+	fc.SetTime(start)
+	require.Equal(t, start, fc.Now())
+}
+
+func Test_FakeClock_Timer(t *testing.T) {
+	fc := NewFakeClock(time.Now())
+
+	oneSec := fc.NewTimer(time.Second)
+	twoSec := fc.After(2 * time.Second)
+	require.True(t, fc.HasWaiters())
+
+	fc.Step(999 * time.Millisecond)
+	select {
+	case <-oneSec.C():
+		t.Fatal("timer fired too early")
+	default:
+	}
+
+	fc.Step(time.Millisecond)
+	select {
+	case <-oneSec.C():
+	default:
+		t.Fatal("timer should have fired")
+	}
+	select {
+	case <-twoSec:
+		t.Fatal("timer fired too early")
+	default:
+	}
+
+	fc.Step(time.Second)
+	select {
+	case <-twoSec:
+	default:
+		t.Fatal("timer should have fired")
+	}
+	require.False(t, fc.HasWaiters())
+
+	// Stop and Reset
+	tm := fc.NewTimer(time.Second)
+	require.True(t, tm.Stop())
+	require.False(t, tm.Stop())
+	require.False(t, tm.Reset(time.Second))
+	fc.Step(time.Second)
+	select {
+	case <-tm.C():
+	default:
+		t.Fatal("timer should have fired after reset")
+	}
+}
+
+func Test_FakeClock_AfterFunc(t *testing.T) {
+	fc := NewFakeClock(time.Now())
+
+	fired := make(chan struct{})
+	fc.AfterFunc(time.Second, func() { close(fired) })
+
+	fc.Step(time.Second)
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("AfterFunc should have been called")
+	}
+}
+
+func Test_FakeClock_nonPositive(t *testing.T) {
+	fc := NewFakeClock(time.Now())
+
+	// the non-positive timers fire at once, like the real ones.
+	select {
+	case <-fc.After(0):
+	default:
+		t.Fatal("timer of 0 should have fired at once")
+	}
+	tm := fc.NewTimer(time.Hour)
+	tm.Reset(-time.Second)
+	select {
+	case <-tm.C():
+	default:
+		t.Fatal("timer reset to a negative duration should have fired at once")
+	}
+	fired := make(chan struct{})
+	fc.AfterFunc(0, func() { close(fired) })
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("AfterFunc of 0 should have been called at once")
+	}
+	require.False(t, fc.HasWaiters())
+}
+
+func Test_FakeClock_Ticker(t *testing.T) {
+	fc := NewFakeClock(time.Now())
+
+	tk := fc.NewTicker(time.Second)
+	for i := 0; i < 3; i++ {
+		fc.Step(time.Second)
+		select {
+		case <-tk.C():
+		default:
+			t.Fatalf("ticker should have ticked at %d", i)
+		}
+	}
+	tk.Stop()
+	require.False(t, fc.HasWaiters())
+}
+
+func Test_RealClock(t *testing.T) {
+	rc := RealClock{}
+
+	now := rc.Now()
+	require.GreaterOrEqual(t, rc.Since(now), time.Duration(0))
+
+	<-rc.After(time.Millisecond)
+
+	tm := rc.NewTimer(time.Millisecond)
+	<-tm.C()
+	require.False(t, tm.Stop())
+
+	fired := make(chan struct{})
+	rc.AfterFunc(time.Millisecond, func() { close(fired) })
+	<-fired
+
+	tk := rc.NewTicker(time.Millisecond)
+	<-tk.C()
+	tk.Stop()
+}
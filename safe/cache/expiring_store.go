@@ -0,0 +1,316 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/clock"
+)
+
+// TTLPolicy returns the time to live of an object, from the time it is added
+// or updated. The object never expires if the ttl is zero or negative.
+type TTLPolicy[T any] func(obj T) time.Duration
+
+// FixedTTL returns a TTLPolicy which gives every object the same ttl.
+func FixedTTL[T any](ttl time.Duration) TTLPolicy[T] {
+	return func(T) time.Duration { return ttl }
+}
+
+// ExpiringStore is a Store
+var _ container.Store[int] = (*ExpiringStore[int])(nil)
+
+// ExpiringStore is a thread-safe Store whose objects expire once their time
+// to live, given by a TTLPolicy, has passed since they were last added or
+// updated. An expired object counts as absent, it is removed lazily when
+// Get or List come across it, or by RunJanitor in the background, and an
+// EventDeleted is sent to the watchers once it is removed.
+// Like Store, the Resync operation is a no-op.
+//
+// The objects returned from the ExpiringStore are shared with it, you should
+// treat them as read-only.
+type ExpiringStore[T any] struct {
+	rw    sync.RWMutex
+	items map[string]expiringEntry[T]
+
+	// keyFunc is used to make the key used for item insertion and retrieval, and
+	// should be deterministic.
+	keyFunc container.KeyFunc[T]
+	// ttlPolicy gives the time to live of the objects.
+	ttlPolicy TTLPolicy[T]
+	clock     clock.Clock
+	// lastSyncResourceVersion is the resource version passed to the last Replace().
+	lastSyncResourceVersion string
+	// watchers of the store.
+	watchers broadcaster[T]
+}
+
+// expiringEntry is an object of ExpiringStore with its expiration time.
+type expiringEntry[T any] struct {
+	obj T
+	// expireAt is the time the object expires, zero means never.
+	expireAt time.Time
+}
+
+// NewExpiringStore returns an ExpiringStore whose objects expire by ttlPolicy,
+// use FixedTTL for a fixed time to live. keyFunc is used to make the key used
+// for item insertion and retrieval, and should be deterministic.
+// Use WithClock to inject a fake clock in tests.
+func NewExpiringStore[T any](keyFunc container.KeyFunc[T], ttlPolicy TTLPolicy[T], opts ...Option) *ExpiringStore[T] {
+	o := newOptions(opts...)
+	return &ExpiringStore[T]{
+		items:     map[string]expiringEntry[T]{},
+		keyFunc:   keyFunc,
+		ttlPolicy: ttlPolicy,
+		clock:     o.clock,
+	}
+}
+
+// Add inserts an item into the store, its time to live starts over.
+func (s *ExpiringStore[T]) Add(obj T) error {
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	now := s.clock.Now()
+	entry := s.newEntry(obj, now)
+	s.rw.Lock()
+	old, exists := s.items[key]
+	s.items[key] = entry
+	var events []Event[T]
+	if exists && old.expired(now) {
+		// the expired object is gone before the new one is added.
+		events = append(events, Event[T]{Type: EventDeleted, Key: key, Old: old.obj}, setEvent(key, old.obj, false, obj))
+	} else {
+		events = append(events, setEvent(key, old.obj, exists, obj))
+	}
+	s.watchers.notify(s.rw.Unlock, events...)
+	return nil
+}
+
+// Update sets an item in the store to its updated state, its time to live starts over.
+func (s *ExpiringStore[T]) Update(obj T) error {
+	return s.Add(obj)
+}
+
+// Delete removes an item from the store. An expired item which has not been
+// swept yet is swept by it, so the watchers see a single EventDeleted of it,
+// and no later sweep reports it again.
+func (s *ExpiringStore[T]) Delete(obj T) error {
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	s.rw.Lock()
+	old, exists := s.items[key]
+	if !exists {
+		s.rw.Unlock()
+		return nil
+	}
+	delete(s.items, key)
+	s.watchers.notify(s.rw.Unlock, Event[T]{Type: EventDeleted, Key: key, Old: old.obj})
+	return nil
+}
+
+// List returns a list of all the items which have not expired.
+func (s *ExpiringStore[T]) List() []T {
+	now := s.clock.Now()
+	var expired []string
+	s.rw.RLock()
+	r := make([]T, 0, len(s.items))
+	for key, entry := range s.items {
+		if entry.expired(now) {
+			expired = append(expired, key)
+			continue
+		}
+		r = append(r, entry.obj)
+	}
+	s.rw.RUnlock()
+	s.removeExpired(expired, now)
+	return r
+}
+
+// ListKeys returns a list of all the keys of the objects which have not expired.
+func (s *ExpiringStore[T]) ListKeys() []string {
+	now := s.clock.Now()
+	var expired []string
+	s.rw.RLock()
+	r := make([]string, 0, len(s.items))
+	for key, entry := range s.items {
+		if entry.expired(now) {
+			expired = append(expired, key)
+			continue
+		}
+		r = append(r, key)
+	}
+	s.rw.RUnlock()
+	s.removeExpired(expired, now)
+	return r
+}
+
+// Get returns the requested item, or sets exists=false if it is absent or expired.
+func (s *ExpiringStore[T]) Get(obj T) (item T, exists bool, err error) {
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return item, false, container.KeyError[T]{Obj: obj, Err: err}
+	}
+	return s.GetByKey(key)
+}
+
+// GetByKey returns the requested item, or sets exists=false if it is absent or expired.
+func (s *ExpiringStore[T]) GetByKey(key string) (item T, exists bool, err error) {
+	now := s.clock.Now()
+	s.rw.RLock()
+	entry, exists := s.items[key]
+	s.rw.RUnlock()
+	if !exists {
+		return item, false, nil
+	}
+	if entry.expired(now) {
+		s.removeExpired([]string{key}, now)
+		return item, false, nil
+	}
+	return entry.obj, true, nil
+}
+
+// Replace will delete the contents of the store, using instead the given list,
+// and records resourceVersion as the last sync resource version.
+// The time to live of all the items starts now. The expired items are swept
+// first, each with an EventDeleted, and left out of the OldObjects of the
+// EventReplaced.
+func (s *ExpiringStore[T]) Replace(list []T, resourceVersion string) error {
+	now := s.clock.Now()
+	items := make(map[string]expiringEntry[T], len(list))
+	for _, item := range list {
+		key, err := s.keyFunc(item)
+		if err != nil {
+			return container.KeyError[T]{Obj: item, Err: err}
+		}
+		items[key] = s.newEntry(item, now)
+	}
+
+	s.rw.Lock()
+	var events []Event[T]
+	if s.watchers.watching() {
+		old := make([]T, 0, len(s.items))
+		for key, entry := range s.items {
+			if entry.expired(now) {
+				events = append(events, Event[T]{Type: EventDeleted, Key: key, Old: entry.obj})
+			} else {
+				old = append(old, entry.obj)
+			}
+		}
+		events = append(events, Event[T]{
+			Type:            EventReplaced,
+			OldObjects:      old,
+			Objects:         entryObjects(items),
+			ResourceVersion: resourceVersion,
+		})
+	}
+	s.items = items
+	s.lastSyncResourceVersion = resourceVersion
+	s.watchers.notify(s.rw.Unlock, events...)
+	return nil
+}
+
+// LastSyncResourceVersion returns the resource version passed to the last Replace.
+func (s *ExpiringStore[T]) LastSyncResourceVersion() string {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return s.lastSyncResourceVersion
+}
+
+// Resync is meaningless for the store, it is a no-op.
+func (s *ExpiringStore[T]) Resync() error {
+	return nil
+}
+
+// RemoveExpired removes all the expired items, it returns the number of the removed items.
+func (s *ExpiringStore[T]) RemoveExpired() int {
+	now := s.clock.Now()
+	s.rw.Lock()
+	var events []Event[T]
+	for key, entry := range s.items {
+		if entry.expired(now) {
+			delete(s.items, key)
+			events = append(events, Event[T]{Type: EventDeleted, Key: key, Old: entry.obj})
+		}
+	}
+	s.watchers.notify(s.rw.Unlock, events...)
+	return len(events)
+}
+
+// RunJanitor removes the expired items every period until ctx is done,
+// so the expired items which are never looked up do not pile up.
+func (s *ExpiringStore[T]) RunJanitor(ctx context.Context, period time.Duration) {
+	t := s.clock.NewTicker(period)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			s.RemoveExpired()
+		}
+	}
+}
+
+// Watch returns a channel of the changes of the store, which is closed once
+// ctx is done, or by OverflowDisconnect once its buffer is full.
+// Use WithInitialReplay to receive the objects which have not expired first.
+func (s *ExpiringStore[T]) Watch(ctx context.Context, opts ...WatchOption) <-chan Event[T] {
+	o := newWatchOptions(opts...)
+	now := s.clock.Now()
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	var replay []Event[T]
+	if o.replay {
+		items := make(map[string]T, len(s.items))
+		for key, entry := range s.items {
+			if !entry.expired(now) {
+				items[key] = entry.obj
+			}
+		}
+		replay = replayEvents(items)
+	}
+	return s.watchers.watch(ctx, o, replay)
+}
+
+func (s *ExpiringStore[T]) newEntry(obj T, now time.Time) expiringEntry[T] {
+	entry := expiringEntry[T]{obj: obj}
+	if ttl := s.ttlPolicy(obj); ttl > 0 {
+		entry.expireAt = now.Add(ttl)
+	}
+	return entry
+}
+
+// removeExpired removes the items of keys which are still expired at now,
+// an item may have been updated since it was found expired.
+func (s *ExpiringStore[T]) removeExpired(keys []string, now time.Time) {
+	if len(keys) == 0 {
+		return
+	}
+	s.rw.Lock()
+	var events []Event[T]
+	for _, key := range keys {
+		if entry, exists := s.items[key]; exists && entry.expired(now) {
+			delete(s.items, key)
+			events = append(events, Event[T]{Type: EventDeleted, Key: key, Old: entry.obj})
+		}
+	}
+	s.watchers.notify(s.rw.Unlock, events...)
+}
+
+func (e expiringEntry[T]) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// entryObjects returns the objects of the entries.
+func entryObjects[T any](entries map[string]expiringEntry[T]) []T {
+	r := make([]T, 0, len(entries))
+	for _, entry := range entries {
+		r = append(r, entry.obj)
+	}
+	return r
+}
@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/container/clock"
+)
+
+func Test_ExpiringStore(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	s := NewExpiringStore(testObjectKeyFunc, FixedTTL[testObject](time.Minute), WithClock(fakeClock))
+
+	require.NoError(t, s.Add(testObject{name: "a", val: 1}))
+	fakeClock.Step(30 * time.Second)
+	require.NoError(t, s.Add(testObject{name: "b", val: 2}))
+
+	item, exists, err := s.Get(testObject{name: "a"})
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, 1, item.val)
+
+	// a expires, b does not.
+	fakeClock.Step(30 * time.Second)
+	_, exists, err = s.GetByKey("a")
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Equal(t, []string{"b"}, s.ListKeys())
+	require.Equal(t, []string{"b"}, sortedKeys(s.List(), nameOf))
+
+	// an update starts the time to live over.
+	fakeClock.Step(20 * time.Second)
+	require.NoError(t, s.Update(testObject{name: "b", val: 3}))
+	fakeClock.Step(50 * time.Second)
+	item, exists, err = s.GetByKey("b")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, 3, item.val)
+
+	require.NoError(t, s.Delete(testObject{name: "b"}))
+	require.Empty(t, s.List())
+	_, _, err = s.Get(testObject{})
+	require.Error(t, err)
+}
+
+func Test_ExpiringStore_TTLPolicy(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	// the objects live val seconds, zero never expires.
+	policy := func(obj testObject) time.Duration { return time.Duration(obj.val) * time.Second }
+	s := NewExpiringStore(testObjectKeyFunc, policy, WithClock(fakeClock))
+
+	require.NoError(t, s.Replace([]testObject{
+		{name: "a", val: 1},
+		{name: "b", val: 2},
+		{name: "c", val: 0},
+	}, "7"))
+	require.Equal(t, "7", s.LastSyncResourceVersion())
+
+	fakeClock.Step(time.Second)
+	keys := s.ListKeys()
+	sort.Strings(keys)
+	require.Equal(t, []string{"b", "c"}, keys)
+	fakeClock.Step(time.Hour)
+	require.Equal(t, []string{"c"}, s.ListKeys())
+}
+
+func Test_ExpiringStore_RunJanitor(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	s := NewExpiringStore(testObjectKeyFunc, FixedTTL[testObject](time.Second), WithClock(fakeClock))
+	require.NoError(t, s.Add(testObject{name: "a", val: 1}))
+	require.NoError(t, s.Add(testObject{name: "b", val: 2}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.RunJanitor(ctx, time.Minute)
+	}()
+
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	fakeClock.Step(time.Minute)
+	require.Eventually(t, func() bool {
+		s.rw.RLock()
+		defer s.rw.RUnlock()
+		return len(s.items) == 0
+	}, time.Second, time.Millisecond)
+	require.Equal(t, 0, s.RemoveExpired())
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("RunJanitor did not return after ctx is done")
+	}
+}
@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/things-go/container"
+)
+
+// fakeWatchBufferSize is the buffer size of a fake watch, besides the replayed events.
+const fakeWatchBufferSize = 100
+
+// FakeListerWatcher is an in-memory ListerWatcher for tests. It holds the
+// objects keyed by keyFunc, every change bumps the resource version and
+// is sent to the open watches. A watch replays the changes after the
+// resource version it starts from.
+type FakeListerWatcher[T any] struct {
+	keyFunc container.KeyFunc[T]
+
+	mu              sync.Mutex
+	items           map[string]T
+	resourceVersion int
+	// history is the changes in order, the change of resource version N is history[N-1].
+	history  []WatchEvent[T]
+	watchers map[*fakeWatcher[T]]struct{}
+	listErr  error
+	watchErr error
+}
+
+type fakeWatcher[T any] struct {
+	ch  chan WatchEvent[T]
+	ctx context.Context
+}
+
+// FakeListerWatcher is a ListerWatcher
+var _ ListerWatcher[int] = (*FakeListerWatcher[int])(nil)
+
+// NewFakeListerWatcher returns a FakeListerWatcher holding the initial objects at resource version 0.
+func NewFakeListerWatcher[T any](keyFunc container.KeyFunc[T], initial ...T) *FakeListerWatcher[T] {
+	lw := &FakeListerWatcher[T]{
+		keyFunc:  keyFunc,
+		items:    map[string]T{},
+		watchers: map[*fakeWatcher[T]]struct{}{},
+	}
+	for _, obj := range initial {
+		if key, err := keyFunc(obj); err == nil {
+			lw.items[key] = obj
+		}
+	}
+	return lw
+}
+
+// List returns the objects ordered by key, and the current resource version.
+func (lw *FakeListerWatcher[T]) List(context.Context) ([]T, string, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if lw.listErr != nil {
+		return nil, "", lw.listErr
+	}
+	keys := mapKeys(lw.items)
+	sort.Strings(keys)
+	items := make([]T, 0, len(keys))
+	for _, key := range keys {
+		items = append(items, lw.items[key])
+	}
+	return items, strconv.Itoa(lw.resourceVersion), nil
+}
+
+// Watch starts a watch, which first replays the changes after resourceVersion,
+// an empty or invalid resourceVersion starts from now.
+func (lw *FakeListerWatcher[T]) Watch(ctx context.Context, resourceVersion string) (<-chan WatchEvent[T], error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if lw.watchErr != nil {
+		return nil, lw.watchErr
+	}
+	from, err := strconv.Atoi(resourceVersion)
+	if err != nil || from < 0 || from > lw.resourceVersion {
+		from = lw.resourceVersion
+	}
+	replay := lw.history[from:]
+	w := &fakeWatcher[T]{
+		ch:  make(chan WatchEvent[T], len(replay)+fakeWatchBufferSize),
+		ctx: ctx,
+	}
+	for _, event := range replay {
+		w.ch <- event
+	}
+	lw.watchers[w] = struct{}{}
+	go func() {
+		<-ctx.Done()
+		lw.mu.Lock()
+		defer lw.mu.Unlock()
+		lw.stopLocked(w)
+	}()
+	return w.ch, nil
+}
+
+// Add adds obj, and sends a WatchAdded event.
+func (lw *FakeListerWatcher[T]) Add(obj T) error {
+	return lw.change(WatchAdded, obj)
+}
+
+// Modify updates obj, and sends a WatchModified event.
+func (lw *FakeListerWatcher[T]) Modify(obj T) error {
+	return lw.change(WatchModified, obj)
+}
+
+// Delete deletes obj, and sends a WatchDeleted event.
+func (lw *FakeListerWatcher[T]) Delete(obj T) error {
+	return lw.change(WatchDeleted, obj)
+}
+
+// Error sends a WatchError event with err to the open watches, and ends them.
+func (lw *FakeListerWatcher[T]) Error(err error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	for w := range lw.watchers {
+		lw.send(w, WatchEvent[T]{Type: WatchError, Err: err})
+		lw.stopLocked(w)
+	}
+}
+
+// Stop ends the open watches, like a server closing them.
+func (lw *FakeListerWatcher[T]) Stop() {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	for w := range lw.watchers {
+		lw.stopLocked(w)
+	}
+}
+
+// SetListError makes List fail with err, nil clears it.
+func (lw *FakeListerWatcher[T]) SetListError(err error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.listErr = err
+}
+
+// SetWatchError makes Watch fail with err, nil clears it.
+func (lw *FakeListerWatcher[T]) SetWatchError(err error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.watchErr = err
+}
+
+// ResourceVersion returns the current resource version.
+func (lw *FakeListerWatcher[T]) ResourceVersion() string {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return strconv.Itoa(lw.resourceVersion)
+}
+
+func (lw *FakeListerWatcher[T]) change(eventType WatchEventType, obj T) error {
+	key, err := lw.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	if eventType == WatchDeleted {
+		delete(lw.items, key)
+	} else {
+		lw.items[key] = obj
+	}
+	lw.resourceVersion++
+	event := WatchEvent[T]{
+		Type:            eventType,
+		Object:          obj,
+		ResourceVersion: strconv.Itoa(lw.resourceVersion),
+	}
+	lw.history = append(lw.history, event)
+	for w := range lw.watchers {
+		lw.send(w, event)
+	}
+	return nil
+}
+
+// send blocks until the watcher takes the event, or its watch is stopped.
+func (lw *FakeListerWatcher[T]) send(w *fakeWatcher[T], event WatchEvent[T]) {
+	select {
+	case w.ch <- event:
+	case <-w.ctx.Done():
+	}
+}
+
+func (lw *FakeListerWatcher[T]) stopLocked(w *fakeWatcher[T]) {
+	if _, ok := lw.watchers[w]; ok {
+		delete(lw.watchers, w)
+		close(w.ch)
+	}
+}
@@ -0,0 +1,429 @@
+// Package cache implements thread-safe stores which hold the last-known
+// state of objects, keyed by container.KeyFunc, and a Reflector which
+// keeps a store in sync with a ListerWatcher, and an Informer which
+// notifies event handlers of the changes.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/things-go/container"
+)
+
+// ErrIndexNotFound used when the named index does not exist.
+var ErrIndexNotFound = errors.New("cache: index does not exist")
+
+// ErrIndexConflict used when an indexer with the same name already exists.
+var ErrIndexConflict = errors.New("cache: indexer conflict")
+
+// index maps the indexed value to a set of keys in the store that match on that value
+type index map[string]map[string]struct{}
+
+// Indexer is an Indexer
+var _ container.Indexer[int] = (*Indexer[int])(nil)
+
+// Indexer is a thread-safe store with secondary indexes. Each accumulator
+// is simply the most recently provided object, and deleting an object
+// empties the accumulator. The indexes are kept consistent with the
+// objects on every Add, Update, Delete and Replace.
+//
+// The objects returned from the Indexer are shared with it, you should
+// treat them as read-only.
+type Indexer[T any] struct {
+	rw    sync.RWMutex
+	items map[string]T
+
+	// keyFunc is used to make the key used for item insertion and retrieval, and
+	// should be deterministic.
+	keyFunc container.KeyFunc[T]
+
+	// indexers maps a name to an IndexFunc
+	indexers container.Indexers[T]
+	// indices maps a name to an index
+	indices map[string]index
+	// lastSyncResourceVersion is the resource version passed to the last Replace().
+	lastSyncResourceVersion string
+	// watchers of the indexer.
+	watchers broadcaster[T]
+}
+
+// NewIndexer returns an Indexer implemented simply with a map and a lock.
+// keyFunc is used to make the key used for item insertion and retrieval, and should be deterministic.
+func NewIndexer[T any](keyFunc container.KeyFunc[T], indexers container.Indexers[T]) *Indexer[T] {
+	c := &Indexer[T]{
+		items:    map[string]T{},
+		keyFunc:  keyFunc,
+		indexers: container.Indexers[T]{},
+		indices:  map[string]index{},
+	}
+	for name, indexFunc := range indexers {
+		c.indexers[name] = indexFunc
+		c.indices[name] = index{}
+	}
+	return c
+}
+
+// Add inserts an item into the indexer.
+func (c *Indexer[T]) Add(obj T) error {
+	key, err := c.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	c.rw.Lock()
+	old, exists := c.items[key]
+	if err = c.updateLocked(key, obj); err != nil {
+		c.rw.Unlock()
+		return err
+	}
+	c.watchers.notify(c.rw.Unlock, setEvent(key, old, exists, obj))
+	return nil
+}
+
+// Update sets an item in the indexer to its updated state.
+func (c *Indexer[T]) Update(obj T) error {
+	return c.Add(obj)
+}
+
+// Delete removes an item from the indexer.
+func (c *Indexer[T]) Delete(obj T) error {
+	key, err := c.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	c.rw.Lock()
+	oldObj, exists := c.items[key]
+	if !exists {
+		c.rw.Unlock()
+		return nil
+	}
+	indexValues, err := c.indexValues(oldObj)
+	if err != nil {
+		c.rw.Unlock()
+		return err
+	}
+	c.removeFromIndices(key, indexValues)
+	delete(c.items, key)
+	c.watchers.notify(c.rw.Unlock, Event[T]{Type: EventDeleted, Key: key, Old: oldObj})
+	return nil
+}
+
+// List returns a list of all the items.
+func (c *Indexer[T]) List() []T {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+	return mapValues(c.items)
+}
+
+// ListKeys returns a list of all the keys of the objects currently in the indexer.
+func (c *Indexer[T]) ListKeys() []string {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+	return mapKeys(c.items)
+}
+
+// Get returns the requested item, or sets exists=false.
+func (c *Indexer[T]) Get(obj T) (item T, exists bool, err error) {
+	key, err := c.keyFunc(obj)
+	if err != nil {
+		return item, false, container.KeyError[T]{Obj: obj, Err: err}
+	}
+	return c.GetByKey(key)
+}
+
+// GetByKey returns the requested item, or sets exists=false.
+func (c *Indexer[T]) GetByKey(key string) (item T, exists bool, err error) {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+	item, exists = c.items[key]
+	return item, exists, nil
+}
+
+// Replace will delete the contents of the indexer, using instead the
+// given list, and records resourceVersion as the last sync resource version.
+// The indexes are rebuilt, if any IndexFunc fails the indexer is left unchanged.
+func (c *Indexer[T]) Replace(list []T, resourceVersion string) error {
+	items := make(map[string]T, len(list))
+	for _, item := range list {
+		key, err := c.keyFunc(item)
+		if err != nil {
+			return container.KeyError[T]{Obj: item, Err: err}
+		}
+		items[key] = item
+	}
+
+	c.rw.Lock()
+	indices, err := buildIndices(c.indexers, items)
+	if err != nil {
+		c.rw.Unlock()
+		return err
+	}
+	var events []Event[T]
+	if c.watchers.watching() {
+		events = append(events, Event[T]{
+			Type:            EventReplaced,
+			OldObjects:      mapValues(c.items),
+			Objects:         mapValues(items),
+			ResourceVersion: resourceVersion,
+		})
+	}
+	c.items = items
+	c.indices = indices
+	c.lastSyncResourceVersion = resourceVersion
+	c.watchers.notify(c.rw.Unlock, events...)
+	return nil
+}
+
+// LastSyncResourceVersion returns the resource version passed to the last Replace.
+func (c *Indexer[T]) LastSyncResourceVersion() string {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+	return c.lastSyncResourceVersion
+}
+
+// Resync is meaningless for the indexer, it is a no-op.
+func (c *Indexer[T]) Resync() error {
+	return nil
+}
+
+// Watch returns a channel of the changes of the indexer, which is closed once
+// ctx is done, or by OverflowDisconnect once its buffer is full.
+// Use WithInitialReplay to receive the objects already in the indexer first.
+func (c *Indexer[T]) Watch(ctx context.Context, opts ...WatchOption) <-chan Event[T] {
+	o := newWatchOptions(opts...)
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+	var replay []Event[T]
+	if o.replay {
+		replay = replayEvents(c.items)
+	}
+	return c.watchers.watch(ctx, o, replay)
+}
+
+// Index returns a list of items that match the given object on the index function.
+func (c *Indexer[T]) Index(indexName string, obj T) ([]T, error) {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+
+	indexFunc := c.indexers[indexName]
+	if indexFunc == nil {
+		return nil, fmt.Errorf("%w: %s", ErrIndexNotFound, indexName)
+	}
+	indexedValues, err := indexFunc(obj)
+	if err != nil {
+		return nil, err
+	}
+	idx := c.indices[indexName]
+
+	var storeKeySet map[string]struct{}
+	if len(indexedValues) == 1 {
+		// In majority of cases, there is exactly one value matching.
+		// Optimize the most common path - deduping is not needed here.
+		storeKeySet = idx[indexedValues[0]]
+	} else {
+		// Need to de-dupe the return list.
+		// Since multiple keys are allowed, this can happen.
+		storeKeySet = map[string]struct{}{}
+		for _, indexedValue := range indexedValues {
+			for key := range idx[indexedValue] {
+				storeKeySet[key] = struct{}{}
+			}
+		}
+	}
+
+	list := make([]T, 0, len(storeKeySet))
+	for storeKey := range storeKeySet {
+		list = append(list, c.items[storeKey])
+	}
+	return list, nil
+}
+
+// ByIndex returns a list of the items whose indexed values in the given index include the given indexed value
+func (c *Indexer[T]) ByIndex(indexName, indexedValue string) ([]T, error) {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+
+	idx, exists := c.indices[indexName]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrIndexNotFound, indexName)
+	}
+	set := idx[indexedValue]
+	list := make([]T, 0, len(set))
+	for key := range set {
+		list = append(list, c.items[key])
+	}
+	return list, nil
+}
+
+// IndexKeys returns a list of the Store keys of the objects whose indexed values in the given index include the given indexed value.
+func (c *Indexer[T]) IndexKeys(indexName, indexedValue string) ([]string, error) {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+
+	idx, exists := c.indices[indexName]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrIndexNotFound, indexName)
+	}
+	return mapKeys(idx[indexedValue]), nil
+}
+
+// ListIndexFuncValues returns all the indexed values of the given index.
+func (c *Indexer[T]) ListIndexFuncValues(indexName string) []string {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+	return mapKeys(c.indices[indexName])
+}
+
+// GetIndexers returns a copy of the indexers.
+func (c *Indexer[T]) GetIndexers() container.Indexers[T] {
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+	indexers := make(container.Indexers[T], len(c.indexers))
+	for name, indexFunc := range c.indexers {
+		indexers[name] = indexFunc
+	}
+	return indexers
+}
+
+// AddIndexers adds more indexers to this indexer, the new indexes are built
+// from the items already in it.
+func (c *Indexer[T]) AddIndexers(newIndexers container.Indexers[T]) error {
+	c.rw.Lock()
+	defer c.rw.Unlock()
+
+	for name := range newIndexers {
+		if _, exists := c.indexers[name]; exists {
+			return fmt.Errorf("%w: %s", ErrIndexConflict, name)
+		}
+	}
+	indices, err := buildIndices(newIndexers, c.items)
+	if err != nil {
+		return err
+	}
+	for name, indexFunc := range newIndexers {
+		c.indexers[name] = indexFunc
+		c.indices[name] = indices[name]
+	}
+	return nil
+}
+
+// check returns the error which Add of obj fails with, without changing the indexer.
+func (c *Indexer[T]) check(obj T) error {
+	if _, err := c.keyFunc(obj); err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	c.rw.RLock()
+	defer c.rw.RUnlock()
+	_, err := c.indexValues(obj)
+	return err
+}
+
+// updateLocked stores obj under key and updates the indices,
+// if any IndexFunc fails nothing is changed. The caller must hold the lock.
+func (c *Indexer[T]) updateLocked(key string, obj T) error {
+	newValues, err := c.indexValues(obj)
+	if err != nil {
+		return err
+	}
+	if oldObj, exists := c.items[key]; exists {
+		oldValues, err := c.indexValues(oldObj)
+		if err != nil {
+			return err
+		}
+		c.removeFromIndices(key, oldValues)
+	}
+	c.items[key] = obj
+	c.addToIndices(key, newValues)
+	return nil
+}
+
+// indexValues computes the indexed values of obj for every index.
+func (c *Indexer[T]) indexValues(obj T) (map[string][]string, error) {
+	values := make(map[string][]string, len(c.indexers))
+	for name, indexFunc := range c.indexers {
+		indexValues, err := indexFunc(obj)
+		if err != nil {
+			return nil, fmt.Errorf("unable to calculate an index entry for index %q: %w", name, err)
+		}
+		values[name] = indexValues
+	}
+	return values, nil
+}
+
+// addToIndices adds key to the given indexed values of every index.
+func (c *Indexer[T]) addToIndices(key string, values map[string][]string) {
+	for name, indexValues := range values {
+		addKeyToIndex(c.indices[name], key, indexValues)
+	}
+}
+
+// removeFromIndices removes key from the given indexed values of every index.
+func (c *Indexer[T]) removeFromIndices(key string, values map[string][]string) {
+	for name, indexValues := range values {
+		idx := c.indices[name]
+		for _, value := range indexValues {
+			set := idx[value]
+			if set == nil {
+				continue
+			}
+			delete(set, key)
+			// If we don't delete the set when zero, indices with high cardinality
+			// short lived resources can cause memory to increase over time from
+			// unused empty sets.
+			if len(set) == 0 {
+				delete(idx, value)
+			}
+		}
+	}
+}
+
+// buildIndices builds the indices of indexers from items.
+func buildIndices[T any](indexers container.Indexers[T], items map[string]T) (map[string]index, error) {
+	indices := make(map[string]index, len(indexers))
+	for name, indexFunc := range indexers {
+		idx := index{}
+		for key, item := range items {
+			indexValues, err := indexFunc(item)
+			if err != nil {
+				return nil, fmt.Errorf("unable to calculate an index entry for index %q: %w", name, err)
+			}
+			addKeyToIndex(idx, key, indexValues)
+		}
+		indices[name] = idx
+	}
+	return indices, nil
+}
+
+// addKeyToIndex adds key to the given indexed values of idx.
+func addKeyToIndex(idx index, key string, indexValues []string) {
+	for _, value := range indexValues {
+		set := idx[value]
+		if set == nil {
+			set = map[string]struct{}{}
+			idx[value] = set
+		}
+		set[key] = struct{}{}
+	}
+}
+
+// mapValues returns the values of the map m.
+// The values will be in an indeterminate order.
+func mapValues[M ~map[K]V, K comparable, V any](m M) []V {
+	r := make([]V, 0, len(m))
+	for _, v := range m {
+		r = append(r, v)
+	}
+	return r
+}
+
+// mapKeys returns the keys of the map m.
+// The keys will be in an indeterminate order.
+func mapKeys[M ~map[K]V, K comparable, V any](m M) []K {
+	r := make([]K, 0, len(m))
+	for k := range m {
+		r = append(r, k)
+	}
+	return r
+}
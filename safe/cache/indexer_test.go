@@ -0,0 +1,203 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/container"
+)
+
+type testObject struct {
+	name   string
+	tenant string
+	labels []string
+	val    int
+}
+
+func testObjectKeyFunc(obj testObject) (string, error) {
+	if obj.name == "" {
+		return "", errors.New("empty name")
+	}
+	return obj.name, nil
+}
+
+func testTenantIndexFunc(obj testObject) ([]string, error) {
+	return []string{obj.tenant}, nil
+}
+
+func testLabelsIndexFunc(obj testObject) ([]string, error) {
+	return obj.labels, nil
+}
+
+func sortedKeys[T any](items []T, keyFunc func(T) string) []string {
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, keyFunc(item))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func nameOf(obj testObject) string { return obj.name }
+
+func newTestIndexer() *Indexer[testObject] {
+	return NewIndexer(testObjectKeyFunc, container.Indexers[testObject]{
+		"tenant": testTenantIndexFunc,
+		"labels": testLabelsIndexFunc,
+	})
+}
+
+func Test_Indexer_basic(t *testing.T) {
+	c := newTestIndexer()
+
+	require.NoError(t, c.Add(testObject{name: "a", tenant: "t1", val: 1}))
+	require.NoError(t, c.Add(testObject{name: "b", tenant: "t1", val: 2}))
+	require.NoError(t, c.Add(testObject{name: "c", tenant: "t2", val: 3}))
+	require.Error(t, c.Add(testObject{}))
+
+	require.Equal(t, []string{"a", "b", "c"}, sortedKeys(c.List(), nameOf))
+	keys := c.ListKeys()
+	sort.Strings(keys)
+	require.Equal(t, []string{"a", "b", "c"}, keys)
+
+	item, exists, err := c.Get(testObject{name: "a"})
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, 1, item.val)
+
+	require.NoError(t, c.Update(testObject{name: "a", tenant: "t2", val: 10}))
+	item, exists, err = c.GetByKey("a")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, 10, item.val)
+
+	require.NoError(t, c.Delete(testObject{name: "b"}))
+	_, exists, err = c.GetByKey("b")
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.NoError(t, c.Delete(testObject{name: "b"}))
+
+	_, _, err = c.Get(testObject{})
+	require.Error(t, err)
+	require.NoError(t, c.Resync())
+}
+
+func Test_Indexer_index(t *testing.T) {
+	c := newTestIndexer()
+
+	require.NoError(t, c.Add(testObject{name: "a", tenant: "t1", labels: []string{"x", "y"}}))
+	require.NoError(t, c.Add(testObject{name: "b", tenant: "t1", labels: []string{"y"}}))
+	require.NoError(t, c.Add(testObject{name: "c", tenant: "t2", labels: []string{"z"}}))
+
+	list, err := c.ByIndex("tenant", "t1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, sortedKeys(list, nameOf))
+
+	keys, err := c.IndexKeys("labels", "y")
+	require.NoError(t, err)
+	sort.Strings(keys)
+	require.Equal(t, []string{"a", "b"}, keys)
+
+	list, err = c.Index("labels", testObject{labels: []string{"x", "z"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c"}, sortedKeys(list, nameOf))
+
+	list, err = c.Index("tenant", testObject{tenant: "t2"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"c"}, sortedKeys(list, nameOf))
+
+	values := c.ListIndexFuncValues("labels")
+	sort.Strings(values)
+	require.Equal(t, []string{"x", "y", "z"}, values)
+
+	// update moves the key between the indexed values.
+	require.NoError(t, c.Update(testObject{name: "a", tenant: "t2", labels: []string{"z"}}))
+	list, err = c.ByIndex("tenant", "t1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, sortedKeys(list, nameOf))
+	values = c.ListIndexFuncValues("labels")
+	sort.Strings(values)
+	require.Equal(t, []string{"y", "z"}, values)
+
+	// delete removes the key and the empty indexed values.
+	require.NoError(t, c.Delete(testObject{name: "b"}))
+	require.Equal(t, []string{"z"}, c.ListIndexFuncValues("labels"))
+	values = c.ListIndexFuncValues("tenant")
+	require.Equal(t, []string{"t2"}, values)
+
+	_, err = c.ByIndex("missing", "t1")
+	require.ErrorIs(t, err, ErrIndexNotFound)
+	_, err = c.IndexKeys("missing", "t1")
+	require.ErrorIs(t, err, ErrIndexNotFound)
+	_, err = c.Index("missing", testObject{})
+	require.ErrorIs(t, err, ErrIndexNotFound)
+	require.Empty(t, c.ListIndexFuncValues("missing"))
+}
+
+func Test_Indexer_Replace(t *testing.T) {
+	c := newTestIndexer()
+
+	require.NoError(t, c.Add(testObject{name: "a", tenant: "t1"}))
+	require.NoError(t, c.Replace([]testObject{
+		{name: "b", tenant: "t2"},
+		{name: "c", tenant: "t2"},
+	}, "1"))
+
+	require.Equal(t, []string{"b", "c"}, sortedKeys(c.List(), nameOf))
+	require.Equal(t, "1", c.LastSyncResourceVersion())
+	list, err := c.ByIndex("tenant", "t1")
+	require.NoError(t, err)
+	require.Empty(t, list)
+	list, err = c.ByIndex("tenant", "t2")
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "c"}, sortedKeys(list, nameOf))
+
+	require.Error(t, c.Replace([]testObject{{}}, "2"))
+	require.Equal(t, []string{"b", "c"}, sortedKeys(c.List(), nameOf))
+	require.Equal(t, "1", c.LastSyncResourceVersion())
+}
+
+func Test_Indexer_indexFuncError(t *testing.T) {
+	c := NewIndexer(testObjectKeyFunc, container.Indexers[testObject]{
+		"tenant": func(obj testObject) ([]string, error) {
+			if obj.tenant == "" {
+				return nil, errors.New("empty tenant")
+			}
+			return []string{obj.tenant}, nil
+		},
+	})
+
+	require.NoError(t, c.Add(testObject{name: "a", tenant: "t1"}))
+	// the failed update leaves the indexer unchanged.
+	require.Error(t, c.Update(testObject{name: "a"}))
+	item, _, _ := c.GetByKey("a")
+	require.Equal(t, "t1", item.tenant)
+	keys, err := c.IndexKeys("tenant", "t1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, keys)
+
+	require.Error(t, c.Replace([]testObject{{name: "b"}}, ""))
+	require.Equal(t, []string{"a"}, c.ListKeys())
+}
+
+func Test_Indexer_AddIndexers(t *testing.T) {
+	c := NewIndexer(testObjectKeyFunc, container.Indexers[testObject]{
+		"tenant": testTenantIndexFunc,
+	})
+	require.NoError(t, c.Add(testObject{name: "a", tenant: "t1", labels: []string{"x"}}))
+	require.NoError(t, c.Add(testObject{name: "b", tenant: "t2", labels: []string{"x"}}))
+
+	err := c.AddIndexers(container.Indexers[testObject]{"tenant": testTenantIndexFunc})
+	require.ErrorIs(t, err, ErrIndexConflict)
+
+	require.NoError(t, c.AddIndexers(container.Indexers[testObject]{"labels": testLabelsIndexFunc}))
+	require.Len(t, c.GetIndexers(), 2)
+
+	// built from the items already in it.
+	list, err := c.ByIndex("labels", "x")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, sortedKeys(list, nameOf))
+}
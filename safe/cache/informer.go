@@ -0,0 +1,400 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/clock"
+	"github.com/things-go/container/go/list"
+	"github.com/things-go/container/safe/fifo"
+)
+
+// syncedPollPeriod is how often WaitForCacheSync polls the sync functions.
+const syncedPollPeriod = 100 * time.Millisecond
+
+// ResourceEventHandler can handle notifications for events that happen to a resource.
+// The events are informational only, so you can't return an error. The handlers
+// MUST NOT modify the objects received, they are shared with the cache.
+//   - OnAdd is called when an object is added.
+//   - OnUpdate is called when an object is modified. Note that oldObj is the
+//     last known state of the object-- it is possible that several changes
+//     were combined together, so you can't use this to see every single
+//     change. OnUpdate is also called when a resync happens, in which case
+//     oldObj and newObj are the same object.
+//   - OnDelete will get the final state of the item if it is known, otherwise
+//     the last known state, if the deletion was missed while re-listing.
+type ResourceEventHandler[T any] interface {
+	OnAdd(obj T)
+	OnUpdate(oldObj, newObj T)
+	OnDelete(obj T)
+}
+
+// ResourceEventHandlerFuncs is an adaptor to let you easily specify as many or
+// as few of the notification functions as you want while still implementing
+// ResourceEventHandler.
+type ResourceEventHandlerFuncs[T any] struct {
+	AddFunc    func(obj T)
+	UpdateFunc func(oldObj, newObj T)
+	DeleteFunc func(obj T)
+}
+
+// ResourceEventHandlerFuncs is a ResourceEventHandler
+var _ ResourceEventHandler[int] = ResourceEventHandlerFuncs[int]{}
+
+// OnAdd calls AddFunc if it's not nil.
+func (r ResourceEventHandlerFuncs[T]) OnAdd(obj T) {
+	if r.AddFunc != nil {
+		r.AddFunc(obj)
+	}
+}
+
+// OnUpdate calls UpdateFunc if it's not nil.
+func (r ResourceEventHandlerFuncs[T]) OnUpdate(oldObj, newObj T) {
+	if r.UpdateFunc != nil {
+		r.UpdateFunc(oldObj, newObj)
+	}
+}
+
+// OnDelete calls DeleteFunc if it's not nil.
+func (r ResourceEventHandlerFuncs[T]) OnDelete(obj T) {
+	if r.DeleteFunc != nil {
+		r.DeleteFunc(obj)
+	}
+}
+
+// Informer keeps an Indexer in sync with the resource of a ListerWatcher,
+// and notifies the ResourceEventHandlers of the changes.
+//
+// A Reflector feeds the changes into a fifo.DeltaFIFO, whose known objects
+// are the Indexer. The Deltas of each key are popped in order, applied to
+// the Indexer, and then handed to every handler. Each handler has its own
+// unbounded buffer and goroutine, so a slow handler never blocks the
+// Indexer or the other handlers. The Deltas which the Indexer fails to
+// apply are requeued as a whole, and popped again after a backoff, the
+// handlers are only notified once all the Deltas of a key are applied.
+type Informer[T any] struct {
+	indexer   *Indexer[T]
+	queue     *fifo.DeltaFIFO[T]
+	reflector *Reflector[T]
+
+	clock          clock.Clock
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	errorHandler   func(err error)
+
+	// mu guards the listeners, it is also held while the Deltas are
+	// handled, so a handler added later sees a consistent replay.
+	mu        sync.Mutex
+	listeners []*processorListener[T]
+	// requeued holds the keys of the initial list which are requeued,
+	// the informer has not synced while any of them is not applied.
+	requeued map[string]struct{}
+	synced   bool
+	started  bool
+	stopped  bool
+	wg       sync.WaitGroup
+}
+
+// NewInformer returns an Informer which keeps an Indexer with indexers in sync
+// with the resource of lw. keyFunc is used to make the key of the objects,
+// and should be deterministic. The options are passed to the Reflector,
+// use WithResyncPeriod to resync the handlers periodically.
+func NewInformer[T any](lw ListerWatcher[T], keyFunc container.KeyFunc[T], indexers container.Indexers[T], opts ...Option) *Informer[T] {
+	o := newOptions(opts...)
+	indexer := NewIndexer(keyFunc, indexers)
+	queue := fifo.NewDeltaFIFO(keyFunc, fifo.WithKnownObjects[T](indexer))
+	return &Informer[T]{
+		indexer:        indexer,
+		queue:          queue,
+		reflector:      NewReflector[T](lw, queue, opts...),
+		clock:          o.clock,
+		initialBackoff: o.initialBackoff,
+		maxBackoff:     o.maxBackoff,
+		errorHandler:   o.errorHandler,
+		requeued:       map[string]struct{}{},
+	}
+}
+
+// AddEventHandler adds a handler to the informer. A handler added after
+// Run receives an OnAdd for every object already in the Indexer first.
+// It is a no-op once the informer is stopped.
+func (inf *Informer[T]) AddEventHandler(handler ResourceEventHandler[T]) {
+	inf.mu.Lock()
+	defer inf.mu.Unlock()
+	if inf.stopped {
+		return
+	}
+	l := newProcessorListener(handler)
+	inf.listeners = append(inf.listeners, l)
+	if inf.started {
+		for _, obj := range inf.indexer.List() {
+			l.add(notification[T]{kind: addNotification, newObj: obj})
+		}
+		inf.wg.Add(1)
+		go l.run(&inf.wg)
+	}
+}
+
+// Run starts the informer, it blocks until ctx is done and the handlers
+// have returned. Run can only be called once.
+func (inf *Informer[T]) Run(ctx context.Context) {
+	inf.mu.Lock()
+	if inf.started {
+		inf.mu.Unlock()
+		return
+	}
+	inf.started = true
+	for _, l := range inf.listeners {
+		inf.wg.Add(1)
+		go l.run(&inf.wg)
+	}
+	inf.mu.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		inf.reflector.Run(ctx)
+	}()
+	backoff := inf.initialBackoff
+	for ctx.Err() == nil {
+		_, err := inf.queue.PopDeltasContext(ctx, inf.handleDeltas)
+		if err == nil {
+			backoff = inf.initialBackoff
+			continue
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		if inf.errorHandler != nil {
+			inf.errorHandler(err)
+		}
+		// the Deltas are requeued, back off so a failing Indexer does not make a hot loop.
+		select {
+		case <-ctx.Done():
+		case <-inf.clock.After(backoff):
+		}
+		backoff = min(2*backoff, inf.maxBackoff)
+	}
+	inf.queue.Close()
+	wg.Wait()
+
+	inf.mu.Lock()
+	inf.stopped = true
+	for _, l := range inf.listeners {
+		l.stop()
+	}
+	inf.mu.Unlock()
+	inf.wg.Wait()
+}
+
+// HasSynced returns true once the first list of the resource has been
+// applied to the Indexer.
+func (inf *Informer[T]) HasSynced() bool {
+	// the queue is asked before taking the lock, the Deltas are handled
+	// under the lock of the queue, which then takes inf.mu.
+	popped := inf.queue.HasSynced()
+	inf.mu.Lock()
+	defer inf.mu.Unlock()
+	if !inf.synced && popped && len(inf.requeued) == 0 {
+		inf.synced = true
+	}
+	return inf.synced
+}
+
+// WaitForCacheSync is the same as WaitForCacheSync, but it polls with
+// the clock of the informer.
+func (inf *Informer[T]) WaitForCacheSync(ctx context.Context, cacheSyncs ...func() bool) bool {
+	return waitForCacheSync(ctx, inf.clock, append([]func() bool{inf.HasSynced}, cacheSyncs...))
+}
+
+// GetIndexer returns the Indexer kept in sync by the informer,
+// it should be treated as read-only.
+func (inf *Informer[T]) GetIndexer() *Indexer[T] {
+	return inf.indexer
+}
+
+// LastSyncResourceVersion is the resource version observed when last synced
+// with the underlying store.
+func (inf *Informer[T]) LastSyncResourceVersion() string {
+	return inf.reflector.LastSyncResourceVersion()
+}
+
+// handleDeltas applies the Deltas of a key to the Indexer, and notifies the
+// handlers. The Deltas are requeued if the Indexer fails, so it does not
+// drift away from the source.
+func (inf *Informer[T]) handleDeltas(deltas fifo.Deltas[T]) error {
+	inf.mu.Lock()
+	defer inf.mu.Unlock()
+	key, _ := inf.indexer.keyFunc(deltas[len(deltas)-1].Object)
+	if err := inf.applyDeltas(deltas); err != nil {
+		if !inf.synced {
+			inf.requeued[key] = struct{}{}
+		}
+		return fifo.ErrRequeue{Err: err}
+	}
+	delete(inf.requeued, key)
+	return nil
+}
+
+// applyDeltas applies the Deltas of a key to the Indexer, and notifies the
+// handlers once all of them are applied. The Deltas are checked first, so
+// a failing IndexFunc changes neither the Indexer nor notifies the handlers.
+// The caller must hold the lock.
+func (inf *Informer[T]) applyDeltas(deltas fifo.Deltas[T]) error {
+	for _, d := range deltas {
+		if d.Type == fifo.Deleted {
+			continue
+		}
+		if err := inf.indexer.check(d.Object); err != nil {
+			return err
+		}
+	}
+
+	notifications := make([]notification[T], 0, len(deltas))
+	for _, d := range deltas {
+		switch d.Type {
+		case fifo.Sync, fifo.Replaced, fifo.Added, fifo.Updated:
+			old, exists, err := inf.indexer.Get(d.Object)
+			if err != nil {
+				return err
+			}
+			if exists {
+				if err = inf.indexer.Update(d.Object); err != nil {
+					return err
+				}
+				notifications = append(notifications, notification[T]{kind: updateNotification, oldObj: old, newObj: d.Object})
+			} else {
+				if err = inf.indexer.Add(d.Object); err != nil {
+					return err
+				}
+				notifications = append(notifications, notification[T]{kind: addNotification, newObj: d.Object})
+			}
+		case fifo.Deleted:
+			if err := inf.indexer.Delete(d.Object); err != nil {
+				return err
+			}
+			notifications = append(notifications, notification[T]{kind: deleteNotification, oldObj: d.Object})
+		}
+	}
+	for _, n := range notifications {
+		inf.distribute(n)
+	}
+	return nil
+}
+
+// distribute hands the notification to every listener, the caller must hold the lock.
+func (inf *Informer[T]) distribute(n notification[T]) {
+	for _, l := range inf.listeners {
+		l.add(n)
+	}
+}
+
+// WaitForCacheSync waits until every cacheSyncs returns true, such as
+// Informer.HasSynced. It returns false if ctx is done first.
+func WaitForCacheSync(ctx context.Context, cacheSyncs ...func() bool) bool {
+	return waitForCacheSync(ctx, clock.RealClock{}, cacheSyncs)
+}
+
+// waitForCacheSync polls cacheSyncs with clk until every one returns true.
+func waitForCacheSync(ctx context.Context, clk clock.Clock, cacheSyncs []func() bool) bool {
+	t := clk.NewTicker(syncedPollPeriod)
+	defer t.Stop()
+	for {
+		synced := true
+		for _, hasSynced := range cacheSyncs {
+			if !hasSynced() {
+				synced = false
+				break
+			}
+		}
+		if synced {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-t.C():
+		}
+	}
+}
+
+type notificationType int
+
+const (
+	addNotification notificationType = iota
+	updateNotification
+	deleteNotification
+)
+
+type notification[T any] struct {
+	kind   notificationType
+	oldObj T
+	newObj T
+}
+
+// processorListener relays the notifications to a handler, it buffers
+// the notifications which the handler has not yet taken.
+type processorListener[T any] struct {
+	handler ResourceEventHandler[T]
+
+	mu      sync.Mutex
+	cond    sync.Cond
+	pending *list.List[notification[T]]
+	stopped bool
+}
+
+func newProcessorListener[T any](handler ResourceEventHandler[T]) *processorListener[T] {
+	l := &processorListener[T]{
+		handler: handler,
+		pending: list.New[notification[T]](),
+	}
+	l.cond.L = &l.mu
+	return l
+}
+
+func (l *processorListener[T]) add(n notification[T]) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return
+	}
+	l.pending.PushBack(n)
+	l.cond.Signal()
+}
+
+// stop the listener, the pending notifications are dropped.
+func (l *processorListener[T]) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.stopped = true
+	l.pending.Init()
+	l.cond.Broadcast()
+}
+
+func (l *processorListener[T]) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for {
+		l.mu.Lock()
+		for l.pending.Len() == 0 && !l.stopped {
+			l.cond.Wait()
+		}
+		if l.stopped {
+			l.mu.Unlock()
+			return
+		}
+		n := l.pending.Remove(l.pending.Front())
+		l.mu.Unlock()
+
+		switch n.kind {
+		case addNotification:
+			l.handler.OnAdd(n.newObj)
+		case updateNotification:
+			l.handler.OnUpdate(n.oldObj, n.newObj)
+		case deleteNotification:
+			l.handler.OnDelete(n.oldObj)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/clock"
+	"github.com/things-go/container/safe/fifo"
+)
+
+// testHandler records the notifications as strings.
+type testHandler struct {
+	mu     sync.Mutex
+	events []string
+	block  chan struct{}
+}
+
+func (h *testHandler) OnAdd(obj testObject) {
+	h.record(fmt.Sprintf("add %s/%d", obj.name, obj.val))
+}
+
+func (h *testHandler) OnUpdate(oldObj, newObj testObject) {
+	h.record(fmt.Sprintf("update %s/%d->%d", newObj.name, oldObj.val, newObj.val))
+}
+
+func (h *testHandler) OnDelete(obj testObject) {
+	h.record(fmt.Sprintf("delete %s", obj.name))
+}
+
+func (h *testHandler) record(event string) {
+	if h.block != nil {
+		<-h.block
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, event)
+}
+
+func (h *testHandler) recorded() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]string(nil), h.events...)
+}
+
+func runInformer(t *testing.T, inf *Informer[testObject]) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		inf.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("Run did not return after ctx is done")
+		}
+	})
+}
+
+func Test_Informer(t *testing.T) {
+	lw := NewFakeListerWatcher(testObjectKeyFunc,
+		testObject{name: "a", tenant: "x", val: 1},
+		testObject{name: "b", tenant: "y", val: 2},
+	)
+	inf := NewInformer[testObject](lw, testObjectKeyFunc, container.Indexers[testObject]{
+		"tenant": testTenantIndexFunc,
+	})
+	h := &testHandler{}
+	inf.AddEventHandler(h)
+	require.False(t, inf.HasSynced())
+
+	runInformer(t, inf)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.True(t, WaitForCacheSync(ctx, inf.HasSynced))
+	require.Equal(t, "0", inf.LastSyncResourceVersion())
+	require.Equal(t, []string{"a", "b"}, sortedKeys(inf.GetIndexer().List(), nameOf))
+
+	require.NoError(t, lw.Add(testObject{name: "c", tenant: "x", val: 3}))
+	require.NoError(t, lw.Modify(testObject{name: "a", tenant: "x", val: 10}))
+	require.NoError(t, lw.Delete(testObject{name: "b"}))
+	want := []string{"add a/1", "add b/2", "add c/3", "update a/1->10", "delete b"}
+	require.Eventually(t, func() bool { return len(h.recorded()) == len(want) }, time.Second, time.Millisecond)
+	require.Equal(t, want, h.recorded())
+
+	items, err := inf.GetIndexer().ByIndex("tenant", "x")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "c"}, sortedKeys(items, nameOf))
+}
+
+func Test_Informer_lateHandler(t *testing.T) {
+	lw := NewFakeListerWatcher(testObjectKeyFunc, testObject{name: "a", val: 1}, testObject{name: "b", val: 2})
+	inf := NewInformer[testObject](lw, testObjectKeyFunc, nil)
+	runInformer(t, inf)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.True(t, WaitForCacheSync(ctx, inf.HasSynced))
+
+	// the handler added after the sync gets the objects in the indexer first.
+	h := &testHandler{}
+	inf.AddEventHandler(h)
+	require.NoError(t, lw.Add(testObject{name: "c", val: 3}))
+	require.Eventually(t, func() bool { return len(h.recorded()) == 3 }, time.Second, time.Millisecond)
+	got := h.recorded()
+	require.ElementsMatch(t, []string{"add a/1", "add b/2"}, got[:2])
+	require.Equal(t, "add c/3", got[2])
+}
+
+func Test_Informer_slowHandler(t *testing.T) {
+	lw := NewFakeListerWatcher(testObjectKeyFunc, testObject{name: "a", val: 1})
+	inf := NewInformer[testObject](lw, testObjectKeyFunc, nil)
+	slow := &testHandler{block: make(chan struct{})}
+	fast := &testHandler{}
+	inf.AddEventHandler(slow)
+	inf.AddEventHandler(fast)
+	runInformer(t, inf)
+	t.Cleanup(func() { close(slow.block) })
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.True(t, WaitForCacheSync(ctx, inf.HasSynced))
+
+	// a blocked handler neither blocks the indexer nor the other handlers.
+	for i := 2; i <= 10; i++ {
+		require.NoError(t, lw.Modify(testObject{name: "a", val: i}))
+	}
+	require.Eventually(t, func() bool { return len(fast.recorded()) == 10 }, time.Second, time.Millisecond)
+	item, exists, err := inf.GetIndexer().GetByKey("a")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, 10, item.val)
+	require.Empty(t, slow.recorded())
+
+	for i := 0; i < 10; i++ {
+		slow.block <- struct{}{}
+	}
+	require.Eventually(t, func() bool { return len(slow.recorded()) == 10 }, time.Second, time.Millisecond)
+	require.Equal(t, fast.recorded(), slow.recorded())
+}
+
+func Test_Informer_resync(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	lw := NewFakeListerWatcher(testObjectKeyFunc, testObject{name: "a", val: 1})
+	inf := NewInformer[testObject](lw, testObjectKeyFunc, nil, WithClock(fakeClock), WithResyncPeriod(time.Minute))
+	h := &testHandler{}
+	inf.AddEventHandler(h)
+	runInformer(t, inf)
+	require.Eventually(t, func() bool { return len(h.recorded()) == 1 }, time.Second, time.Millisecond)
+
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	fakeClock.Step(time.Minute)
+	require.Eventually(t, func() bool { return len(h.recorded()) == 2 }, time.Second, time.Millisecond)
+	require.Equal(t, []string{"add a/1", "update a/1->1"}, h.recorded())
+}
+
+func Test_Informer_requeueOnIndexerError(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	lw := NewFakeListerWatcher(testObjectKeyFunc, testObject{name: "a", tenant: "x", val: 1})
+	var failing atomic.Bool
+	failing.Store(true)
+	indexErr := errors.New("index failed")
+	var reported atomic.Int64
+	inf := NewInformer[testObject](lw, testObjectKeyFunc, container.Indexers[testObject]{
+		"tenant": func(obj testObject) ([]string, error) {
+			if failing.Load() {
+				return nil, indexErr
+			}
+			return []string{obj.tenant}, nil
+		},
+	}, WithClock(fakeClock), WithErrorHandler(func(err error) {
+		if errors.Is(err, indexErr) {
+			reported.Add(1)
+		}
+	}))
+	h := &testHandler{}
+	inf.AddEventHandler(h)
+	runInformer(t, inf)
+
+	// the Deltas are requeued, and popped again after a backoff.
+	require.Eventually(t, func() bool { return reported.Load() == 1 }, time.Second, time.Millisecond)
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	require.Empty(t, inf.GetIndexer().ListKeys())
+	// the requeued object of the first list is not in the indexer yet.
+	require.False(t, inf.HasSynced())
+
+	failing.Store(false)
+	fakeClock.Step(defaultInitialBackoff)
+	require.Eventually(t, func() bool { return len(h.recorded()) == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, []string{"add a/1"}, h.recorded())
+	require.Equal(t, []string{"a"}, inf.GetIndexer().ListKeys())
+	require.EqualValues(t, 1, reported.Load())
+	require.True(t, inf.HasSynced())
+}
+
+func Test_Informer_handleDeltasAllOrNothing(t *testing.T) {
+	lw := NewFakeListerWatcher(testObjectKeyFunc)
+	indexErr := errors.New("index failed")
+	inf := NewInformer[testObject](lw, testObjectKeyFunc, container.Indexers[testObject]{
+		"tenant": func(obj testObject) ([]string, error) {
+			if obj.tenant == "bad" {
+				return nil, indexErr
+			}
+			return []string{obj.tenant}, nil
+		},
+	})
+	h := &testHandler{}
+	inf.AddEventHandler(h)
+	l := inf.listeners[0]
+
+	// a failing later Delta neither changes the indexer nor notifies the handlers.
+	err := inf.handleDeltas(fifo.Deltas[testObject]{
+		{Type: fifo.Added, Object: testObject{name: "a", tenant: "x", val: 1}},
+		{Type: fifo.Updated, Object: testObject{name: "a", tenant: "bad", val: 2}},
+	})
+	var requeue fifo.ErrRequeue
+	require.ErrorAs(t, err, &requeue)
+	require.ErrorIs(t, requeue.Err, indexErr)
+	require.Empty(t, inf.GetIndexer().ListKeys())
+	require.Zero(t, l.pending.Len())
+
+	err = inf.handleDeltas(fifo.Deltas[testObject]{
+		{Type: fifo.Added, Object: testObject{name: "a", tenant: "x", val: 1}},
+		{Type: fifo.Updated, Object: testObject{name: "a", tenant: "y", val: 2}},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, inf.GetIndexer().ListKeys())
+	require.Equal(t, 2, l.pending.Len())
+}
+
+func Test_Informer_WaitForCacheSync(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	lw := NewFakeListerWatcher(testObjectKeyFunc, testObject{name: "a", val: 1})
+	inf := NewInformer[testObject](lw, testObjectKeyFunc, nil, WithClock(fakeClock))
+	synced := make(chan bool, 1)
+	go func() {
+		synced <- inf.WaitForCacheSync(context.Background())
+	}()
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	runInformer(t, inf)
+	require.Eventually(t, inf.HasSynced, time.Second, time.Millisecond)
+
+	// the informer polls with its own clock.
+	require.Never(t, func() bool { return len(synced) > 0 }, 2*syncedPollPeriod, time.Millisecond)
+	fakeClock.Step(syncedPollPeriod)
+	select {
+	case ok := <-synced:
+		require.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("WaitForCacheSync did not return after the clock stepped")
+	}
+}
+
+func Test_ResourceEventHandlerFuncs(t *testing.T) {
+	var added, deleted int
+	var h ResourceEventHandler[int] = ResourceEventHandlerFuncs[int]{
+		AddFunc:    func(obj int) { added += obj },
+		DeleteFunc: func(obj int) { deleted += obj },
+	}
+	h.OnAdd(1)
+	h.OnUpdate(1, 2)
+	h.OnDelete(3)
+	require.Equal(t, 1, added)
+	require.Equal(t, 3, deleted)
+}
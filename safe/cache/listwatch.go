@@ -0,0 +1,40 @@
+package cache
+
+import (
+	"context"
+)
+
+// WatchEventType defines the possible types of the watch events.
+type WatchEventType string
+
+// the types of the watch events.
+const (
+	WatchAdded    WatchEventType = "ADDED"
+	WatchModified WatchEventType = "MODIFIED"
+	WatchDeleted  WatchEventType = "DELETED"
+	// WatchError means the watch can not go on, the Reflector relists.
+	WatchError WatchEventType = "ERROR"
+)
+
+// WatchEvent is a change of an object, delivered by a watch.
+type WatchEvent[T any] struct {
+	Type WatchEventType
+	// Object is the state of the object after the change, or the last
+	// known state of a deleted object. It is not set for WatchError.
+	Object T
+	// ResourceVersion after the change, the watch can resume from it.
+	ResourceVersion string
+	// Err is the reason of WatchError.
+	Err error
+}
+
+// ListerWatcher is any object that knows how to perform an initial list
+// and start a watch on a resource.
+type ListerWatcher[T any] interface {
+	// List returns all the objects and the resource version of the list.
+	List(ctx context.Context) (items []T, resourceVersion string, err error)
+	// Watch starts watching the changes after resourceVersion. The watch
+	// ends when the returned channel is closed, and it is stopped by
+	// canceling ctx, which closes the channel.
+	Watch(ctx context.Context, resourceVersion string) (<-chan WatchEvent[T], error)
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/things-go/container/clock"
+)
+
+const (
+	// defaultInitialBackoff is the default initial delay before relisting after an error.
+	defaultInitialBackoff = 800 * time.Millisecond
+	// defaultMaxBackoff is the default max delay before relisting after an error.
+	defaultMaxBackoff = 30 * time.Second
+)
+
+// options of the reflector, the informer, the expiring store and the undelta store.
+type options struct {
+	clock          clock.Clock
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	resyncPeriod   time.Duration
+	coalesceWindow time.Duration
+	errorHandler   func(err error)
+}
+
+// Option for the reflector, the informer, the expiring store and the undelta store.
+type Option func(*options)
+
+// WithClock with a custom clock, default clock.RealClock.
+// It is mostly used to inject a fake clock in tests.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithBackoff set the delay before relisting after an error, or watching
+// again after a watch ended without any event, it starts at initial and
+// doubles on each consecutive one up to max, default 800ms and 30s.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(o *options) {
+		o.initialBackoff = initial
+		o.maxBackoff = max
+	}
+}
+
+// WithResyncPeriod set the period the store is resynced with Store.Resync,
+// zero means never, default never. An informer delivers the resynced
+// objects to the handlers with OnUpdate.
+func WithResyncPeriod(d time.Duration) Option {
+	return func(o *options) {
+		o.resyncPeriod = d
+	}
+}
+
+// WithCoalesceWindow set the window an UndeltaStore waits after a change
+// before it pushes, the changes in the window are pushed once together,
+// zero means every change is pushed right away, default zero.
+func WithCoalesceWindow(d time.Duration) Option {
+	return func(o *options) {
+		o.coalesceWindow = d
+	}
+}
+
+// WithErrorHandler set the function which is called with the errors which
+// are retried after a backoff: a failed list or watch of the reflector, and
+// a failed apply of the Deltas to the Indexer of the informer.
+// The errors are dropped if it is not set.
+func WithErrorHandler(handler func(err error)) Option {
+	return func(o *options) {
+		o.errorHandler = handler
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		clock:          clock.RealClock{},
+		initialBackoff: defaultInitialBackoff,
+		maxBackoff:     defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
@@ -0,0 +1,186 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/clock"
+)
+
+// Reflector watches a specified resource and causes all changes to be reflected in the given store.
+//
+// It lists the resource and calls Store.Replace with the list, then applies
+// the watch events from the resource version of the list with Add, Update
+// and Delete. When a watch ends it watches again from the last resource
+// version it has seen, after a backoff if the watch ended without any event,
+// and on any error it relists after a backoff.
+// If a resync period is set, Store.Resync is called periodically while watching.
+type Reflector[T any] struct {
+	lw    ListerWatcher[T]
+	store container.Store[T]
+
+	clock          clock.Clock
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	resyncPeriod   time.Duration
+	errorHandler   func(err error)
+
+	mu sync.RWMutex
+	// lastSyncResourceVersion is the resource version the store is synced to.
+	lastSyncResourceVersion string
+}
+
+// NewReflector returns a Reflector which keeps store in sync with the resource of lw.
+func NewReflector[T any](lw ListerWatcher[T], store container.Store[T], opts ...Option) *Reflector[T] {
+	o := newOptions(opts...)
+	return &Reflector[T]{
+		lw:             lw,
+		store:          store,
+		clock:          o.clock,
+		initialBackoff: o.initialBackoff,
+		maxBackoff:     o.maxBackoff,
+		resyncPeriod:   o.resyncPeriod,
+		errorHandler:   o.errorHandler,
+	}
+}
+
+// Run repeatedly uses ListAndWatch to fetch all the objects and subsequent
+// changes, until ctx is done. A failed ListAndWatch is retried after a backoff,
+// which is reset once a list succeeds, see WithErrorHandler.
+func (r *Reflector[T]) Run(ctx context.Context) {
+	backoff := r.initialBackoff
+	for {
+		listed, err := r.listAndWatch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && r.errorHandler != nil {
+			r.errorHandler(err)
+		}
+		if listed {
+			backoff = r.initialBackoff
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.clock.After(backoff):
+		}
+		backoff = min(2*backoff, r.maxBackoff)
+	}
+}
+
+// ListAndWatch first lists all the objects and replaces the store with them,
+// then watches the changes and applies them to the store. It returns an error
+// once a list, a watch or the store fails, or ctx.Err() once ctx is done.
+func (r *Reflector[T]) ListAndWatch(ctx context.Context) error {
+	_, err := r.listAndWatch(ctx)
+	return err
+}
+
+// LastSyncResourceVersion is the resource version observed when last synced with the underlying store.
+func (r *Reflector[T]) LastSyncResourceVersion() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastSyncResourceVersion
+}
+
+// listAndWatch is ListAndWatch, it also returns whether the list succeeded.
+func (r *Reflector[T]) listAndWatch(ctx context.Context) (listed bool, err error) {
+	items, resourceVersion, err := r.lw.List(ctx)
+	if err != nil {
+		return false, fmt.Errorf("cache: failed to list: %w", err)
+	}
+	if err = r.store.Replace(items, resourceVersion); err != nil {
+		return false, fmt.Errorf("cache: unable to sync list result: %w", err)
+	}
+	r.setLastSyncResourceVersion(resourceVersion)
+
+	var resyncCh <-chan time.Time
+	if r.resyncPeriod > 0 {
+		t := r.clock.NewTicker(r.resyncPeriod)
+		defer t.Stop()
+		resyncCh = t.C()
+	}
+	backoff := r.initialBackoff
+	for {
+		if err = ctx.Err(); err != nil {
+			return true, err
+		}
+		received, watchErr := r.watch(ctx, resyncCh)
+		if watchErr != nil {
+			return true, watchErr
+		}
+		if received {
+			backoff = r.initialBackoff
+			continue
+		}
+		// the watch ended without any event, back off so a watch which
+		// is closed at once does not make a hot loop.
+		select {
+		case <-ctx.Done():
+			return true, ctx.Err()
+		case <-r.clock.After(backoff):
+		}
+		backoff = min(2*backoff, r.maxBackoff)
+	}
+}
+
+// watch applies the events of a watch from the last synced resource version
+// until the watch ends, and resyncs the store on every tick of resyncCh.
+// It returns whether any event is received.
+func (r *Reflector[T]) watch(ctx context.Context, resyncCh <-chan time.Time) (received bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, err := r.lw.Watch(ctx, r.LastSyncResourceVersion())
+	if err != nil {
+		return false, fmt.Errorf("cache: failed to watch: %w", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return received, ctx.Err()
+		case <-resyncCh:
+			if err = r.store.Resync(); err != nil {
+				return received, fmt.Errorf("cache: unable to resync: %w", err)
+			}
+		case event, ok := <-events:
+			if !ok {
+				return received, nil
+			}
+			received = true
+			switch event.Type {
+			case WatchAdded:
+				err = r.store.Add(event.Object)
+			case WatchModified:
+				err = r.store.Update(event.Object)
+			case WatchDeleted:
+				err = r.store.Delete(event.Object)
+			case WatchError:
+				err = event.Err
+				if err == nil {
+					err = errors.New("unknown error")
+				}
+				return received, fmt.Errorf("cache: watch error: %w", err)
+			default:
+				return received, fmt.Errorf("cache: unknown watch event type %q", event.Type)
+			}
+			if err != nil {
+				return received, fmt.Errorf("cache: unable to apply watch event %s: %w", event.Type, err)
+			}
+			if event.ResourceVersion != "" {
+				r.setLastSyncResourceVersion(event.ResourceVersion)
+			}
+		}
+	}
+}
+
+func (r *Reflector[T]) setLastSyncResourceVersion(v string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastSyncResourceVersion = v
+}
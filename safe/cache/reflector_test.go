@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/container/clock"
+)
+
+func storeVal(s *Store[testObject], key string) int {
+	item, exists, _ := s.GetByKey(key)
+	if !exists {
+		return -1
+	}
+	return item.val
+}
+
+func Test_Reflector_Run(t *testing.T) {
+	lw := NewFakeListerWatcher(testObjectKeyFunc, testObject{name: "a", val: 1}, testObject{name: "b", val: 2})
+	s := NewStore(testObjectKeyFunc)
+	r := NewReflector[testObject](lw, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool { return len(s.ListKeys()) == 2 }, time.Second, time.Millisecond)
+	require.Equal(t, "0", s.LastSyncResourceVersion())
+
+	require.NoError(t, lw.Add(testObject{name: "c", val: 3}))
+	require.NoError(t, lw.Modify(testObject{name: "a", val: 10}))
+	require.NoError(t, lw.Delete(testObject{name: "b"}))
+	require.Eventually(t, func() bool { return r.LastSyncResourceVersion() == "3" }, time.Second, time.Millisecond)
+	require.Equal(t, []string{"a", "c"}, sortedKeys(s.List(), nameOf))
+	require.Equal(t, 10, storeVal(s, "a"))
+
+	// the watch is resumed from the last resource version, without a relist.
+	lw.Stop()
+	require.NoError(t, lw.Add(testObject{name: "d", val: 4}))
+	require.Eventually(t, func() bool { return r.LastSyncResourceVersion() == "4" }, time.Second, time.Millisecond)
+	require.Equal(t, 4, storeVal(s, "d"))
+	require.Equal(t, "0", s.LastSyncResourceVersion())
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after ctx is done")
+	}
+}
+
+func Test_Reflector_relistWithBackoff(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	lw := NewFakeListerWatcher(testObjectKeyFunc, testObject{name: "a", val: 1})
+	s := NewStore(testObjectKeyFunc)
+	r := NewReflector[testObject](lw, s, WithClock(fakeClock), WithBackoff(time.Second, 4*time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+	require.Eventually(t, func() bool { return len(s.ListKeys()) == 1 }, time.Second, time.Millisecond)
+
+	// the watch fails, and the list fails too.
+	listErr := errors.New("list failed")
+	lw.SetListError(listErr)
+	require.NoError(t, lw.Add(testObject{name: "b", val: 2}))
+	require.Eventually(t, func() bool { return len(s.ListKeys()) == 2 }, time.Second, time.Millisecond)
+	lw.Error(errors.New("too old resource version"))
+
+	// backoff 1s after the watch error, then 2s after the failed list.
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	fakeClock.Step(time.Second)
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	lw.SetListError(nil)
+	require.NoError(t, lw.Add(testObject{name: "c", val: 3}))
+	fakeClock.Step(time.Second)
+	time.Sleep(10 * time.Millisecond)
+	require.Len(t, s.ListKeys(), 2)
+	fakeClock.Step(time.Second)
+	require.Eventually(t, func() bool { return len(s.ListKeys()) == 3 }, time.Second, time.Millisecond)
+	require.Equal(t, "2", s.LastSyncResourceVersion())
+}
+
+// closingListerWatcher is a ListerWatcher whose watches are closed at once.
+type closingListerWatcher struct {
+	watches atomic.Int64
+}
+
+func (lw *closingListerWatcher) List(context.Context) ([]testObject, string, error) {
+	return nil, "1", nil
+}
+
+func (lw *closingListerWatcher) Watch(context.Context, string) (<-chan WatchEvent[testObject], error) {
+	lw.watches.Add(1)
+	ch := make(chan WatchEvent[testObject])
+	close(ch)
+	return ch, nil
+}
+
+func Test_Reflector_rewatchWithBackoff(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	lw := &closingListerWatcher{}
+	r := NewReflector[testObject](lw, NewStore(testObjectKeyFunc), WithClock(fakeClock), WithBackoff(time.Second, 4*time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	// backoff 1s, then 2s between the watches which are closed at once.
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	require.Never(t, func() bool { return lw.watches.Load() > 1 }, 20*time.Millisecond, time.Millisecond)
+	fakeClock.Step(time.Second)
+	require.Eventually(t, func() bool { return lw.watches.Load() == 2 }, time.Second, time.Millisecond)
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	fakeClock.Step(time.Second)
+	require.Never(t, func() bool { return lw.watches.Load() > 2 }, 20*time.Millisecond, time.Millisecond)
+	fakeClock.Step(time.Second)
+	require.Eventually(t, func() bool { return lw.watches.Load() == 3 }, time.Second, time.Millisecond)
+}
+
+func Test_Reflector_ListAndWatch(t *testing.T) {
+	lw := NewFakeListerWatcher(testObjectKeyFunc, testObject{name: "a", val: 1})
+	s := NewStore(testObjectKeyFunc)
+	r := NewReflector[testObject](lw, s)
+
+	listErr := errors.New("list failed")
+	lw.SetListError(listErr)
+	require.ErrorIs(t, r.ListAndWatch(context.Background()), listErr)
+	require.Empty(t, s.ListKeys())
+
+	lw.SetListError(nil)
+	watchErr := errors.New("watch failed")
+	lw.SetWatchError(watchErr)
+	require.ErrorIs(t, r.ListAndWatch(context.Background()), watchErr)
+	require.Equal(t, []string{"a"}, s.ListKeys())
+
+	lw.SetWatchError(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() { errCh <- r.ListAndWatch(ctx) }()
+	require.NoError(t, lw.Add(testObject{name: "b", val: 2}))
+	require.Eventually(t, func() bool { return len(s.ListKeys()) == 2 }, time.Second, time.Millisecond)
+	cancel()
+	require.ErrorIs(t, <-errCh, context.Canceled)
+
+	// an object which the store rejects fails the watch.
+	require.NoError(t, lw.Add(testObject{name: "c", val: 3}))
+	errCh = make(chan error, 1)
+	go func() { errCh <- r.ListAndWatch(context.Background()) }()
+	require.Eventually(t, func() bool { return len(s.ListKeys()) == 3 }, time.Second, time.Millisecond)
+	lw.mu.Lock()
+	for w := range lw.watchers {
+		lw.send(w, WatchEvent[testObject]{Type: WatchAdded, Object: testObject{}})
+	}
+	lw.mu.Unlock()
+	require.Error(t, <-errCh)
+}
+
+func Test_FakeListerWatcher_replay(t *testing.T) {
+	lw := NewFakeListerWatcher(testObjectKeyFunc)
+	require.NoError(t, lw.Add(testObject{name: "a", val: 1}))
+	require.NoError(t, lw.Add(testObject{name: "b", val: 2}))
+	require.NoError(t, lw.Delete(testObject{name: "a"}))
+
+	items, rv, err := lw.List(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "3", rv)
+	require.Equal(t, []testObject{{name: "b", val: 2}}, items)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := lw.Watch(ctx, "1")
+	require.NoError(t, err)
+	event := <-ch
+	require.Equal(t, WatchAdded, event.Type)
+	require.Equal(t, "2", event.ResourceVersion)
+	event = <-ch
+	require.Equal(t, WatchDeleted, event.Type)
+	require.Equal(t, "3", event.ResourceVersion)
+
+	cancel()
+	_, ok := <-ch
+	require.False(t, ok)
+}
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/things-go/container"
+)
+
+// Store is a Store
+var _ container.Store[int] = (*Store[int])(nil)
+
+// Store is a thread-safe cache, which holds the last-known state of
+// objects keyed by a KeyFunc. Each accumulator is simply the most recently
+// provided object, and deleting an object empties the accumulator.
+// Unlike fifo.FIFO, it never queues anything, the Resync operation is a no-op.
+//
+// The objects returned from the Store are shared with it, you should
+// treat them as read-only.
+type Store[T any] struct {
+	rw    sync.RWMutex
+	items map[string]T
+
+	// keyFunc is used to make the key used for item insertion and retrieval, and
+	// should be deterministic.
+	keyFunc container.KeyFunc[T]
+	// lastSyncResourceVersion is the resource version passed to the last Replace().
+	lastSyncResourceVersion string
+	// watchers of the store.
+	watchers broadcaster[T]
+}
+
+// NewStore returns a Store implemented simply with a map and a lock.
+// keyFunc is used to make the key used for item insertion and retrieval, and should be deterministic.
+func NewStore[T any](keyFunc container.KeyFunc[T]) *Store[T] {
+	return &Store[T]{
+		items:   map[string]T{},
+		keyFunc: keyFunc,
+	}
+}
+
+// Add inserts an item into the store.
+func (s *Store[T]) Add(obj T) error {
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	s.rw.Lock()
+	old, exists := s.items[key]
+	s.items[key] = obj
+	s.watchers.notify(s.rw.Unlock, setEvent(key, old, exists, obj))
+	return nil
+}
+
+// Update sets an item in the store to its updated state.
+func (s *Store[T]) Update(obj T) error {
+	return s.Add(obj)
+}
+
+// Delete removes an item from the store.
+func (s *Store[T]) Delete(obj T) error {
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	s.rw.Lock()
+	old, exists := s.items[key]
+	if !exists {
+		s.rw.Unlock()
+		return nil
+	}
+	delete(s.items, key)
+	s.watchers.notify(s.rw.Unlock, Event[T]{Type: EventDeleted, Key: key, Old: old})
+	return nil
+}
+
+// List returns a list of all the items.
+func (s *Store[T]) List() []T {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return mapValues(s.items)
+}
+
+// ListKeys returns a list of all the keys of the objects currently in the store.
+func (s *Store[T]) ListKeys() []string {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return mapKeys(s.items)
+}
+
+// Get returns the requested item, or sets exists=false.
+func (s *Store[T]) Get(obj T) (item T, exists bool, err error) {
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return item, false, container.KeyError[T]{Obj: obj, Err: err}
+	}
+	return s.GetByKey(key)
+}
+
+// GetByKey returns the requested item, or sets exists=false.
+func (s *Store[T]) GetByKey(key string) (item T, exists bool, err error) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	item, exists = s.items[key]
+	return item, exists, nil
+}
+
+// Replace will delete the contents of the store, using instead the given list,
+// and records resourceVersion as the last sync resource version.
+func (s *Store[T]) Replace(list []T, resourceVersion string) error {
+	items := make(map[string]T, len(list))
+	for _, item := range list {
+		key, err := s.keyFunc(item)
+		if err != nil {
+			return container.KeyError[T]{Obj: item, Err: err}
+		}
+		items[key] = item
+	}
+
+	s.rw.Lock()
+	var events []Event[T]
+	if s.watchers.watching() {
+		events = append(events, Event[T]{
+			Type:            EventReplaced,
+			OldObjects:      mapValues(s.items),
+			Objects:         mapValues(items),
+			ResourceVersion: resourceVersion,
+		})
+	}
+	s.items = items
+	s.lastSyncResourceVersion = resourceVersion
+	s.watchers.notify(s.rw.Unlock, events...)
+	return nil
+}
+
+// LastSyncResourceVersion returns the resource version passed to the last Replace.
+func (s *Store[T]) LastSyncResourceVersion() string {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return s.lastSyncResourceVersion
+}
+
+// Resync is meaningless for the store, it is a no-op.
+func (s *Store[T]) Resync() error {
+	return nil
+}
+
+// Watch returns a channel of the changes of the store, which is closed once
+// ctx is done, or by OverflowDisconnect once its buffer is full.
+// Use WithInitialReplay to receive the objects already in the store first.
+func (s *Store[T]) Watch(ctx context.Context, opts ...WatchOption) <-chan Event[T] {
+	o := newWatchOptions(opts...)
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	var replay []Event[T]
+	if o.replay {
+		replay = replayEvents(s.items)
+	}
+	return s.watchers.watch(ctx, o, replay)
+}
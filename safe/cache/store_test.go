@@ -0,0 +1,82 @@
+package cache
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Store(t *testing.T) {
+	s := NewStore(testObjectKeyFunc)
+
+	require.NoError(t, s.Add(testObject{name: "foo", val: 1}))
+	require.NoError(t, s.Add(testObject{name: "bar", val: 2}))
+	require.Error(t, s.Add(testObject{}))
+
+	item, exists, err := s.Get(testObject{name: "foo"})
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, 1, item.val)
+
+	require.NoError(t, s.Update(testObject{name: "foo", val: 10}))
+	item, exists, err = s.GetByKey("foo")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, 10, item.val)
+
+	require.Equal(t, []string{"bar", "foo"}, sortedKeys(s.List(), nameOf))
+	keys := s.ListKeys()
+	sort.Strings(keys)
+	require.Equal(t, []string{"bar", "foo"}, keys)
+
+	require.NoError(t, s.Delete(testObject{name: "foo"}))
+	_, exists, err = s.GetByKey("foo")
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Error(t, s.Delete(testObject{}))
+
+	_, _, err = s.Get(testObject{})
+	require.Error(t, err)
+	require.NoError(t, s.Resync())
+	// Resync does not queue anything.
+	require.Equal(t, []string{"bar"}, s.ListKeys())
+}
+
+func Test_Store_Replace(t *testing.T) {
+	s := NewStore(testObjectKeyFunc)
+
+	require.NoError(t, s.Add(testObject{name: "foo", val: 1}))
+	require.NoError(t, s.Replace([]testObject{
+		{name: "bar", val: 2},
+		{name: "baz", val: 3},
+	}, "1"))
+	require.Equal(t, []string{"bar", "baz"}, sortedKeys(s.List(), nameOf))
+	require.Equal(t, "1", s.LastSyncResourceVersion())
+
+	// the failed replace leaves the store unchanged.
+	require.Error(t, s.Replace([]testObject{{name: "qux"}, {}}, "2"))
+	require.Equal(t, []string{"bar", "baz"}, sortedKeys(s.List(), nameOf))
+	require.Equal(t, "1", s.LastSyncResourceVersion())
+}
+
+func Test_Store_concurrent(t *testing.T) {
+	s := NewStore(testObjectKeyFunc)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Add(testObject{name: strconv.Itoa(j), val: i}) // nolint: errcheck
+				s.List()
+				s.GetByKey(strconv.Itoa(j)) // nolint: errcheck
+			}
+		}(i)
+	}
+	wg.Wait()
+	require.Len(t, s.ListKeys(), 100)
+}
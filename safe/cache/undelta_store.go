@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/clock"
+)
+
+// PushFunc receives the complete contents of an UndeltaStore.
+type PushFunc[T any] func(objs []T)
+
+// UndeltaStore is a Store
+var _ container.Store[int] = (*UndeltaStore[int])(nil)
+
+// UndeltaStore is a thread-safe Store which pushes its complete contents to
+// a PushFunc after every change, for the consumers which only care about the
+// current state, not about the single changes. Add, Update, Delete and
+// Replace push, the read operations and Resync do not.
+//
+// The pushes are serialized and in the order of the changes, the PushFunc is
+// called without the lock, so it may read or change the store. A change made
+// while a push is running is pushed once it returns, together with the other
+// changes made in the meantime. With WithCoalesceWindow, a burst of changes
+// within the window is pushed once, after the window has passed since the
+// first of them. A Delete of an absent key changes nothing, and is not pushed.
+// Call Stop once the store is no longer used.
+type UndeltaStore[T any] struct {
+	store *Store[T]
+
+	// mu serializes the changes, and guards the state of the pushes.
+	mu       sync.Mutex
+	pushFunc PushFunc[T]
+	clock    clock.Clock
+	// window is the coalescing window, zero means no coalescing.
+	window time.Duration
+	// timer of the scheduled coalesced push, nil if none.
+	timer clock.Timer
+	// next is the contents to push if hasNext is true.
+	next    []T
+	hasNext bool
+	// pushing is true while a goroutine is pushing.
+	pushing bool
+	// stopped is true once Stop is called.
+	stopped bool
+}
+
+// NewUndeltaStore returns an UndeltaStore which pushes to pushFunc.
+// keyFunc is used to make the key used for item insertion and retrieval, and should be deterministic.
+// Use WithCoalesceWindow to coalesce the pushes, and WithClock to inject a fake clock in tests.
+func NewUndeltaStore[T any](pushFunc PushFunc[T], keyFunc container.KeyFunc[T], opts ...Option) *UndeltaStore[T] {
+	o := newOptions(opts...)
+	return &UndeltaStore[T]{
+		store:    NewStore(keyFunc),
+		pushFunc: pushFunc,
+		clock:    o.clock,
+		window:   o.coalesceWindow,
+	}
+}
+
+// Add inserts an item into the store, and pushes the contents.
+func (u *UndeltaStore[T]) Add(obj T) error {
+	return u.change(func() (bool, error) { return true, u.store.Add(obj) })
+}
+
+// Update sets an item in the store to its updated state, and pushes the contents.
+func (u *UndeltaStore[T]) Update(obj T) error {
+	return u.Add(obj)
+}
+
+// Delete removes an item from the store, and pushes the contents if it existed.
+func (u *UndeltaStore[T]) Delete(obj T) error {
+	return u.change(func() (bool, error) {
+		// the changes are serialized, so the item can not come and go in between.
+		_, exists, err := u.store.Get(obj)
+		if err != nil || !exists {
+			return false, err
+		}
+		return true, u.store.Delete(obj)
+	})
+}
+
+// Replace will delete the contents of the store, using instead the given list,
+// and records resourceVersion as the last sync resource version, then pushes
+// the contents.
+func (u *UndeltaStore[T]) Replace(list []T, resourceVersion string) error {
+	return u.change(func() (bool, error) { return true, u.store.Replace(list, resourceVersion) })
+}
+
+// List returns a list of all the items.
+func (u *UndeltaStore[T]) List() []T {
+	return u.store.List()
+}
+
+// ListKeys returns a list of all the keys of the objects currently in the store.
+func (u *UndeltaStore[T]) ListKeys() []string {
+	return u.store.ListKeys()
+}
+
+// Get returns the requested item, or sets exists=false.
+func (u *UndeltaStore[T]) Get(obj T) (item T, exists bool, err error) {
+	return u.store.Get(obj)
+}
+
+// GetByKey returns the requested item, or sets exists=false.
+func (u *UndeltaStore[T]) GetByKey(key string) (item T, exists bool, err error) {
+	return u.store.GetByKey(key)
+}
+
+// LastSyncResourceVersion returns the resource version passed to the last Replace.
+func (u *UndeltaStore[T]) LastSyncResourceVersion() string {
+	return u.store.LastSyncResourceVersion()
+}
+
+// Resync is meaningless for the store, it is a no-op.
+func (u *UndeltaStore[T]) Resync() error {
+	return nil
+}
+
+// Watch returns a channel of the changes of the store, see Store.Watch.
+func (u *UndeltaStore[T]) Watch(ctx context.Context, opts ...WatchOption) <-chan Event[T] {
+	return u.store.Watch(ctx, opts...)
+}
+
+// Stop stops the pushes, the scheduled coalesced push is canceled.
+// The store still applies the changes, but does not push them any more.
+func (u *UndeltaStore[T]) Stop() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.stopped = true
+	if u.timer != nil {
+		u.timer.Stop()
+		u.timer = nil
+	}
+	u.next, u.hasNext = nil, false
+}
+
+// change applies fn, and pushes the contents or schedules the push if fn
+// succeeds and reports a change.
+func (u *UndeltaStore[T]) change(fn func() (bool, error)) error {
+	u.mu.Lock()
+	changed, err := fn()
+	if err != nil {
+		u.mu.Unlock()
+		return err
+	}
+	if !changed || u.stopped {
+		u.mu.Unlock()
+		return nil
+	}
+	if u.window > 0 {
+		if u.timer == nil {
+			u.timer = u.clock.AfterFunc(u.window, u.flush)
+		}
+		u.mu.Unlock()
+		return nil
+	}
+	run := u.snapshotLocked()
+	u.mu.Unlock()
+	if run {
+		u.push()
+	}
+	return nil
+}
+
+// flush pushes the contents once the coalescing window has passed.
+func (u *UndeltaStore[T]) flush() {
+	u.mu.Lock()
+	if u.stopped {
+		u.mu.Unlock()
+		return
+	}
+	u.timer = nil
+	run := u.snapshotLocked()
+	u.mu.Unlock()
+	if run {
+		u.push()
+	}
+}
+
+// snapshotLocked takes the contents to push, it returns true if the caller
+// must push them, false if the running push does. The caller must hold the lock.
+func (u *UndeltaStore[T]) snapshotLocked() bool {
+	u.next, u.hasNext = u.store.List(), true
+	if u.pushing {
+		return false
+	}
+	u.pushing = true
+	return true
+}
+
+// push pushes the latest contents until no newer contents are taken.
+// The caller must not hold the lock.
+func (u *UndeltaStore[T]) push() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for u.hasNext {
+		objs := u.next
+		u.next, u.hasNext = nil, false
+		u.pushLocked(objs)
+	}
+	u.pushing = false
+}
+
+// pushLocked calls the PushFunc without the lock. If it panics, the lock is
+// taken back and the push is ended, so the later changes still push.
+// The caller must hold the lock.
+func (u *UndeltaStore[T]) pushLocked(objs []T) {
+	u.mu.Unlock()
+	pushed := false
+	defer func() {
+		u.mu.Lock()
+		if !pushed {
+			u.pushing = false
+		}
+	}()
+	u.pushFunc(objs)
+	pushed = true
+}
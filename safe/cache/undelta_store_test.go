@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/container/clock"
+)
+
+// testPusher records the pushes of an UndeltaStore.
+type testPusher struct {
+	mu     sync.Mutex
+	pushes [][]string
+}
+
+func (p *testPusher) push(objs []testObject) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pushes = append(p.pushes, sortedKeys(objs, nameOf))
+}
+
+func (p *testPusher) get() [][]string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]string(nil), p.pushes...)
+}
+
+func Test_UndeltaStore(t *testing.T) {
+	p := &testPusher{}
+	u := NewUndeltaStore(p.push, testObjectKeyFunc)
+
+	require.NoError(t, u.Add(testObject{name: "a", val: 1}))
+	require.NoError(t, u.Update(testObject{name: "b", val: 1}))
+	require.NoError(t, u.Delete(testObject{name: "a"}))
+	// deleting an absent key changes nothing, and is not pushed.
+	require.NoError(t, u.Delete(testObject{name: "a"}))
+	require.NoError(t, u.Replace([]testObject{{name: "c"}, {name: "d"}}, "1"))
+	require.Error(t, u.Add(testObject{}))
+	require.NoError(t, u.Resync())
+
+	require.Equal(t, [][]string{{"a"}, {"a", "b"}, {"b"}, {"c", "d"}}, p.get())
+	require.Equal(t, "1", u.LastSyncResourceVersion())
+	item, exists, err := u.GetByKey("c")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, "c", item.name)
+}
+
+func Test_UndeltaStore_coalesce(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	p := &testPusher{}
+	u := NewUndeltaStore(p.push, testObjectKeyFunc, WithClock(fakeClock), WithCoalesceWindow(time.Second))
+
+	require.NoError(t, u.Add(testObject{name: "a", val: 1}))
+	require.NoError(t, u.Add(testObject{name: "b", val: 1}))
+	fakeClock.Step(500 * time.Millisecond)
+	require.NoError(t, u.Delete(testObject{name: "a"}))
+	require.Empty(t, p.get())
+
+	// the burst is pushed once, a window after its first change.
+	fakeClock.Step(500 * time.Millisecond)
+	require.Eventually(t, func() bool { return len(p.get()) == 1 }, time.Second, time.Millisecond)
+	require.Equal(t, [][]string{{"b"}}, p.get())
+
+	require.NoError(t, u.Add(testObject{name: "c", val: 1}))
+	fakeClock.Step(time.Second)
+	require.Eventually(t, func() bool { return len(p.get()) == 2 }, time.Second, time.Millisecond)
+	require.Equal(t, []string{"b", "c"}, p.get()[1])
+}
+
+func Test_UndeltaStore_pushFuncUsesStore(t *testing.T) {
+	p := &testPusher{}
+	var u *UndeltaStore[testObject]
+	u = NewUndeltaStore(func(objs []testObject) {
+		p.push(objs)
+		// the push may read and change the store.
+		if _, exists, _ := u.GetByKey("b"); !exists {
+			u.Add(testObject{name: "b", val: 1}) // nolint: errcheck
+		}
+	}, testObjectKeyFunc)
+
+	require.NoError(t, u.Add(testObject{name: "a", val: 1}))
+	require.Equal(t, [][]string{{"a"}, {"a", "b"}}, p.get())
+}
+
+func Test_UndeltaStore_Stop(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	p := &testPusher{}
+	u := NewUndeltaStore(p.push, testObjectKeyFunc, WithClock(fakeClock), WithCoalesceWindow(time.Second))
+
+	require.NoError(t, u.Add(testObject{name: "a", val: 1}))
+	require.True(t, fakeClock.HasWaiters())
+	u.Stop()
+	require.False(t, fakeClock.HasWaiters())
+
+	require.NoError(t, u.Add(testObject{name: "b", val: 1}))
+	fakeClock.Step(time.Second)
+	require.Never(t, func() bool { return len(p.get()) > 0 }, 20*time.Millisecond, time.Millisecond)
+	require.ElementsMatch(t, []string{"a", "b"}, u.ListKeys())
+}
+
+func Test_UndeltaStore_pushFuncPanics(t *testing.T) {
+	p := &testPusher{}
+	u := NewUndeltaStore(func(objs []testObject) {
+		if len(objs) == 1 {
+			panic("boom")
+		}
+		p.push(objs)
+	}, testObjectKeyFunc)
+
+	require.PanicsWithValue(t, "boom", func() { u.Add(testObject{name: "a", val: 1}) }) // nolint: errcheck
+	// the panic ends the push, so the later changes still push.
+	require.NoError(t, u.Add(testObject{name: "b", val: 1}))
+	require.Equal(t, [][]string{{"a", "b"}}, p.get())
+}
@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultWatchBufferSize is the default buffer size of a store watch, besides the replayed events.
+const defaultWatchBufferSize = 100
+
+// EventType defines the possible types of the store events.
+type EventType string
+
+// the types of the store events.
+const (
+	EventAdded   EventType = "ADDED"
+	EventUpdated EventType = "UPDATED"
+	EventDeleted EventType = "DELETED"
+	// EventReplaced means the whole contents of the store are replaced by Replace.
+	EventReplaced EventType = "REPLACED"
+)
+
+// Event is a change of a store, delivered by the Watch of the store.
+type Event[T any] struct {
+	Type EventType
+	// Key of the object, it is not set for EventReplaced.
+	Key string
+	// Old is the state of the object before the change, it is set for
+	// EventUpdated and EventDeleted.
+	Old T
+	// New is the state of the object after the change, it is set for
+	// EventAdded and EventUpdated.
+	New T
+	// OldObjects and Objects are the contents of the store before and after
+	// the change, they are set for EventReplaced.
+	OldObjects []T
+	Objects    []T
+	// ResourceVersion passed to Replace, it is set for EventReplaced.
+	ResourceVersion string
+}
+
+// OverflowPolicy decides what to do with a watcher whose buffer is full,
+// because it does not keep up with the changes of the store.
+type OverflowPolicy int
+
+// the overflow policies.
+const (
+	// OverflowDisconnect closes the channel of the watcher, so it can start
+	// over with a new watch, replaying the state of the store.
+	OverflowDisconnect OverflowPolicy = iota
+	// OverflowBlock blocks the writers of the store until the watcher
+	// receives the event, or its ctx is done. The watcher must not wait on
+	// the writers of the store while it is receiving the events.
+	OverflowBlock
+	// OverflowDrop drops the event, the watcher misses the change.
+	OverflowDrop
+)
+
+// watchOptions of a store watch.
+type watchOptions struct {
+	bufferSize int
+	policy     OverflowPolicy
+	replay     bool
+}
+
+// WatchOption for the Watch of a store.
+type WatchOption func(*watchOptions)
+
+// WithWatchBufferSize set the number of the events buffered for a watcher,
+// besides the replayed events, default 100.
+func WithWatchBufferSize(n int) WatchOption {
+	return func(o *watchOptions) {
+		o.bufferSize = max(n, 0)
+	}
+}
+
+// WithOverflowPolicy set what to do once the buffer of a watcher is full,
+// default OverflowDisconnect.
+func WithOverflowPolicy(p OverflowPolicy) WatchOption {
+	return func(o *watchOptions) {
+		o.policy = p
+	}
+}
+
+// WithInitialReplay starts the watch with an EventAdded of every object in
+// the store, ordered by key, before the changes.
+func WithInitialReplay() WatchOption {
+	return func(o *watchOptions) {
+		o.replay = true
+	}
+}
+
+func newWatchOptions(opts ...WatchOption) *watchOptions {
+	o := &watchOptions{
+		bufferSize: defaultWatchBufferSize,
+		policy:     OverflowDisconnect,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// broadcaster delivers the events of a store to its watchers. The store
+// calls notify under its write lock, which keeps the events in the order
+// of the changes, and watch under its read lock, so the replayed state
+// and the changes do not overlap. The zero value is ready to use.
+type broadcaster[T any] struct {
+	mu       sync.Mutex
+	watchers map[*storeWatcher[T]]struct{}
+	// n is the number of the watchers, it is checked without mu.
+	n atomic.Int64
+}
+
+// storeWatcher is a watcher of a store.
+type storeWatcher[T any] struct {
+	ch     chan Event[T]
+	policy OverflowPolicy
+	// done is closed once ctx of the watch is done.
+	done chan struct{}
+	// stop stops the watch of ctx.
+	stop func() bool
+}
+
+// watch registers a watcher, replay is sent before the changes.
+// The caller must hold the read lock of the store.
+func (b *broadcaster[T]) watch(ctx context.Context, o *watchOptions, replay []Event[T]) <-chan Event[T] {
+	w := &storeWatcher[T]{
+		ch:     make(chan Event[T], len(replay)+o.bufferSize),
+		policy: o.policy,
+		done:   make(chan struct{}),
+	}
+	for _, ev := range replay {
+		w.ch <- ev
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.watchers == nil {
+		b.watchers = map[*storeWatcher[T]]struct{}{}
+	}
+	b.watchers[w] = struct{}{}
+	b.n.Add(1)
+	w.stop = context.AfterFunc(ctx, func() {
+		// unblock a send first, which holds mu.
+		close(w.done)
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, exists := b.watchers[w]; exists {
+			b.removeLocked(w)
+		}
+	})
+	return w.ch
+}
+
+// watching returns true if there is any watcher. The store uses it to skip
+// building the costly events, it must hold its write lock.
+func (b *broadcaster[T]) watching() bool {
+	return b.n.Load() > 0
+}
+
+// notify sends the events to the watchers, and calls unlock to release the
+// write lock of the store once it takes over the order of the events.
+func (b *broadcaster[T]) notify(unlock func(), events ...Event[T]) {
+	if len(events) == 0 || !b.watching() {
+		unlock()
+		return
+	}
+	b.mu.Lock()
+	unlock()
+	defer b.mu.Unlock()
+	for w := range b.watchers {
+		for _, ev := range events {
+			if !b.sendLocked(w, ev) {
+				break
+			}
+		}
+	}
+}
+
+// sendLocked sends ev to w by its overflow policy, it returns false if w is
+// gone. The caller must hold mu.
+func (b *broadcaster[T]) sendLocked(w *storeWatcher[T], ev Event[T]) bool {
+	select {
+	case <-w.done:
+		return false
+	default:
+	}
+	switch w.policy {
+	case OverflowBlock:
+		select {
+		case w.ch <- ev:
+		case <-w.done:
+			return false
+		}
+	case OverflowDrop:
+		select {
+		case w.ch <- ev:
+		default:
+		}
+	default:
+		select {
+		case w.ch <- ev:
+		default:
+			b.removeLocked(w)
+			return false
+		}
+	}
+	return true
+}
+
+// removeLocked removes w and closes its channel. The caller must hold mu.
+func (b *broadcaster[T]) removeLocked(w *storeWatcher[T]) {
+	delete(b.watchers, w)
+	b.n.Add(-1)
+	w.stop()
+	close(w.ch)
+}
+
+// setEvent returns the event of setting key to obj, which is an
+// EventUpdated of old if exists, otherwise an EventAdded.
+func setEvent[T any](key string, old T, exists bool, obj T) Event[T] {
+	if exists {
+		return Event[T]{Type: EventUpdated, Key: key, Old: old, New: obj}
+	}
+	return Event[T]{Type: EventAdded, Key: key, New: obj}
+}
+
+// replayEvents returns an EventAdded of every item, ordered by key.
+func replayEvents[T any](items map[string]T) []Event[T] {
+	keys := mapKeys(items)
+	sort.Strings(keys)
+	events := make([]Event[T], 0, len(keys))
+	for _, key := range keys {
+		events = append(events, Event[T]{Type: EventAdded, Key: key, New: items[key]})
+	}
+	return events
+}
@@ -0,0 +1,227 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/container/clock"
+)
+
+// nextEvent receives the next event of ch, it fails if there is none.
+func nextEvent[T any](t *testing.T, ch <-chan Event[T]) Event[T] {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		require.True(t, ok, "the watch is closed")
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return Event[T]{}
+	}
+}
+
+// requireClosed requires ch to be closed once it is drained.
+func requireClosed[T any](t *testing.T, ch <-chan Event[T]) {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("the watch is not closed")
+		}
+	}
+}
+
+func Test_Store_Watch(t *testing.T) {
+	s := NewStore(testObjectKeyFunc)
+	require.NoError(t, s.Add(testObject{name: "b", val: 1}))
+	require.NoError(t, s.Add(testObject{name: "a", val: 1}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := s.Watch(ctx, WithInitialReplay())
+	ev := nextEvent(t, ch)
+	require.Equal(t, EventAdded, ev.Type)
+	require.Equal(t, "a", ev.Key)
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventAdded, ev.Type)
+	require.Equal(t, "b", ev.Key)
+
+	require.NoError(t, s.Add(testObject{name: "c", val: 1}))
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventAdded, ev.Type)
+	require.Equal(t, 1, ev.New.val)
+
+	require.NoError(t, s.Update(testObject{name: "c", val: 2}))
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventUpdated, ev.Type)
+	require.Equal(t, 1, ev.Old.val)
+	require.Equal(t, 2, ev.New.val)
+
+	require.NoError(t, s.Delete(testObject{name: "c"}))
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventDeleted, ev.Type)
+	require.Equal(t, 2, ev.Old.val)
+	// deleting an absent object changes nothing.
+	require.NoError(t, s.Delete(testObject{name: "c"}))
+
+	require.NoError(t, s.Replace([]testObject{{name: "d", val: 1}}, "3"))
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventReplaced, ev.Type)
+	require.Equal(t, []string{"a", "b"}, sortedKeys(ev.OldObjects, nameOf))
+	require.Equal(t, []string{"d"}, sortedKeys(ev.Objects, nameOf))
+	require.Equal(t, "3", ev.ResourceVersion)
+
+	cancel()
+	requireClosed(t, ch)
+	require.NoError(t, s.Add(testObject{name: "e", val: 1}))
+}
+
+func Test_Indexer_Watch(t *testing.T) {
+	c := newTestIndexer()
+	ch := c.Watch(context.Background())
+
+	require.NoError(t, c.Add(testObject{name: "a", tenant: "t1", val: 1}))
+	ev := nextEvent(t, ch)
+	require.Equal(t, EventAdded, ev.Type)
+	require.Equal(t, "a", ev.Key)
+
+	require.NoError(t, c.Update(testObject{name: "a", tenant: "t2", val: 2}))
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventUpdated, ev.Type)
+	require.Equal(t, "t1", ev.Old.tenant)
+	require.Equal(t, "t2", ev.New.tenant)
+
+	require.NoError(t, c.Delete(testObject{name: "a"}))
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventDeleted, ev.Type)
+
+	require.NoError(t, c.Replace([]testObject{{name: "b", tenant: "t1"}}, "1"))
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventReplaced, ev.Type)
+	require.Empty(t, ev.OldObjects)
+	require.Equal(t, []string{"b"}, sortedKeys(ev.Objects, nameOf))
+}
+
+func Test_ExpiringStore_Watch(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	s := NewExpiringStore(testObjectKeyFunc, FixedTTL[testObject](time.Minute), WithClock(fakeClock))
+	require.NoError(t, s.Add(testObject{name: "a", val: 1}))
+	fakeClock.Step(30 * time.Second)
+	require.NoError(t, s.Add(testObject{name: "b", val: 1}))
+	fakeClock.Step(30 * time.Second)
+
+	// the expired object is not replayed.
+	ch := s.Watch(context.Background(), WithInitialReplay())
+	ev := nextEvent(t, ch)
+	require.Equal(t, EventAdded, ev.Type)
+	require.Equal(t, "b", ev.Key)
+
+	// the expired object is deleted before it is added again.
+	require.NoError(t, s.Add(testObject{name: "a", val: 2}))
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventDeleted, ev.Type)
+	require.Equal(t, 1, ev.Old.val)
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventAdded, ev.Type)
+	require.Equal(t, 2, ev.New.val)
+
+	fakeClock.Step(30 * time.Second)
+	require.Equal(t, 1, s.RemoveExpired())
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventDeleted, ev.Type)
+	require.Equal(t, "b", ev.Key)
+
+	fakeClock.Step(time.Minute)
+	_, exists, err := s.GetByKey("a")
+	require.NoError(t, err)
+	require.False(t, exists)
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventDeleted, ev.Type)
+	require.Equal(t, "a", ev.Key)
+}
+
+func Test_ExpiringStore_WatchExpiredDeleteReplace(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	s := NewExpiringStore(testObjectKeyFunc, FixedTTL[testObject](time.Minute), WithClock(fakeClock))
+	require.NoError(t, s.Add(testObject{name: "a", val: 1}))
+	require.NoError(t, s.Add(testObject{name: "b", val: 1}))
+	fakeClock.Step(30 * time.Second)
+	require.NoError(t, s.Add(testObject{name: "c", val: 1}))
+	fakeClock.Step(30 * time.Second)
+	ch := s.Watch(context.Background())
+
+	// the Delete of an expired object sweeps it with a single EventDeleted.
+	require.NoError(t, s.Delete(testObject{name: "a"}))
+	ev := nextEvent(t, ch)
+	require.Equal(t, EventDeleted, ev.Type)
+	require.Equal(t, "a", ev.Key)
+	_, exists, err := s.GetByKey("a")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// no second EventDeleted of a, Replace sweeps the expired objects, and leaves them out of OldObjects.
+	require.NoError(t, s.Replace([]testObject{{name: "d", val: 1}}, "1"))
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventDeleted, ev.Type)
+	require.Equal(t, "b", ev.Key)
+	ev = nextEvent(t, ch)
+	require.Equal(t, EventReplaced, ev.Type)
+	require.Equal(t, []string{"c"}, sortedKeys(ev.OldObjects, nameOf))
+	require.Equal(t, []string{"d"}, sortedKeys(ev.Objects, nameOf))
+}
+
+func Test_Watch_OverflowPolicy(t *testing.T) {
+	s := NewStore(testObjectKeyFunc)
+	disconnected := s.Watch(context.Background(), WithWatchBufferSize(1))
+	dropped := s.Watch(context.Background(), WithWatchBufferSize(1), WithOverflowPolicy(OverflowDrop))
+	blockCtx, cancel := context.WithCancel(context.Background())
+	blocked := s.Watch(blockCtx, WithWatchBufferSize(1), WithOverflowPolicy(OverflowBlock))
+
+	require.NoError(t, s.Add(testObject{name: "a", val: 1}))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Add(testObject{name: "b", val: 1}) // nolint: errcheck
+		s.Add(testObject{name: "c", val: 1}) // nolint: errcheck
+	}()
+
+	// the blocked watcher receives every event, the writer waits for it.
+	require.Equal(t, "a", nextEvent(t, blocked).Key)
+	require.Equal(t, "b", nextEvent(t, blocked).Key)
+	require.Equal(t, "c", nextEvent(t, blocked).Key)
+	<-done
+
+	// the disconnected watcher is closed once its buffer is full.
+	require.Equal(t, "a", nextEvent(t, disconnected).Key)
+	requireClosed(t, disconnected)
+
+	// the dropping watcher misses the events once its buffer is full.
+	require.Equal(t, "a", nextEvent(t, dropped).Key)
+	select {
+	case ev := <-dropped:
+		t.Fatalf("unexpected event %+v", ev)
+	default:
+	}
+
+	// canceling ctx unblocks the writer.
+	require.NoError(t, s.Add(testObject{name: "d", val: 1}))
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Add(testObject{name: "e", val: 1}) // nolint: errcheck
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the writer is still blocked after ctx is done")
+	}
+	requireClosed(t, blocked)
+}
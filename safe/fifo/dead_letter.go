@@ -0,0 +1,229 @@
+package fifo
+
+import (
+	"errors"
+
+	"github.com/things-go/container"
+)
+
+// ErrDeadLetterNotFound used when the dead-lettered item of a key does not exist.
+var ErrDeadLetterNotFound = errors.New("fifo: dead letter not found")
+
+// DeadLetter is an item which is moved out of the queue after it has been
+// requeued too many times, see WithMaxRequeues.
+type DeadLetter[T any] struct {
+	// Key of the item.
+	Key string
+	// Obj is the item.
+	Obj T
+	// Err is the error of the last attempt to process the item.
+	Err error
+	// Attempts is the number of the failed attempts to process the item.
+	Attempts int
+}
+
+// DeadLetterKeyFunc is the KeyFunc of the DeadLetters, the key of the item.
+// It is used to create a Store for WithDeadLetterStore.
+func DeadLetterKeyFunc[T any](d DeadLetter[T]) (string, error) {
+	return d.Key, nil
+}
+
+// Requeue adds back an item which failed to be processed outside of Pop, such
+// as by Run, with the error of the attempt. Like an ErrRequeue returned to
+// Pop, it counts against WithMaxRequeues, and the item is dead-lettered once
+// it is past the limit. The item is not added if its key is already queued.
+// It returns ErrFIFOClosed if the queue is closed, it is accepted while
+// ShutDownWithDrain is draining the queue.
+func (f *FIFO[T]) Requeue(obj T, err error) error {
+	key, keyErr := f.keyFunc(obj)
+	if keyErr != nil {
+		return container.KeyError[T]{Obj: obj, Err: keyErr}
+	}
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.releaseLocked(key)
+	if f.closed {
+		return ErrFIFOClosed
+	}
+	return f.requeueLocked(key, obj, err)
+}
+
+// Forget stops counting the requeues of the item, it should be called once an
+// item popped outside of Pop, such as by Run, is processed successfully.
+func (f *FIFO[T]) Forget(obj T) {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return
+	}
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.releaseLocked(key)
+	delete(f.requeues, key)
+}
+
+// releaseLocked ends the flight of an item of key popped by Run, if any.
+// The caller must hold the lock.
+func (f *FIFO[T]) releaseLocked(key string) {
+	n, ok := f.inFlight[key]
+	if !ok {
+		return
+	}
+	f.metrics.done(key)
+	if n > 1 {
+		f.inFlight[key] = n - 1
+		return
+	}
+	delete(f.inFlight, key)
+	if f.draining {
+		// wake up ShutDownWithDrain.
+		f.cond.Broadcast()
+	}
+}
+
+// DeadLetters returns a list of all the dead-lettered items.
+func (f *FIFO[T]) DeadLetters() []DeadLetter[T] {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return f.deadLetters.List()
+}
+
+// GetDeadLetter returns the dead-lettered item of key, or sets exists=false.
+func (f *FIFO[T]) GetDeadLetter(key string) (d DeadLetter[T], exists bool, err error) {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return f.deadLetters.GetByKey(key)
+}
+
+// RedriveDeadLetter moves the dead-lettered item of key back to the end of the
+// queue, with its requeues counted from zero. The item is dropped if its key
+// has been queued again since. If the key is leased, the item is queued once
+// the lease ends, unless the key is added during the lease. It returns ErrDeadLetterNotFound if there is no
+// such item, or ErrFIFOClosed once ShutDownWithDrain is called.
+func (f *FIFO[T]) RedriveDeadLetter(key string) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if f.draining {
+		return ErrFIFOClosed
+	}
+	d, exists, err := f.deadLetters.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrDeadLetterNotFound
+	}
+	// a leased key is redriven once the lease ends, like AddIfNotPresent.
+	if !f.deferLeasedLocked(key, d.Obj, false) {
+		if err = f.addIfNotPresent(key, d.Obj); err != nil {
+			return err
+		}
+	}
+	delete(f.requeues, key)
+	return f.deadLetters.Delete(d)
+}
+
+// PurgeDeadLetter drops the dead-lettered item of key, it returns
+// ErrDeadLetterNotFound if there is no such item.
+func (f *FIFO[T]) PurgeDeadLetter(key string) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	d, exists, err := f.deadLetters.GetByKey(key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrDeadLetterNotFound
+	}
+	return f.deadLetters.Delete(d)
+}
+
+// PurgeDeadLetters drops all the dead-lettered items.
+func (f *FIFO[T]) PurgeDeadLetters() error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	return f.deadLetters.Replace(nil, "")
+}
+
+// requeueLocked adds back a popped item which failed with err, or moves it
+// to the dead letters once it is requeued more than the max requeues.
+// The caller must hold the lock.
+func (f *FIFO[T]) requeueLocked(key string, obj T, err error) error {
+	if f.maxRequeues >= 0 {
+		attempts := f.requeues[key] + 1
+		if attempts > f.maxRequeues {
+			dlErr := f.deadLetters.Add(DeadLetter[T]{Key: key, Obj: obj, Err: err, Attempts: attempts})
+			if dlErr == nil {
+				delete(f.requeues, key)
+				return nil
+			}
+			// keep the item in the queue rather than losing it.
+			if addErr := f.addIfNotPresent(key, obj); addErr != nil {
+				return addErr
+			}
+			return dlErr
+		}
+		f.requeues[key] = attempts
+	}
+	f.metrics.retry()
+	return f.addIfNotPresent(key, obj)
+}
+
+// deadLetterStore is the default Store of the dead letters, it is not
+// thread-safe, the FIFO calls it under its lock.
+type deadLetterStore[T any] struct {
+	items map[string]DeadLetter[T]
+}
+
+// deadLetterStore is a Store
+var _ container.Store[DeadLetter[int]] = (*deadLetterStore[int])(nil)
+
+func newDeadLetterStore[T any]() *deadLetterStore[T] {
+	return &deadLetterStore[T]{items: map[string]DeadLetter[T]{}}
+}
+
+func (s *deadLetterStore[T]) Add(d DeadLetter[T]) error {
+	s.items[d.Key] = d
+	return nil
+}
+
+func (s *deadLetterStore[T]) Update(d DeadLetter[T]) error {
+	return s.Add(d)
+}
+
+func (s *deadLetterStore[T]) Delete(d DeadLetter[T]) error {
+	delete(s.items, d.Key)
+	return nil
+}
+
+func (s *deadLetterStore[T]) List() []DeadLetter[T] {
+	r := make([]DeadLetter[T], 0, len(s.items))
+	for _, d := range s.items {
+		r = append(r, d)
+	}
+	return r
+}
+
+func (s *deadLetterStore[T]) ListKeys() []string {
+	return mapKeys(s.items)
+}
+
+func (s *deadLetterStore[T]) Get(d DeadLetter[T]) (DeadLetter[T], bool, error) {
+	return s.GetByKey(d.Key)
+}
+
+func (s *deadLetterStore[T]) GetByKey(key string) (DeadLetter[T], bool, error) {
+	d, exists := s.items[key]
+	return d, exists, nil
+}
+
+func (s *deadLetterStore[T]) Replace(list []DeadLetter[T], _ string) error {
+	s.items = make(map[string]DeadLetter[T], len(list))
+	for _, d := range list {
+		s.items[d.Key] = d
+	}
+	return nil
+}
+
+func (s *deadLetterStore[T]) Resync() error {
+	return nil
+}
@@ -0,0 +1,189 @@
+package fifo
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_FIFO_deadLetter(t *testing.T) {
+	f := New(testFifoObjectKeyFunc, WithMaxRequeues[testFifoObject](2))
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+	f.Add(mkFifoObj("bar", 2)) // nolint: errcheck
+
+	failed := errors.New("failed")
+	var attempts int
+	for {
+		obj, err := f.TryPop(func(obj testFifoObject) error {
+			if obj.name == "foo" {
+				attempts++
+				return ErrRequeue{Err: failed}
+			}
+			return nil
+		})
+		if err == ErrFIFOEmpty {
+			break
+		}
+		if obj.name == "foo" && err != failed {
+			t.Errorf("expected %v, got %v", failed, err)
+		}
+	}
+	if e, a := 3, attempts; e != a {
+		t.Errorf("expected %v attempts, got %v", e, a)
+	}
+
+	dls := f.DeadLetters()
+	if len(dls) != 1 {
+		t.Fatalf("expected 1 dead letter, got %v", dls)
+	}
+	d, exists, err := f.GetDeadLetter("foo")
+	if err != nil || !exists {
+		t.Fatalf("expected the dead letter of foo, got %v, %v", exists, err)
+	}
+	if d.Obj.val != 1 || d.Err != failed || d.Attempts != 3 {
+		t.Errorf("unexpected dead letter %+v", d)
+	}
+
+	// the redriven item is queued again, with its requeues counted from zero.
+	if err = f.RedriveDeadLetter("foo"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, exists, _ = f.GetDeadLetter("foo"); exists {
+		t.Errorf("expected the dead letter to be redriven")
+	}
+	attempts = 0
+	for {
+		if _, err = f.TryPop(func(testFifoObject) error {
+			attempts++
+			return ErrRequeue{Err: failed}
+		}); err == ErrFIFOEmpty {
+			break
+		}
+	}
+	if e, a := 3, attempts; e != a {
+		t.Errorf("expected %v attempts after redrive, got %v", e, a)
+	}
+
+	if err = f.RedriveDeadLetter("bar"); err != ErrDeadLetterNotFound {
+		t.Errorf("expected %v, got %v", ErrDeadLetterNotFound, err)
+	}
+	if err = f.PurgeDeadLetter("foo"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = f.PurgeDeadLetter("foo"); err != ErrDeadLetterNotFound {
+		t.Errorf("expected %v, got %v", ErrDeadLetterNotFound, err)
+	}
+}
+
+func Test_FIFO_deadLetterRedriveLeased(t *testing.T) {
+	f := New(testFifoObjectKeyFunc, WithMaxRequeues[testFifoObject](0))
+	f.Add(mkFifoObj("foo", 1))                                // nolint: errcheck
+	f.Pop(func(testFifoObject) error { return ErrRequeue{} }) // nolint: errcheck
+	f.Add(mkFifoObj("foo", 2))                                // nolint: errcheck
+	_, id, err := f.Lease(time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// the redrive of a leased key waits for the lease to end.
+	if err = f.RedriveDeadLetter("foo"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, exists, _ := f.GetByKey("foo"); exists {
+		t.Errorf("expected the redrive to be deferred while foo is leased")
+	}
+	f.Ack(id) // nolint: errcheck
+	if obj, exists, _ := f.GetByKey("foo"); !exists || obj.val != 1 {
+		t.Errorf("expected the redriven foo 1 after Ack, got %v, %v", obj, exists)
+	}
+}
+
+func Test_FIFO_deadLetterResetOnSuccess(t *testing.T) {
+	f := New(testFifoObjectKeyFunc, WithMaxRequeues[testFifoObject](1))
+	fail := func(testFifoObject) error { return ErrRequeue{} }
+
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+	f.Pop(fail)                // nolint: errcheck
+	f.Pop(nil)                 // nolint: errcheck
+	// the count starts over after the success.
+	f.Add(mkFifoObj("foo", 2)) // nolint: errcheck
+	f.Pop(fail)                // nolint: errcheck
+	if _, exists, _ := f.Get(mkFifoObj("foo", 2)); !exists {
+		t.Errorf("expected foo to be requeued")
+	}
+	f.Pop(fail) // nolint: errcheck
+	if _, exists, _ := f.Get(mkFifoObj("foo", 2)); exists {
+		t.Errorf("expected foo to be dead-lettered")
+	}
+
+	f.Add(mkFifoObj("bar", 1))                                                           // nolint: errcheck
+	f.Add(mkFifoObj("baz", 1))                                                           // nolint: errcheck
+	f.PopBatch(0, func([]testFifoObject) error { return ErrRequeue{Indexes: []int{1}} }) // nolint: errcheck
+	f.PopBatch(0, func([]testFifoObject) error { return ErrRequeue{} })                  // nolint: errcheck
+	if e, a := 2, len(f.DeadLetters()); e != a {
+		t.Errorf("expected %v dead letters, got %v", e, a)
+	}
+	if err := f.PurgeDeadLetters(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if dls := f.DeadLetters(); len(dls) != 0 {
+		t.Errorf("expected no dead letter, got %v", dls)
+	}
+}
+
+// testDeadLetterStore counts the dead letters added to it.
+type testDeadLetterStore struct {
+	*deadLetterStore[testFifoObject]
+	adds int
+}
+
+func (s *testDeadLetterStore) Add(d DeadLetter[testFifoObject]) error {
+	s.adds++
+	return s.deadLetterStore.Add(d)
+}
+
+func Test_FIFO_deadLetterStoreAndRun(t *testing.T) {
+	store := &testDeadLetterStore{deadLetterStore: newDeadLetterStore[testFifoObject]()}
+	f := New(testFifoObjectKeyFunc, WithMaxRequeues[testFifoObject](2), WithDeadLetterStore[testFifoObject](store))
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+
+	var attempts atomic.Int64
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, Queue[testFifoObject](f), 2, func(context.Context, testFifoObject) error {
+			attempts.Add(1)
+			return ErrRequeue{Err: errors.New("failed")}
+		})
+	}()
+	waitFor(t, func() bool { return len(f.DeadLetters()) == 1 })
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after ctx is done")
+	}
+	if e, a := int64(3), attempts.Load(); e != a {
+		t.Errorf("expected %v attempts, got %v", e, a)
+	}
+	if e, a := 1, store.adds; e != a {
+		t.Errorf("expected %v adds to the store, got %v", e, a)
+	}
+}
+
+func Test_FIFO_deadLetterNegativeMaxRequeues(t *testing.T) {
+	// a negative limit means unlimited, like the default.
+	f := New(testFifoObjectKeyFunc, WithMaxRequeues[testFifoObject](-1))
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+	for i := 0; i < 3; i++ {
+		f.Pop(func(testFifoObject) error { return ErrRequeue{} }) // nolint: errcheck
+	}
+	if _, exists, _ := f.GetByKey("foo"); !exists {
+		t.Errorf("expected foo to be requeued")
+	}
+	if a := f.DeadLetters(); len(a) != 0 {
+		t.Errorf("expected no dead letters, got %v", a)
+	}
+}
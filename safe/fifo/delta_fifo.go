@@ -0,0 +1,695 @@
+package fifo
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/comparator"
+	"github.com/things-go/container/go/list"
+)
+
+// DeltaType is the type of a change (addition, deletion, etc)
+type DeltaType string
+
+// Change type definition
+const (
+	Added   DeltaType = "Added"
+	Updated DeltaType = "Updated"
+	Deleted DeltaType = "Deleted"
+	// Replaced is emitted when we encountered watch errors and had to do a
+	// relist. We don't know if the replaced object has changed.
+	Replaced DeltaType = "Replaced"
+	// Sync is for synthetic events during a periodic resync.
+	Sync DeltaType = "Sync"
+)
+
+// Delta is a member of Deltas (a list of Delta objects) which
+// in its turn is the type stored by a DeltaFIFO. It tells you what
+// change happened, and the object's state after that change.
+//
+// [*] Unless the change is a deletion, and then you'll get the final
+// state of the object before it was deleted.
+type Delta[T any] struct {
+	Type   DeltaType
+	Object T
+	// DeletedFinalStateUnknown is set if an object was deleted but the
+	// watch deletion event was missed while disconnected. In this case
+	// Object is the last known state, which may be stale.
+	DeletedFinalStateUnknown bool
+}
+
+// Deltas is a list of one or more 'Delta's to an individual object.
+// The oldest delta is at index 0, the newest delta is the last one.
+type Deltas[T any] []Delta[T]
+
+// Oldest is a convenience function that returns the oldest delta, or
+// false if there are no deltas.
+func (d Deltas[T]) Oldest() (Delta[T], bool) {
+	if len(d) > 0 {
+		return d[0], true
+	}
+	return Delta[T]{}, false
+}
+
+// Newest is a convenience function that returns the newest delta, or
+// false if there are no deltas.
+func (d Deltas[T]) Newest() (Delta[T], bool) {
+	if n := len(d); n > 0 {
+		return d[n-1], true
+	}
+	return Delta[T]{}, false
+}
+
+// copyDeltas returns a shallow copy of d; that is, it copies the slice but not
+// the objects in the slice. This allows Get/List to return an object that we
+// know won't be clobbered by a subsequent modifications.
+func copyDeltas[T any](d Deltas[T]) Deltas[T] {
+	d2 := make(Deltas[T], len(d))
+	copy(d2, d)
+	return d2
+}
+
+// KeyListerGetter is anything that knows how to list its keys and look up by key.
+// A DeltaFIFO uses it to find out which objects it should consider as existing
+// when Replace or Resync is called.
+type KeyListerGetter[T any] interface {
+	// ListKeys returns a list of all the keys of the object
+	ListKeys() []string
+	// GetByKey returns the object associated with the given key
+	GetByKey(key string) (item T, exists bool, err error)
+}
+
+// ErrZeroLengthDeltasObject is returned in a KeyError if a Deltas
+// object with zero length is encountered (should be impossible,
+// but included for completeness).
+var ErrZeroLengthDeltasObject = errors.New("0 length Deltas object; can't get key")
+
+// DeltaFIFO is a Queue
+var _ Queue[int] = (*DeltaFIFO[int])(nil)
+
+// DeltaFIFO is like FIFO, but differs in two ways. One is that the
+// accumulator associated with a given object's key is not that object
+// but rather a Deltas, which is a slice of Delta values for that
+// object. Applying an object to a Deltas means to append a Delta
+// except when the potentially appended Delta is a Deleted and the
+// Deltas already ends with a Deleted. In that case the Deltas does
+// not grow, although the terminal Deleted will be replaced by the new
+// Deleted if the older Deleted's object is a DeletedFinalStateUnknown.
+//
+// The other difference is that DeltaFIFO has two additional ways that
+// an object can be applied to an accumulator: Replaced and Sync.
+// If Replace is called, Replaced deltas are added for every object in
+// the given list, and Deleted deltas are added for every known object
+// that is not in that list. Resync adds Sync deltas for every object
+// known to knownObjects that is not already queued.
+//
+// DeltaFIFO implements the Queue interface over T. The Store methods
+// (List, Get, ...) and Pop work with the newest object of each Deltas,
+// PopDeltas and the *Deltas methods give access to the full change
+// history.
+//
+// DeltaFIFO solves this use case:
+//   - You want to process every object change (delta) at most once.
+//   - When you process an object, you want to see everything
+//     that's happened to it since you last processed it.
+//   - You want to process the deletion of some of the objects.
+//   - You might want to periodically reprocess objects.
+type DeltaFIFO[T any] struct {
+	rw   sync.RWMutex
+	cond sync.Cond
+
+	// `items` maps a key to a Deltas.
+	// Each such Deltas has at least one Delta.
+	items map[string]Deltas[T]
+
+	// `queue` maintains FIFO order of keys for consumption in Pop().
+	// There are no duplicates in `queue`.
+	// A key is in `queue` if and only if it is in `items`.
+	// It is a list, so a popped key does not linger in a backing array.
+	queue *list.List[string]
+
+	// populated is true if the first batch of items inserted by Replace() has been populated
+	// or Delete/Add/Update/AddIfNotPresent was called first.
+	populated bool
+	// initialPopulationCount is the number of items inserted by the first call of Replace()
+	initialPopulationCount int
+
+	// keyFunc is used to make the key used for queued item insertion and retrieval, and
+	// should be deterministic.
+	keyFunc container.KeyFunc[T]
+
+	// knownObjects list keys that are "known" --- affecting Delete(),
+	// Replace(), and Resync()
+	knownObjects KeyListerGetter[T]
+	// compare is used to order the keys queued by Replace(), default by key.
+	compare comparator.Comparable[T]
+	// lastSyncResourceVersion is the resource version passed to the last Replace().
+	lastSyncResourceVersion string
+	// metrics of the queue, nil if no MetricsProvider is set.
+	metrics *queueMetrics
+
+	// Used to indicate a queue is closed so a control loop can exit when a queue is empty.
+	// Currently, not used to gate any of CRUD operations.
+	closed bool
+}
+
+// NewDeltaFIFO returns a Queue which can be used to process changes to items.
+// keyFunc is used to figure out what key an object should have, and should be deterministic.
+func NewDeltaFIFO[T any](keyFunc container.KeyFunc[T], opts ...Option[T]) *DeltaFIFO[T] {
+	o := newOptions(opts...)
+	f := &DeltaFIFO[T]{
+		items:        map[string]Deltas[T]{},
+		queue:        list.New[string](),
+		keyFunc:      keyFunc,
+		knownObjects: o.knownObjects,
+		compare:      o.compare,
+		metrics:      newQueueMetrics(o.metricsName, o.metricsProvider, o.clock),
+	}
+	f.cond.L = &f.rw
+	return f
+}
+
+// Close the queue.
+func (f *DeltaFIFO[T]) Close() {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.closed = true
+	f.metrics.stop()
+	f.cond.Broadcast()
+}
+
+// IsClosed checks if the queue is closed.
+func (f *DeltaFIFO[T]) IsClosed() bool {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return f.closed
+}
+
+// HasSynced returns true if an Add/Update/Delete/AddIfNotPresent are called first,
+// or the first batch of items inserted by Replace() has been popped.
+func (f *DeltaFIFO[T]) HasSynced() bool {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	return f.populated && f.initialPopulationCount == 0
+}
+
+// Add inserts an item, and puts it in the queue. The item is only enqueued
+// if it doesn't already exist in the set.
+func (f *DeltaFIFO[T]) Add(obj T) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.populated = true
+	return f.queueActionLocked(Added, obj)
+}
+
+// Update is just like Add, but makes an Updated Delta.
+func (f *DeltaFIFO[T]) Update(obj T) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.populated = true
+	return f.queueActionLocked(Updated, obj)
+}
+
+// Delete is just like Add, but makes a Deleted Delta. If the given
+// object does not already exist, it will be ignored. (It may have
+// already been deleted by a Replace (re-list), for example.)  In this
+// method `f.knownObjects`, if not nil, provides (via GetByKey)
+// _additional_ objects that are considered to already exist.
+func (f *DeltaFIFO[T]) Delete(obj T) error {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.populated = true
+	if f.knownObjects == nil {
+		if _, exists := f.items[key]; !exists {
+			// Presumably, this was deleted when a relist happened.
+			// Don't provide a second report of the same deletion.
+			return nil
+		}
+	} else {
+		// We only want to skip the "deletion" action if the object doesn't
+		// exist in knownObjects and it doesn't have corresponding item in items.
+		// Note that even if there is a "deletion" action in items, we can ignore it,
+		// because it will be deduped automatically in "queueActionLocked"
+		_, exists, err := f.knownObjects.GetByKey(key)
+		_, itemsExist := f.items[key]
+		if err == nil && !exists && !itemsExist {
+			// Presumably, this was deleted when a relist happened.
+			// Don't provide a second report of the same deletion.
+			return nil
+		}
+	}
+
+	// exist in items and/or KnownObjects
+	return f.queueActionLocked(Deleted, obj)
+}
+
+// AddIfNotPresent inserts an item, and puts it in the queue. If the item is already
+// present in the set, it is neither enqueued nor added to the set.
+//
+// This is useful in a single producer/consumer scenario so that the consumer can
+// safely retry items without contending with the producer and potentially enqueueing
+// stale items.
+func (f *DeltaFIFO[T]) AddIfNotPresent(obj T) error {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.addIfNotPresent(key, Deltas[T]{{Type: Added, Object: obj}})
+	return nil
+}
+
+// AddDeltasIfNotPresent inserts deltas under the key of their newest object,
+// and puts it in the queue. If the key is already present in the set,
+// it is neither enqueued nor added to the set.
+func (f *DeltaFIFO[T]) AddDeltasIfNotPresent(deltas Deltas[T]) error {
+	newest, ok := deltas.Newest()
+	if !ok {
+		return container.KeyError[Deltas[T]]{Obj: deltas, Err: ErrZeroLengthDeltasObject}
+	}
+	key, err := f.keyFunc(newest.Object)
+	if err != nil {
+		return container.KeyError[T]{Obj: newest.Object, Err: err}
+	}
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.addIfNotPresent(key, deltas)
+	return nil
+}
+
+// addIfNotPresent inserts deltas under key if it does not exist,
+// assumes the caller already holds the fifo lock.
+func (f *DeltaFIFO[T]) addIfNotPresent(key string, deltas Deltas[T]) {
+	f.populated = true
+	if _, exists := f.items[key]; exists {
+		return
+	}
+
+	f.queue.PushBack(key)
+	f.items[key] = deltas
+	f.metrics.add(key)
+	f.metrics.setDepth(len(f.items))
+	f.cond.Broadcast()
+}
+
+// queueActionLocked appends to the delta list for the object.
+// Caller must lock first.
+func (f *DeltaFIFO[T]) queueActionLocked(actionType DeltaType, obj T) error {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	f.queueDeltaLocked(key, Delta[T]{Type: actionType, Object: obj})
+	return nil
+}
+
+// queueDeltaLocked appends a delta to the delta list of key.
+// Caller must lock first.
+func (f *DeltaFIFO[T]) queueDeltaLocked(key string, delta Delta[T]) {
+	oldDeltas := f.items[key]
+	newDeltas := dedupDeltas(append(oldDeltas, delta))
+	if _, exists := f.items[key]; !exists {
+		f.queue.PushBack(key)
+		f.metrics.add(key)
+	}
+	f.items[key] = newDeltas
+	f.metrics.setDepth(len(f.items))
+	f.cond.Broadcast()
+}
+
+// re-listing and watching can deliver the same update multiple times in any
+// order. This will combine the most recent two deltas if they are the same.
+func dedupDeltas[T any](deltas Deltas[T]) Deltas[T] {
+	n := len(deltas)
+	if n < 2 {
+		return deltas
+	}
+	a := &deltas[n-1]
+	b := &deltas[n-2]
+	if out := isDup(a, b); out != nil {
+		deltas[n-2] = *out
+		return deltas[:n-1]
+	}
+	return deltas
+}
+
+// If a & b represent the same event, returns the delta that ought to be kept.
+// Otherwise, returns nil.
+// TODO: is there anything other than deletions that need deduping?
+func isDup[T any](a, b *Delta[T]) *Delta[T] {
+	if out := isDeletionDup(a, b); out != nil {
+		return out
+	}
+	// TODO: Detect other duplicate situations? Are there any?
+	return nil
+}
+
+// keep the one with the most information if both are deletions.
+func isDeletionDup[T any](a, b *Delta[T]) *Delta[T] {
+	if b.Type != Deleted || a.Type != Deleted {
+		return nil
+	}
+	// Do more sophisticated checks, or is this sufficient?
+	if b.DeletedFinalStateUnknown {
+		return a
+	}
+	return b
+}
+
+// List returns a list of all the items; it returns the object
+// from the most recent Delta.
+// You should treat the items returned inside the deltas as immutable.
+func (f *DeltaFIFO[T]) List() []T {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	list := make([]T, 0, len(f.items))
+	for _, item := range f.items {
+		list = append(list, item[len(item)-1].Object)
+	}
+	return list
+}
+
+// ListKeys returns a list of all the keys of the objects currently
+// in the DeltaFIFO.
+func (f *DeltaFIFO[T]) ListKeys() []string {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return mapKeys(f.items)
+}
+
+// Get returns the newest object of the requested item, or sets exists=false.
+// You should treat the items returned inside the deltas as immutable.
+func (f *DeltaFIFO[T]) Get(obj T) (item T, exists bool, err error) {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return item, false, container.KeyError[T]{Obj: obj, Err: err}
+	}
+	return f.GetByKey(key)
+}
+
+// GetByKey returns the newest object of the requested item, or sets exists=false.
+// You should treat the items returned inside the deltas as immutable.
+func (f *DeltaFIFO[T]) GetByKey(key string) (item T, exists bool, err error) {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	d, exists := f.items[key]
+	if exists {
+		item = d[len(d)-1].Object
+	}
+	return item, exists, nil
+}
+
+// GetDeltas returns a complete list of deltas for the requested item,
+// or sets exists=false.
+// You should treat the items returned inside the deltas as immutable.
+func (f *DeltaFIFO[T]) GetDeltas(obj T) (deltas Deltas[T], exists bool, err error) {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return nil, false, container.KeyError[T]{Obj: obj, Err: err}
+	}
+	return f.GetDeltasByKey(key)
+}
+
+// GetDeltasByKey returns a complete list of deltas for the requested item,
+// setting exists=false if that list is empty.
+// You should treat the items returned inside the deltas as immutable.
+func (f *DeltaFIFO[T]) GetDeltasByKey(key string) (deltas Deltas[T], exists bool, err error) {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	d, exists := f.items[key]
+	if exists {
+		// Copy item's slice so operations on this slice
+		// won't interfere with the object we return.
+		d = copyDeltas(d)
+	}
+	return d, exists, nil
+}
+
+// Pop waits until an item is ready and processes the newest object of it.
+// It is the same as PopDeltas except that the process function only sees the
+// object of the newest Delta, for the whole change history use PopDeltas.
+func (f *DeltaFIFO[T]) Pop(process PopProcessFunc[T]) (T, error) {
+	return newestObject(f.PopDeltas(newestProcess(process)))
+}
+
+// PopContext is the same as Pop, but it also returns with ctx.Err() once ctx
+// is done while it is blocking.
+func (f *DeltaFIFO[T]) PopContext(ctx context.Context, process PopProcessFunc[T]) (T, error) {
+	return newestObject(f.PopDeltasContext(ctx, newestProcess(process)))
+}
+
+// TryPop is the same as Pop, but it never blocks. It returns ErrFIFOEmpty if
+// no item is ready, or ErrFIFOClosed if the queue is closed and no item is ready.
+func (f *DeltaFIFO[T]) TryPop(process PopProcessFunc[T]) (T, error) {
+	return newestObject(f.TryPopDeltas(newestProcess(process)))
+}
+
+// PopDeltas blocks until the queue has some items, and then returns one.
+// If multiple items are ready, they are returned in the order in which
+// they were added/updated. The item is removed from the queue (and the store)
+// before it is returned, so if you don't successfully process it, you need
+// to add it back with AddDeltasIfNotPresent() or return ErrRequeue from the
+// process function.
+// process function is called under lock, so it is safe to update data
+// structures in it that need to be in sync with the queue
+// (e.g. knownObjects).
+func (f *DeltaFIFO[T]) PopDeltas(process func(Deltas[T]) error) (Deltas[T], error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	for {
+		if item, ok, err := f.popDeltasLocked(process); ok {
+			return item, err
+		}
+		// When the queue is empty, invocation of Pop() is blocked until new item is enqueued.
+		// When Close() is called, the f.closed is set and the condition is broadcasted.
+		// Which causes this loop to continue and return from the Pop().
+		if f.closed {
+			return nil, ErrFIFOClosed
+		}
+		f.cond.Wait()
+	}
+}
+
+// PopDeltasContext is the same as PopDeltas, but it also returns with ctx.Err()
+// once ctx is done while it is blocking.
+func (f *DeltaFIFO[T]) PopDeltasContext(ctx context.Context, process func(Deltas[T]) error) (Deltas[T], error) {
+	// wake up the waiters once ctx is done, the lock makes sure that the
+	// broadcast can not happen between checking ctx.Err() and f.cond.Wait().
+	stop := context.AfterFunc(ctx, func() {
+		f.rw.Lock()
+		defer f.rw.Unlock()
+		f.cond.Broadcast()
+	})
+	defer stop()
+
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	for {
+		if item, ok, err := f.popDeltasLocked(process); ok {
+			return item, err
+		}
+		if f.closed {
+			return nil, ErrFIFOClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		f.cond.Wait()
+	}
+}
+
+// TryPopDeltas is the same as PopDeltas, but it never blocks. It returns ErrFIFOEmpty if
+// no item is ready, or ErrFIFOClosed if the queue is closed and no item is ready.
+func (f *DeltaFIFO[T]) TryPopDeltas(process func(Deltas[T]) error) (Deltas[T], error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if item, ok, err := f.popDeltasLocked(process); ok {
+		return item, err
+	}
+	if f.closed {
+		return nil, ErrFIFOClosed
+	}
+	return nil, ErrFIFOEmpty
+}
+
+// popDeltasLocked pops the first ready item and processes it, it returns false if
+// no item is ready. The caller must hold the lock.
+func (f *DeltaFIFO[T]) popDeltasLocked(process func(Deltas[T]) error) (Deltas[T], bool, error) {
+	for f.queue.Len() > 0 {
+		key := f.queue.Remove(f.queue.Front())
+		if f.initialPopulationCount > 0 {
+			f.initialPopulationCount--
+		}
+		item, ok := f.items[key]
+		if !ok {
+			// This should never happen
+			continue
+		}
+		delete(f.items, key)
+		f.metrics.get(key)
+		f.metrics.setDepth(len(f.items))
+
+		var err error
+		if process != nil {
+			err = process(item)
+		}
+		f.metrics.done(key)
+		if e, ok := err.(ErrRequeue); ok {
+			f.metrics.retry()
+			f.addIfNotPresent(key, item)
+			err = e.Err
+		}
+		return item, true, err
+	}
+	return nil, false, nil
+}
+
+// newestProcess adapts a process function of the newest object to a process function of Deltas.
+func newestProcess[T any](process PopProcessFunc[T]) func(Deltas[T]) error {
+	return func(deltas Deltas[T]) error {
+		if process == nil {
+			return nil
+		}
+		return process(deltas[len(deltas)-1].Object)
+	}
+}
+
+// newestObject returns the newest object of deltas.
+func newestObject[T any](deltas Deltas[T], err error) (T, error) {
+	newest, _ := deltas.Newest()
+	return newest.Object, err
+}
+
+// Replace atomically does two things: (1) it adds the given objects
+// using the Replaced type, and then (2) it does some deletions.
+// In particular: for every pre-existing key K that is not the key of
+// an object in `list` there is the effect of
+// `Delete(DeletedFinalStateUnknown{K, O})` where O is the latest known
+// object of K. The pre-existing keys are those in the union set of the keys in
+// `f.items` and `f.knownObjects` (if not nil). The last known object for key K is
+// the one present in the last delta in `f.items`. If there is no delta for K
+// in `f.items`, it is the object in `f.knownObjects`.
+// The Replaced deltas are queued ordered by key or by the function set with
+// WithReplaceOrder, followed by the deletions in the same order, and
+// resourceVersion is recorded as the last sync resource version.
+func (f *DeltaFIFO[T]) Replace(list []T, resourceVersion string) error {
+	items := make(map[string]T, len(list))
+	keys := make([]string, 0, len(list))
+	for _, item := range list {
+		key, err := f.keyFunc(item)
+		if err != nil {
+			return container.KeyError[T]{Obj: item, Err: err}
+		}
+		if _, exists := items[key]; !exists {
+			keys = append(keys, key)
+		}
+		items[key] = item
+	}
+	sortKeys(keys, items, f.compare)
+
+	f.rw.Lock()
+	defer f.rw.Unlock()
+
+	for _, key := range keys {
+		f.queueDeltaLocked(key, Delta[T]{Type: Replaced, Object: items[key]})
+	}
+
+	// Do deletion detection against objects in the queue
+	deletedObjs := map[string]T{}
+	for k, oldItem := range f.items {
+		if _, exists := items[k]; exists {
+			continue
+		}
+		// Delete pre-existing items not in the new list.
+		// This could happen if watch deletion event was missed while
+		// disconnected from apiserver.
+		if newest := oldItem[len(oldItem)-1]; newest.Type != Deleted {
+			deletedObjs[k] = newest.Object
+		}
+	}
+
+	if f.knownObjects != nil {
+		// Detect deletions for objects not present in the queue, but present in KnownObjects
+		for _, k := range f.knownObjects.ListKeys() {
+			if _, exists := items[k]; exists {
+				continue
+			}
+			if _, exists := f.items[k]; exists {
+				continue
+			}
+
+			deletedObj, exists, err := f.knownObjects.GetByKey(k)
+			if err != nil || !exists {
+				continue
+			}
+			deletedObjs[k] = deletedObj
+		}
+	}
+
+	deletedKeys := mapKeys(deletedObjs)
+	sortKeys(deletedKeys, deletedObjs, f.compare)
+	for _, k := range deletedKeys {
+		f.queueDeltaLocked(k, Delta[T]{Type: Deleted, Object: deletedObjs[k], DeletedFinalStateUnknown: true})
+	}
+
+	if !f.populated {
+		f.populated = true
+		f.initialPopulationCount = len(keys) + len(deletedKeys)
+	}
+	f.lastSyncResourceVersion = resourceVersion
+	return nil
+}
+
+// LastSyncResourceVersion returns the resource version passed to the last Replace.
+func (f *DeltaFIFO[T]) LastSyncResourceVersion() string {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return f.lastSyncResourceVersion
+}
+
+// Resync adds, with a Sync type of Delta, every object listed by
+// `f.knownObjects` whose key is not already queued for processing.
+// If `f.knownObjects` is `nil` then Resync does nothing.
+func (f *DeltaFIFO[T]) Resync() error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+
+	if f.knownObjects == nil {
+		return nil
+	}
+
+	for _, k := range f.knownObjects.ListKeys() {
+		if err := f.syncKeyLocked(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *DeltaFIFO[T]) syncKeyLocked(key string) error {
+	obj, exists, err := f.knownObjects.GetByKey(key)
+	if err != nil || !exists {
+		return nil
+	}
+
+	// If we are doing Resync() and there is already an event queued for that object,
+	// we ignore the Resync for it. This is to avoid the race, in which the resync
+	// comes with the previous value of object (since queueing an event for the object
+	// doesn't trigger changing the underlying store <knownObjects>.
+	id, err := f.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	if len(f.items[id]) > 0 {
+		return nil
+	}
+
+	return f.queueActionLocked(Sync, obj)
+}
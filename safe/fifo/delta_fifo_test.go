@@ -0,0 +1,639 @@
+package fifo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+)
+
+// keyLookupFunc adapts a raw function to be a KeyLookup.
+type keyLookupFunc func() []testFifoObject
+
+// ListKeys just calls kl.
+func (kl keyLookupFunc) ListKeys() []string {
+	result := []string{}
+	for _, fifoObj := range kl() {
+		result = append(result, fifoObj.name)
+	}
+	return result
+}
+
+// GetByKey returns the key if it exists in the list returned by kl.
+func (kl keyLookupFunc) GetByKey(key string) (testFifoObject, bool, error) {
+	for _, v := range kl() {
+		if v.name == key {
+			return v, true, nil
+		}
+	}
+	return testFifoObject{}, false, nil
+}
+
+func testPopDeltas(f *DeltaFIFO[testFifoObject]) Deltas[testFifoObject] {
+	deltas, _ := f.PopDeltas(nil)
+	return deltas
+}
+
+func Test_DeltaFIFO_basic(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+	const amount = 500
+	go func() {
+		for i := 0; i < amount; i++ {
+			f.Add(mkFifoObj(string([]rune{'a', rune(i)}), i+1)) // nolint: errcheck
+		}
+	}()
+	go func() {
+		for u := uint64(0); u < amount; u++ {
+			f.Add(mkFifoObj(string([]rune{'b', rune(u)}), u+1)) // nolint: errcheck
+		}
+	}()
+
+	lastInt := int(0)
+	lastUint := uint64(0)
+	for i := 0; i < amount*2; i++ {
+		switch obj := Pop[testFifoObject](f).val.(type) {
+		case int:
+			if obj <= lastInt {
+				t.Errorf("got %v (int) out of order, last was %v", obj, lastInt)
+			}
+			lastInt = obj
+		case uint64:
+			if obj <= lastUint {
+				t.Errorf("got %v (uint) out of order, last was %v", obj, lastUint)
+			} else {
+				lastUint = obj
+			}
+		default:
+			t.Fatalf("unexpected type %#v", obj)
+		}
+	}
+}
+
+func Test_DeltaFIFO_requeueOnPop(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+
+	f.Add(mkFifoObj("foo", 10)) // nolint: errcheck
+	_, err := f.PopDeltas(func(d Deltas[testFifoObject]) error {
+		if d[0].Object.name != "foo" {
+			t.Fatalf("unexpected object: %#v", d)
+		}
+		return ErrRequeue{Err: nil}
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d, ok, err := f.GetDeltasByKey("foo"); !ok || err != nil || len(d) != 1 {
+		t.Fatalf("object should have been requeued: %t %v %v", ok, err, d)
+	}
+
+	_, err = f.Pop(func(obj testFifoObject) error {
+		if obj.name != "foo" {
+			t.Fatalf("unexpected object: %#v", obj)
+		}
+		return ErrRequeue{Err: errors.New("test error")}
+	})
+	if err == nil || err.Error() != "test error" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok, err := f.GetByKey("foo"); !ok || err != nil {
+		t.Fatalf("object should have been requeued: %t %v", ok, err)
+	}
+
+	_, err = f.Pop(func(obj testFifoObject) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok, err := f.GetByKey("foo"); ok || err != nil {
+		t.Fatalf("object should have been removed: %t %v", ok, err)
+	}
+}
+
+func Test_DeltaFIFO_addUpdate(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+	f.Add(mkFifoObj("foo", 10))    // nolint: errcheck
+	f.Update(mkFifoObj("foo", 12)) // nolint: errcheck
+	f.Delete(mkFifoObj("foo", 15)) // nolint: errcheck
+
+	if e, a := []testFifoObject{mkFifoObj("foo", 15)}, f.List(); !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %+v, got %+v", e, a)
+	}
+	if e, a := []string{"foo"}, f.ListKeys(); !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %+v, got %+v", e, a)
+	}
+
+	got := make(chan Deltas[testFifoObject], 2)
+	go func() {
+		for {
+			d, err := f.PopDeltas(nil)
+			if err != nil {
+				return
+			}
+			got <- d
+		}
+	}()
+
+	first := <-got
+	expected := Deltas[testFifoObject]{
+		{Type: Added, Object: mkFifoObj("foo", 10)},
+		{Type: Updated, Object: mkFifoObj("foo", 12)},
+		{Type: Deleted, Object: mkFifoObj("foo", 15)},
+	}
+	if !reflect.DeepEqual(expected, first) {
+		t.Errorf("Expected %+v, got %+v", expected, first)
+	}
+	select {
+	case unexpected := <-got:
+		t.Errorf("Got second value %v", unexpected)
+	case <-time.After(50 * time.Millisecond):
+	}
+	_, exists, _ := f.Get(mkFifoObj("foo", ""))
+	if exists {
+		t.Errorf("item did not get removed")
+	}
+	f.Close()
+}
+
+func Test_DeltaFIFO_enqueueingNoLister(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+	f.Add(mkFifoObj("foo", 10))    // nolint: errcheck
+	f.Update(mkFifoObj("bar", 15)) // nolint: errcheck
+	f.Add(mkFifoObj("qux", 17))    // nolint: errcheck
+	f.Delete(mkFifoObj("qux", 18)) // nolint: errcheck
+
+	// This delete does not enqueue anything because baz doesn't exist.
+	f.Delete(mkFifoObj("baz", 20)) // nolint: errcheck
+
+	expectList := []int{10, 15, 18}
+	for _, expect := range expectList {
+		if e, a := expect, Pop[testFifoObject](f).val; e != a {
+			t.Errorf("Didn't get updated value (%v), got %v", e, a)
+		}
+	}
+	if e, a := 0, len(f.items); e != a {
+		t.Errorf("queue unexpectedly not empty: %v != %v\n%#v", e, a, f.items)
+	}
+}
+
+func Test_DeltaFIFO_enqueueingWithLister(t *testing.T) {
+	f := NewDeltaFIFO(
+		testFifoObjectKeyFunc,
+		WithKnownObjects[testFifoObject](keyLookupFunc(func() []testFifoObject {
+			return []testFifoObject{mkFifoObj("foo", 5), mkFifoObj("bar", 6), mkFifoObj("baz", 7)}
+		})),
+	)
+	f.Add(mkFifoObj("foo", 10))    // nolint: errcheck
+	f.Update(mkFifoObj("bar", 15)) // nolint: errcheck
+
+	// This delete does enqueue the deletion, because "baz" is in the key lister.
+	f.Delete(mkFifoObj("baz", 20)) // nolint: errcheck
+
+	expectList := []int{10, 15, 20}
+	for _, expect := range expectList {
+		if e, a := expect, Pop[testFifoObject](f).val; e != a {
+			t.Errorf("Didn't get updated value (%v), got %v", e, a)
+		}
+	}
+	if e, a := 0, len(f.items); e != a {
+		t.Errorf("queue unexpectedly not empty: %v != %v", e, a)
+	}
+}
+
+func Test_DeltaFIFO_deleteDedup(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+	f.Add(mkFifoObj("foo", 10))    // nolint: errcheck
+	f.Delete(mkFifoObj("foo", 11)) // nolint: errcheck
+	f.Delete(mkFifoObj("foo", 12)) // nolint: errcheck
+
+	expected := Deltas[testFifoObject]{
+		{Type: Added, Object: mkFifoObj("foo", 10)},
+		{Type: Deleted, Object: mkFifoObj("foo", 11)},
+	}
+	if a := testPopDeltas(f); !reflect.DeepEqual(expected, a) {
+		t.Errorf("Expected %#v, got %#v", expected, a)
+	}
+}
+
+func Test_DeltaFIFO_replaceWithDeleteDeltaIn(t *testing.T) {
+	oldObj := mkFifoObj("foo", 1)
+	newObj := mkFifoObj("foo", 2)
+	f := NewDeltaFIFO(
+		testFifoObjectKeyFunc,
+		WithKnownObjects[testFifoObject](keyLookupFunc(func() []testFifoObject {
+			return []testFifoObject{oldObj}
+		})),
+	)
+
+	f.Delete(oldObj)                                   // nolint: errcheck
+	f.Replace([]testFifoObject{newObj}, "")            // nolint: errcheck
+	f.Delete(newObj)                                   // nolint: errcheck
+	f.Replace([]testFifoObject{mkFifoObj("a", 1)}, "") // nolint: errcheck
+
+	actualDeltas := testPopDeltas(f)
+	expectedDeltas := Deltas[testFifoObject]{
+		{Type: Deleted, Object: oldObj},
+		{Type: Replaced, Object: newObj},
+		{Type: Deleted, Object: newObj},
+	}
+	if !reflect.DeepEqual(expectedDeltas, actualDeltas) {
+		t.Errorf("expected %#v, got %#v", expectedDeltas, actualDeltas)
+	}
+}
+
+func Test_DeltaFIFO_replaceMakesDeletions(t *testing.T) {
+	// We test with only one pre-existing object because there is no
+	// promise about how their deletes are ordered.
+
+	// Try it with a pre-existing Delete
+	f := NewDeltaFIFO(
+		testFifoObjectKeyFunc,
+		WithKnownObjects[testFifoObject](keyLookupFunc(func() []testFifoObject {
+			return []testFifoObject{mkFifoObj("foo", 5), mkFifoObj("bar", 6), mkFifoObj("baz", 7)}
+		})),
+	)
+	f.Delete(mkFifoObj("baz", 10))                        // nolint: errcheck
+	f.Replace([]testFifoObject{mkFifoObj("foo", 5)}, "0") // nolint: errcheck
+
+	expectedList := []Deltas[testFifoObject]{
+		{{Type: Deleted, Object: mkFifoObj("baz", 10)}},
+		{{Type: Replaced, Object: mkFifoObj("foo", 5)}},
+		// Since "bar" didn't have a delete event and wasn't in the Replace list
+		// it should get a tombstone key with the right Obj.
+		{{Type: Deleted, Object: mkFifoObj("bar", 6), DeletedFinalStateUnknown: true}},
+	}
+
+	for _, expected := range expectedList {
+		cur := testPopDeltas(f)
+		if e, a := expected, cur; !reflect.DeepEqual(e, a) {
+			t.Errorf("Expected %#v, got %#v", e, a)
+		}
+	}
+
+	// Now try starting with an Add instead of a Delete
+	f = NewDeltaFIFO(
+		testFifoObjectKeyFunc,
+		WithKnownObjects[testFifoObject](keyLookupFunc(func() []testFifoObject {
+			return []testFifoObject{mkFifoObj("foo", 5), mkFifoObj("bar", 6), mkFifoObj("baz", 7)}
+		})),
+	)
+	f.Add(mkFifoObj("baz", 10))                           // nolint: errcheck
+	f.Replace([]testFifoObject{mkFifoObj("foo", 5)}, "0") // nolint: errcheck
+
+	expectedList = []Deltas[testFifoObject]{
+		{{Type: Added, Object: mkFifoObj("baz", 10)},
+			{Type: Deleted, Object: mkFifoObj("baz", 10), DeletedFinalStateUnknown: true}},
+		{{Type: Replaced, Object: mkFifoObj("foo", 5)}},
+		// Since "bar" didn't have a delete event and wasn't in the Replace list
+		// it should get a tombstone key with the right Obj.
+		{{Type: Deleted, Object: mkFifoObj("bar", 6), DeletedFinalStateUnknown: true}},
+	}
+
+	for _, expected := range expectedList {
+		cur := testPopDeltas(f)
+		if e, a := expected, cur; !reflect.DeepEqual(e, a) {
+			t.Errorf("Expected %#v, got %#v", e, a)
+		}
+	}
+
+	// Now try deleting and recreating the object in the queue, then delete it by a Replace call
+	f = NewDeltaFIFO(
+		testFifoObjectKeyFunc,
+		WithKnownObjects[testFifoObject](keyLookupFunc(func() []testFifoObject {
+			return []testFifoObject{mkFifoObj("foo", 5), mkFifoObj("bar", 6), mkFifoObj("baz", 7)}
+		})),
+	)
+	f.Delete(mkFifoObj("bar", 6))                         // nolint: errcheck
+	f.Add(mkFifoObj("bar", 100))                          // nolint: errcheck
+	f.Replace([]testFifoObject{mkFifoObj("foo", 5)}, "0") // nolint: errcheck
+
+	expectedList = []Deltas[testFifoObject]{
+		{
+			{Type: Deleted, Object: mkFifoObj("bar", 6)},
+			{Type: Added, Object: mkFifoObj("bar", 100)},
+			// Since "bar" has a newer object in the queue than in the state,
+			// it should get a tombstone key with the latest object from the queue
+			{Type: Deleted, Object: mkFifoObj("bar", 100), DeletedFinalStateUnknown: true},
+		},
+		{{Type: Replaced, Object: mkFifoObj("foo", 5)}},
+		{{Type: Deleted, Object: mkFifoObj("baz", 7), DeletedFinalStateUnknown: true}},
+	}
+
+	for _, expected := range expectedList {
+		cur := testPopDeltas(f)
+		if e, a := expected, cur; !reflect.DeepEqual(e, a) {
+			t.Errorf("Expected %#v, got %#v", e, a)
+		}
+	}
+}
+
+func Test_DeltaFIFO_replaceWithoutKnownObjects(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+	f.Add(mkFifoObj("baz", 10))                           // nolint: errcheck
+	f.Replace([]testFifoObject{mkFifoObj("foo", 5)}, "0") // nolint: errcheck
+
+	expectedList := []Deltas[testFifoObject]{
+		{
+			{Type: Added, Object: mkFifoObj("baz", 10)},
+			{Type: Deleted, Object: mkFifoObj("baz", 10), DeletedFinalStateUnknown: true},
+		},
+		{{Type: Replaced, Object: mkFifoObj("foo", 5)}},
+	}
+	for _, expected := range expectedList {
+		if e, a := expected, testPopDeltas(f); !reflect.DeepEqual(e, a) {
+			t.Errorf("Expected %#v, got %#v", e, a)
+		}
+	}
+}
+
+func Test_DeltaFIFO_resync(t *testing.T) {
+	f := NewDeltaFIFO(
+		testFifoObjectKeyFunc,
+		WithKnownObjects[testFifoObject](keyLookupFunc(func() []testFifoObject {
+			return []testFifoObject{mkFifoObj("foo", 5), mkFifoObj("bar", 6)}
+		})),
+	)
+	f.Update(mkFifoObj("foo", 10)) // nolint: errcheck
+	if err := f.Resync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// foo is already queued, so only bar gets a Sync delta.
+	expectedList := []Deltas[testFifoObject]{
+		{{Type: Updated, Object: mkFifoObj("foo", 10)}},
+		{{Type: Sync, Object: mkFifoObj("bar", 6)}},
+	}
+	for _, expected := range expectedList {
+		if e, a := expected, testPopDeltas(f); !reflect.DeepEqual(e, a) {
+			t.Errorf("Expected %#v, got %#v", e, a)
+		}
+	}
+
+	// without known objects it is a no-op.
+	f = NewDeltaFIFO(testFifoObjectKeyFunc)
+	if err := f.Resync(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if keys := f.ListKeys(); len(keys) != 0 {
+		t.Errorf("Expected no keys, got %v", keys)
+	}
+}
+
+func Test_DeltaFIFO_detectLineJumpers(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+
+	f.Add(mkFifoObj("foo", 10)) // nolint: errcheck
+	f.Add(mkFifoObj("bar", 1))  // nolint: errcheck
+	f.Add(mkFifoObj("foo", 11)) // nolint: errcheck
+	f.Add(mkFifoObj("foo", 13)) // nolint: errcheck
+	f.Add(mkFifoObj("zab", 30)) // nolint: errcheck
+
+	if e, a := 13, Pop[testFifoObject](f).val; a != e {
+		t.Fatalf("expected %d, got %d", e, a)
+	}
+
+	// ensure foo doesn't jump back in line
+	f.Add(mkFifoObj("foo", 14)) // nolint: errcheck
+
+	if e, a := 1, Pop[testFifoObject](f).val; a != e {
+		t.Fatalf("expected %d, got %d", e, a)
+	}
+	if e, a := 30, Pop[testFifoObject](f).val; a != e {
+		t.Fatalf("expected %d, got %d", e, a)
+	}
+	if e, a := 14, Pop[testFifoObject](f).val; a != e {
+		t.Fatalf("expected %d, got %d", e, a)
+	}
+}
+
+func Test_DeltaFIFO_addIfNotPresent(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+
+	emptyDeltas := Deltas[testFifoObject]{}
+	if err := f.AddDeltasIfNotPresent(emptyDeltas); err == nil {
+		t.Errorf("Expected error adding empty deltas")
+	}
+
+	f.Add(mkFifoObj("b", 3)) // nolint: errcheck
+	b3 := testPopDeltas(f)
+	f.Add(mkFifoObj("c", 4))                                                                  // nolint: errcheck
+	f.AddDeltasIfNotPresent(Deltas[testFifoObject]{{Type: Added, Object: mkFifoObj("c", 5)}}) // nolint: errcheck
+	f.AddDeltasIfNotPresent(b3)                                                               // nolint: errcheck
+	f.AddIfNotPresent(mkFifoObj("a", 1))                                                      // nolint: errcheck
+
+	if e, a := 3, len(f.items); a != e {
+		t.Fatalf("expected queue length %d, got %d", e, a)
+	}
+
+	expectedValues := []int{4, 3, 1}
+	for _, expected := range expectedValues {
+		if actual := Pop[testFifoObject](f).val; actual != expected {
+			t.Fatalf("expected value %d, got %d", expected, actual)
+		}
+	}
+}
+
+func Test_DeltaFIFO_KeyOf(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+
+	d, exists, err := f.GetDeltas(mkFifoObj("foo", ""))
+	if err != nil || !exists {
+		t.Fatalf("expected deltas of foo: %t %v", exists, err)
+	}
+	if oldest, ok := d.Oldest(); !ok || oldest.Object.val != 1 {
+		t.Errorf("unexpected oldest delta: %#v", oldest)
+	}
+	if newest, ok := d.Newest(); !ok || newest.Object.val != 1 {
+		t.Errorf("unexpected newest delta: %#v", newest)
+	}
+	if _, ok := (Deltas[testFifoObject]{}).Newest(); ok {
+		t.Errorf("expected no newest delta for empty deltas")
+	}
+
+	// GetDeltas returns a copy
+	d[0].Type = Sync
+	if d2, _, _ := f.GetDeltasByKey("foo"); d2[0].Type != Added {
+		t.Errorf("expected deltas not to be clobbered, got %#v", d2)
+	}
+	keys := f.ListKeys()
+	sort.Strings(keys)
+	if e, a := []string{"foo"}, keys; !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %+v, got %+v", e, a)
+	}
+}
+
+func Test_DeltaFIFO_HasSynced(t *testing.T) {
+	tests := []struct {
+		actions        []func(f *DeltaFIFO[testFifoObject])
+		expectedSynced bool
+	}{
+		{
+			actions:        []func(f *DeltaFIFO[testFifoObject]){},
+			expectedSynced: false,
+		},
+		{
+			actions: []func(f *DeltaFIFO[testFifoObject]){
+				func(f *DeltaFIFO[testFifoObject]) {
+					f.Add(mkFifoObj("a", 1)) // nolint: errcheck
+				},
+			},
+			expectedSynced: true,
+		},
+		{
+			actions: []func(f *DeltaFIFO[testFifoObject]){
+				func(f *DeltaFIFO[testFifoObject]) {
+					f.Replace([]testFifoObject{}, "0") // nolint: errcheck
+				},
+			},
+			expectedSynced: true,
+		},
+		{
+			actions: []func(f *DeltaFIFO[testFifoObject]){
+				func(f *DeltaFIFO[testFifoObject]) {
+					f.Replace([]testFifoObject{mkFifoObj("a", 1), mkFifoObj("b", 2)}, "0") // nolint: errcheck
+				},
+			},
+			expectedSynced: false,
+		},
+		{
+			actions: []func(f *DeltaFIFO[testFifoObject]){
+				func(f *DeltaFIFO[testFifoObject]) {
+					f.Replace([]testFifoObject{mkFifoObj("a", 1), mkFifoObj("b", 2)}, "0") // nolint: errcheck
+				},
+				func(f *DeltaFIFO[testFifoObject]) { testPopDeltas(f) },
+			},
+			expectedSynced: false,
+		},
+		{
+			actions: []func(f *DeltaFIFO[testFifoObject]){
+				func(f *DeltaFIFO[testFifoObject]) {
+					f.Replace([]testFifoObject{mkFifoObj("a", 1), mkFifoObj("b", 2)}, "0") // nolint: errcheck
+				},
+				func(f *DeltaFIFO[testFifoObject]) { testPopDeltas(f) },
+				func(f *DeltaFIFO[testFifoObject]) { testPopDeltas(f) },
+			},
+			expectedSynced: true,
+		},
+	}
+
+	for i, test := range tests {
+		f := NewDeltaFIFO(testFifoObjectKeyFunc)
+
+		for _, action := range test.actions {
+			action(f)
+		}
+		if e, a := test.expectedSynced, f.HasSynced(); a != e {
+			t.Errorf("test case %v failed, expected: %v , got %v", i, e, a)
+		}
+	}
+}
+
+// Test_DeltaFIFO_PopShouldUnblockWhenClosed checks that any blocking Pop on an empty queue
+// should unblock and return after Close is called.
+func Test_DeltaFIFO_PopShouldUnblockWhenClosed(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+
+	c := make(chan struct{})
+	const jobs = 10
+	for i := 0; i < jobs; i++ {
+		go func() {
+			f.Pop(func(obj testFifoObject) error { return nil }) // nolint: errcheck
+			c <- struct{}{}
+		}()
+	}
+
+	runtime.Gosched()
+	f.Close()
+
+	if v := f.IsClosed(); !v {
+		t.Errorf("test IsClosed failed, expected: %v , got %v", true, v)
+	}
+
+	for i := 0; i < jobs; i++ {
+		select {
+		case <-c:
+		case <-time.After(500 * time.Millisecond):
+			t.Fatalf("timed out waiting for Pop to return after Close")
+		}
+	}
+}
+
+func Test_DeltaFIFO_PopContext(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+
+	f.Add(mkFifoObj("foo", 10))    // nolint: errcheck
+	f.Update(mkFifoObj("foo", 11)) // nolint: errcheck
+	obj, err := f.PopContext(context.Background(), nil)
+	if err != nil || obj.val != 11 {
+		t.Fatalf("expected newest foo, got %v %v", obj, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = f.PopDeltasContext(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Close()
+	}()
+	if _, err = f.PopContext(context.Background(), nil); !errors.Is(err, ErrFIFOClosed) {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+}
+
+func Test_DeltaFIFO_TryPop(t *testing.T) {
+	f := NewDeltaFIFO(testFifoObjectKeyFunc)
+
+	if _, err := f.TryPop(nil); !errors.Is(err, ErrFIFOEmpty) {
+		t.Fatalf("expected empty error, got %v", err)
+	}
+
+	f.Add(mkFifoObj("foo", 10))    // nolint: errcheck
+	f.Delete(mkFifoObj("foo", 10)) // nolint: errcheck
+	d, err := f.TryPopDeltas(nil)
+	if err != nil || len(d) != 2 || d[1].Type != Deleted {
+		t.Fatalf("unexpected result: %v %v", d, err)
+	}
+
+	f.Close()
+	if _, err := f.TryPop(nil); !errors.Is(err, ErrFIFOClosed) {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+}
+
+func Test_DeltaFIFO_ReplaceOrder(t *testing.T) {
+	f := NewDeltaFIFO(
+		testFifoObjectKeyFunc,
+		WithKnownObjects[testFifoObject](keyLookupFunc(func() []testFifoObject {
+			return []testFifoObject{mkFifoObj("x", 1), mkFifoObj("e", 2)}
+		})),
+	)
+	f.Add(mkFifoObj("z", 1))                                                                  // nolint: errcheck
+	f.Replace([]testFifoObject{mkFifoObj("c", 3), mkFifoObj("a", 1), mkFifoObj("b", 2)}, "7") // nolint: errcheck
+	if e, a := "7", f.LastSyncResourceVersion(); e != a {
+		t.Errorf("expected resource version %v, got %v", e, a)
+	}
+
+	expectedList := []Deltas[testFifoObject]{
+		{{Type: Added, Object: mkFifoObj("z", 1)},
+			{Type: Deleted, Object: mkFifoObj("z", 1), DeletedFinalStateUnknown: true}},
+		{{Type: Replaced, Object: mkFifoObj("a", 1)}},
+		{{Type: Replaced, Object: mkFifoObj("b", 2)}},
+		{{Type: Replaced, Object: mkFifoObj("c", 3)}},
+		// the deletions follow, ordered by key.
+		{{Type: Deleted, Object: mkFifoObj("e", 2), DeletedFinalStateUnknown: true}},
+		{{Type: Deleted, Object: mkFifoObj("x", 1), DeletedFinalStateUnknown: true}},
+	}
+	for _, expected := range expectedList {
+		cur := testPopDeltas(f)
+		if e, a := expected, cur; !reflect.DeepEqual(e, a) {
+			t.Errorf("Expected %#v, got %#v", e, a)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package fifo
+
+import (
+	"github.com/things-go/container"
+)
+
+// Codec encodes and decodes the objects of a durable FIFO.
+type Codec[T any] interface {
+	Marshal(T) ([]byte, error)
+	Unmarshal([]byte) (T, error)
+}
+
+// NewDurable returns a FIFO which persists its items and their order in dir,
+// so a FIFO opened on the same dir after a restart continues with them.
+// The objects are encoded by codec, and keyFunc is used to make the key used
+// for queued item insertion and retrieval, and should be deterministic.
+//
+// Add, Update, Delete and Pop append a record to a write-ahead log before
+// they take effect, and the operation fails if the record can not be written.
+// The log is compacted into a snapshot once it grows, see WithCompactThreshold,
+// and Replace writes a snapshot directly. The records are handed to the
+// operating system, use WithSyncWrites to also survive a power loss.
+// A torn record at the end of the log, left by a crash in the middle of a
+// write, is dropped when it is opened, while a bad record in the middle of the
+// log, or a record which is intact but can not be decoded, such as after a
+// change of the type, fails it with ErrCorruptLog.
+//
+// The delivery is at-most-once: the pop is persisted before the item is
+// processed, so an item whose process is cut short by a crash is not
+// restored. The objects requeued by ErrRequeue are persisted too. Close the
+// FIFO to release the log.
+func NewDurable[T any](dir string, codec Codec[T], keyFunc container.KeyFunc[T], opts ...Option[T]) (*FIFO[T], error) {
+	j, items, queue, err := openJournal(dir, codec, newOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+	f := New(keyFunc, opts...)
+	f.items = items
+	f.queue = queue
+	f.journal = j
+	if len(items) > 0 {
+		f.populated = true
+		for e := queue.Front(); e != nil; e = e.Next() {
+			f.metrics.add(e.Value.key)
+		}
+		f.metrics.setDepth(len(items))
+	}
+	return f, nil
+}
@@ -0,0 +1,271 @@
+package fifo
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type testFifoObjectCodec struct{}
+
+type testFifoObjectJSON struct {
+	Name string `json:"name"`
+	Val  int    `json:"val"`
+}
+
+func (testFifoObjectCodec) Marshal(obj testFifoObject) ([]byte, error) {
+	return json.Marshal(testFifoObjectJSON{Name: obj.name, Val: obj.val.(int)})
+}
+
+func (testFifoObjectCodec) Unmarshal(data []byte) (testFifoObject, error) {
+	var v testFifoObjectJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return testFifoObject{}, err
+	}
+	return mkFifoObj(v.Name, v.Val), nil
+}
+
+func openTestDurable(t *testing.T, dir string, opts ...Option[testFifoObject]) *FIFO[testFifoObject] {
+	t.Helper()
+	f, err := NewDurable[testFifoObject](dir, testFifoObjectCodec{}, testFifoObjectKeyFunc, opts...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return f
+}
+
+// drain pops every ready item in order.
+func drain(t *testing.T, f *FIFO[testFifoObject]) []testFifoObject {
+	t.Helper()
+	var r []testFifoObject
+	for {
+		obj, err := f.TryPop(nil)
+		if errors.Is(err, ErrFIFOEmpty) {
+			return r
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		r = append(r, obj)
+	}
+}
+
+func Test_Durable_restore(t *testing.T) {
+	dir := t.TempDir()
+	f := openTestDurable(t, dir)
+	f.Add(mkFifoObj("a", 1))    // nolint: errcheck
+	f.Add(mkFifoObj("b", 2))    // nolint: errcheck
+	f.Add(mkFifoObj("c", 3))    // nolint: errcheck
+	f.Update(mkFifoObj("a", 4)) // nolint: errcheck
+	f.Delete(mkFifoObj("b", 0)) // nolint: errcheck
+	f.Add(mkFifoObj("d", 5))    // nolint: errcheck
+	if e, a := mkFifoObj("a", 4), Pop[testFifoObject](f); e != a {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	// the requeued item is persisted too.
+	f.Pop(func(testFifoObject) error { return ErrRequeue{} }) // nolint: errcheck
+	f.Close()
+
+	f = openTestDurable(t, dir)
+	defer f.Close()
+	expected := []testFifoObject{mkFifoObj("d", 5), mkFifoObj("c", 3)}
+	if e, a := expected, drain(t, f); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_Durable_truncatedTail(t *testing.T) {
+	dir := t.TempDir()
+	f := openTestDurable(t, dir)
+	f.Add(mkFifoObj("a", 1)) // nolint: errcheck
+	f.Add(mkFifoObj("b", 2)) // nolint: errcheck
+	f.Close()
+
+	// a crash in the middle of writing the record of "b".
+	walName := filepath.Join(dir, walFilePrefix+"0")
+	info, err := os.Stat(walName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err = os.Truncate(walName, info.Size()-3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f = openTestDurable(t, dir)
+	if e, a := []string{"a"}, f.ListKeys(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	// the new records follow the last good one.
+	f.Add(mkFifoObj("c", 3)) // nolint: errcheck
+	f.Close()
+
+	f = openTestDurable(t, dir)
+	defer f.Close()
+	expected := []testFifoObject{mkFifoObj("a", 1), mkFifoObj("c", 3)}
+	if e, a := expected, drain(t, f); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_Durable_corruptTail(t *testing.T) {
+	dir := t.TempDir()
+	f := openTestDurable(t, dir)
+	f.Add(mkFifoObj("a", 1)) // nolint: errcheck
+	f.Close()
+
+	walName := filepath.Join(dir, walFilePrefix+"0")
+	file, err := os.OpenFile(walName, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a record with a bad checksum.
+	record := appendRecord(nil, encodePayload(opAdd, "b", []byte(`{"name":"b","val":2}`)))
+	record[len(record)-1] ^= 0xff
+	file.Write(record) // nolint: errcheck
+	file.Close()
+
+	f = openTestDurable(t, dir)
+	defer f.Close()
+	if e, a := []testFifoObject{mkFifoObj("a", 1)}, drain(t, f); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_Durable_corruptMiddle(t *testing.T) {
+	dir := t.TempDir()
+	f := openTestDurable(t, dir)
+	f.Add(mkFifoObj("a", 1)) // nolint: errcheck
+	f.Close()
+
+	walName := filepath.Join(dir, walFilePrefix+"0")
+	file, err := os.OpenFile(walName, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// a record with a bad checksum, followed by a good one.
+	record := appendRecord(nil, encodePayload(opAdd, "b", []byte(`{"name":"b","val":2}`)))
+	record[len(record)-1] ^= 0xff
+	file.Write(record)                                                                       // nolint: errcheck
+	file.Write(appendRecord(nil, encodePayload(opAdd, "c", []byte(`{"name":"c","val":3}`)))) // nolint: errcheck
+	file.Close()
+	info, err := os.Stat(walName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err = NewDurable[testFifoObject](dir, testFifoObjectCodec{}, testFifoObjectKeyFunc); !errors.Is(err, ErrCorruptLog) {
+		t.Errorf("expected %v, got %v", ErrCorruptLog, err)
+	}
+	// the good records after the bad one are not dropped.
+	if after, err := os.Stat(walName); err != nil || after.Size() != info.Size() {
+		t.Errorf("expected the log of size %v to be kept, got %v, %v", info.Size(), after, err)
+	}
+}
+
+func Test_Durable_undecodableRecord(t *testing.T) {
+	dir := t.TempDir()
+	f := openTestDurable(t, dir)
+	f.Add(mkFifoObj("a", 1)) // nolint: errcheck
+	f.Close()
+
+	walName := filepath.Join(dir, walFilePrefix+"0")
+	file, err := os.OpenFile(walName, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// an intact record which can not be decoded, followed by a good one.
+	file.Write(appendRecord(nil, encodePayload(opAdd, "b", []byte(`{"val":"2"}`))))          // nolint: errcheck
+	file.Write(appendRecord(nil, encodePayload(opAdd, "c", []byte(`{"name":"c","val":3}`)))) // nolint: errcheck
+	file.Close()
+	info, err := os.Stat(walName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err = NewDurable[testFifoObject](dir, testFifoObjectCodec{}, testFifoObjectKeyFunc); !errors.Is(err, ErrCorruptLog) {
+		t.Errorf("expected %v, got %v", ErrCorruptLog, err)
+	}
+	// the log is not truncated.
+	if after, err := os.Stat(walName); err != nil || after.Size() != info.Size() {
+		t.Errorf("expected the log of size %v to be kept, got %v, %v", info.Size(), after, err)
+	}
+}
+
+func Test_Durable_compact(t *testing.T) {
+	dir := t.TempDir()
+	f := openTestDurable(t, dir, WithCompactThreshold[testFifoObject](10))
+	for i := 0; i < 50; i++ {
+		f.Add(mkFifoObj("a", i)) // nolint: errcheck
+		if i%3 == 0 {
+			Pop[testFifoObject](f)
+		}
+	}
+	f.Add(mkFifoObj("b", 100)) // nolint: errcheck
+	f.Close()
+
+	if _, err := os.Stat(filepath.Join(dir, snapshotFileName)); err != nil {
+		t.Fatalf("expected a snapshot, got %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := 2, len(entries); e != a {
+		t.Errorf("expected %v files, got %v", e, a)
+	}
+
+	f = openTestDurable(t, dir)
+	defer f.Close()
+	expected := []testFifoObject{mkFifoObj("a", 49), mkFifoObj("b", 100)}
+	if e, a := expected, drain(t, f); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_Durable_Replace(t *testing.T) {
+	dir := t.TempDir()
+	f := openTestDurable(t, dir)
+	f.Add(mkFifoObj("z", 1))                                               // nolint: errcheck
+	f.Replace([]testFifoObject{mkFifoObj("c", 3), mkFifoObj("a", 1)}, "1") // nolint: errcheck
+	f.Add(mkFifoObj("b", 2))                                               // nolint: errcheck
+	f.Close()
+
+	// a stale log left by a crash in the middle of a compaction.
+	if err := os.WriteFile(filepath.Join(dir, walFilePrefix+"9"), []byte("garbage"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f = openTestDurable(t, dir)
+	defer f.Close()
+	if _, err := os.Stat(filepath.Join(dir, walFilePrefix+"9")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the stale log removed, got %v", err)
+	}
+	expected := []testFifoObject{mkFifoObj("a", 1), mkFifoObj("c", 3), mkFifoObj("b", 2)}
+	if e, a := expected, drain(t, f); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_Durable_corruptSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, snapshotFileName), []byte("garbage"), 0o644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := NewDurable[testFifoObject](dir, testFifoObjectCodec{}, testFifoObjectKeyFunc); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Errorf("expected %v, got %v", ErrCorruptSnapshot, err)
+	}
+}
+
+func Test_Durable_closed(t *testing.T) {
+	f := openTestDurable(t, t.TempDir())
+	f.Close()
+	if err := f.Add(mkFifoObj("a", 1)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("expected %v, got %v", os.ErrClosed, err)
+	}
+	if e, a := 0, len(f.List()); e != a {
+		t.Errorf("expected %v items, got %v", e, a)
+	}
+}
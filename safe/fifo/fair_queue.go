@@ -0,0 +1,466 @@
+package fifo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/comparator"
+	"github.com/things-go/container/go/list"
+)
+
+// GroupFunc returns the group of an object, such as its tenant.
+// It should be deterministic.
+type GroupFunc[T any] func(T) string
+
+// FairQueue is a Queue
+var _ Queue[int] = (*FairQueue[int])(nil)
+
+// FairQueue is a Queue which keeps a FIFO per group, and pops across the
+// groups with deficit round-robin, so a group with many items can not
+// starve the others. Like FIFO, each accumulator is simply the most
+// recently provided object, an object is only queued once per key,
+// and the Resync operation is a no-op.
+//
+// In its turn a group pops up to its weight items, one by default (plain
+// round-robin), see WithGroupWeight, then the next group takes its turn.
+// Within a group the items are popped in the order they were added.
+// A group is dropped as soon as it has no item queued, so the groups
+// of short-lived tenants do not pile up.
+type FairQueue[T any] struct {
+	rw   sync.RWMutex
+	cond sync.Cond
+	// items maps a key to the group which holds it, a key is in one group only.
+	items map[string]*fairGroup[T]
+	// groups maps a name to its group, only the groups with queued items are kept.
+	groups map[string]*fairGroup[T]
+	// active is the round-robin order of the groups, the front group pops next.
+	active *list.List[*fairGroup[T]]
+
+	// populated is true if the first batch of items inserted by Replace() has been populated
+	// or Delete/Push/Update was called first.
+	populated bool
+	// initialPopulationCount is the number of items inserted by the first call of Replace()
+	initialPopulationCount int
+
+	// keyFunc is used to make the key used for queued item insertion and retrieval, and
+	// should be deterministic.
+	keyFunc container.KeyFunc[T]
+	// groupFunc is used to make the group of the queued items.
+	groupFunc GroupFunc[T]
+	// groupWeight returns the weight of a group, nil means 1.
+	groupWeight func(group string) int
+
+	// compare is used to order the keys queued by Replace(), default by key.
+	compare comparator.Comparable[T]
+	// lastSyncResourceVersion is the resource version passed to the last Replace().
+	lastSyncResourceVersion string
+	// metrics of the queue, nil if no MetricsProvider is set.
+	metrics *queueMetrics
+
+	// Indication the queue is closed.
+	closed bool
+}
+
+// fairGroup is the FIFO of a group.
+type fairGroup[T any] struct {
+	name  string
+	items map[string]*list.Element[fifoEntry[T]]
+	queue *list.List[fifoEntry[T]]
+	// deficit is the number of the items the group can still pop in its turn.
+	deficit int
+	// elem is the element of the group in active.
+	elem *list.Element[*fairGroup[T]]
+}
+
+// NewFairQueue returns a FairQueue which queues the items by the group of groupFunc.
+// keyFunc is used to make the key used for queued item insertion and retrieval, and should be deterministic.
+func NewFairQueue[T any](keyFunc container.KeyFunc[T], groupFunc GroupFunc[T], opts ...Option[T]) *FairQueue[T] {
+	o := newOptions(opts...)
+	f := &FairQueue[T]{
+		items:       map[string]*fairGroup[T]{},
+		groups:      map[string]*fairGroup[T]{},
+		active:      list.New[*fairGroup[T]](),
+		keyFunc:     keyFunc,
+		groupFunc:   groupFunc,
+		groupWeight: o.groupWeight,
+		compare:     o.compare,
+		metrics:     newQueueMetrics(o.metricsName, o.metricsProvider, o.clock),
+	}
+	f.cond.L = &f.rw
+	return f
+}
+
+// Close the queue.
+func (f *FairQueue[T]) Close() {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.closed = true
+	f.metrics.stop()
+	f.cond.Broadcast()
+}
+
+// IsClosed checks if the queue is closed.
+func (f *FairQueue[T]) IsClosed() bool {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return f.closed
+}
+
+// HasSynced returns true if an Push/Update/Delete/AddIfNotPresent are called first,
+// or the first batch of items inserted by Replace() has been popped.
+func (f *FairQueue[T]) HasSynced() bool {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	return f.populated && f.initialPopulationCount == 0
+}
+
+// Add inserts an item, and puts it in the queue of its group.
+// The item is only enqueued if it doesn't already exist in the set,
+// unless its group has changed, then it is moved to the end of the new group.
+func (f *FairQueue[T]) Add(obj T) error {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	group := f.groupFunc(obj)
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.populated = true
+	f.addLocked(key, group, obj)
+	return nil
+}
+
+// AddIfNotPresent inserts an item, and puts it in the queue of its group. If the item
+// is already present in the set, it is neither enqueued nor added to the set.
+func (f *FairQueue[T]) AddIfNotPresent(obj T) error {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	group := f.groupFunc(obj)
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.populated = true
+	if _, exists := f.items[key]; !exists {
+		f.addLocked(key, group, obj)
+	}
+	return nil
+}
+
+// Update is the same as Add in this implementation.
+func (f *FairQueue[T]) Update(obj T) error {
+	return f.Add(obj)
+}
+
+// Delete removes an item. It doesn't add it to the queue, because
+// this implementation assumes the consumer only cares about the objects,
+// not the order in which they were created/added. The item is removed
+// from the queue too, like it was popped for HasSynced.
+func (f *FairQueue[T]) Delete(obj T) error {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.populated = true
+	if g, exists := f.items[key]; exists {
+		f.removeLocked(g, g.items[key])
+		f.metrics.remove(key)
+		f.metrics.setDepth(len(f.items))
+	}
+	return nil
+}
+
+// List returns a list of all the items.
+func (f *FairQueue[T]) List() []T {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	r := make([]T, 0, len(f.items))
+	for key, g := range f.items {
+		r = append(r, g.items[key].Value.obj)
+	}
+	return r
+}
+
+// ListKeys returns a list of all the keys of the objects currently
+// in the FairQueue.
+func (f *FairQueue[T]) ListKeys() []string {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return mapKeys(f.items)
+}
+
+// Get returns the requested item, or sets exists=false.
+func (f *FairQueue[T]) Get(obj T) (item T, exists bool, err error) {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return item, false, container.KeyError[T]{Obj: obj, Err: err}
+	}
+	return f.GetByKey(key)
+}
+
+// GetByKey returns the requested item, or sets exists=false.
+func (f *FairQueue[T]) GetByKey(key string) (item T, exists bool, err error) {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	g, exists := f.items[key]
+	if !exists {
+		return item, false, nil
+	}
+	return g.items[key].Value.obj, true, nil
+}
+
+// Groups returns the groups which have items queued, in the order of their turns.
+func (f *FairQueue[T]) Groups() []string {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	r := make([]string, 0, f.active.Len())
+	for e := f.active.Front(); e != nil; e = e.Next() {
+		r = append(r, e.Value.name)
+	}
+	return r
+}
+
+// Pop waits until an item is ready and processes it. The item is taken from
+// the group whose turn it is, in the order in which the items of the group
+// were added/updated. The item is removed from the queue (and the store)
+// before it is processed, so if you don't successfully process it, it should
+// be added back with AddIfNotPresent(). process function is called under lock,
+// so it is safe update data structures in it that need to be in sync with the queue.
+func (f *FairQueue[T]) Pop(process PopProcessFunc[T]) (T, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	for {
+		if item, ok, err := f.popLocked(process); ok {
+			return item, err
+		}
+		if f.closed {
+			var placeholder T
+			return placeholder, ErrFIFOClosed
+		}
+		f.cond.Wait()
+	}
+}
+
+// PopContext is the same as Pop, but it also returns with ctx.Err() once ctx is
+// done while it is blocking. A ready item is always processed first, even if
+// ctx is done.
+func (f *FairQueue[T]) PopContext(ctx context.Context, process PopProcessFunc[T]) (T, error) {
+	stop := context.AfterFunc(ctx, func() {
+		f.rw.Lock()
+		defer f.rw.Unlock()
+		f.cond.Broadcast()
+	})
+	defer stop()
+
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	for {
+		if item, ok, err := f.popLocked(process); ok {
+			return item, err
+		}
+		var placeholder T
+		if f.closed {
+			return placeholder, ErrFIFOClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return placeholder, err
+		}
+		f.cond.Wait()
+	}
+}
+
+// TryPop is the same as Pop, but it never blocks. It returns ErrFIFOEmpty if
+// no item is ready, or ErrFIFOClosed if the queue is closed and no item is ready.
+func (f *FairQueue[T]) TryPop(process PopProcessFunc[T]) (T, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if item, ok, err := f.popLocked(process); ok {
+		return item, err
+	}
+	var placeholder T
+	if f.closed {
+		return placeholder, ErrFIFOClosed
+	}
+	return placeholder, ErrFIFOEmpty
+}
+
+// Replace will delete the contents of 'f', using instead the given list.
+// 'f' takes ownership of the list, you should not reference the list again
+// after calling this function. f's queue is reset, too; upon return, the
+// items of each group are ordered by key or by the function set with
+// WithReplaceOrder, and the groups take their turns in the order of their
+// first items. resourceVersion is recorded as the last sync resource version.
+func (f *FairQueue[T]) Replace(list []T, resourceVersion string) error {
+	objs := make(map[string]T, len(list))
+	keys := make([]string, 0, len(list))
+	for _, item := range list {
+		key, err := f.keyFunc(item)
+		if err != nil {
+			return container.KeyError[T]{Obj: item, Err: err}
+		}
+		if _, exists := objs[key]; !exists {
+			keys = append(keys, key)
+		}
+		objs[key] = item
+	}
+	sortKeys(keys, objs, f.compare)
+	groupNames := make([]string, 0, len(keys))
+	for _, key := range keys {
+		groupNames = append(groupNames, f.groupFunc(objs[key]))
+	}
+
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	oldItems := f.items
+	f.items = make(map[string]*fairGroup[T], len(keys))
+	f.groups = map[string]*fairGroup[T]{}
+	f.active.Init()
+	for i, key := range keys {
+		g := f.groupLocked(groupNames[i])
+		g.items[key] = g.queue.PushBack(fifoEntry[T]{key, objs[key]})
+		f.items[key] = g
+	}
+
+	if !f.populated {
+		f.populated = true
+		f.initialPopulationCount = len(f.items)
+	}
+
+	if f.metrics != nil {
+		for key := range oldItems {
+			if _, exists := f.items[key]; !exists {
+				f.metrics.remove(key)
+			}
+		}
+		for _, key := range keys {
+			if _, exists := oldItems[key]; !exists {
+				f.metrics.add(key)
+			}
+		}
+		f.metrics.setDepth(len(f.items))
+	}
+
+	f.lastSyncResourceVersion = resourceVersion
+	if len(f.items) > 0 {
+		f.cond.Broadcast()
+	}
+	return nil
+}
+
+// LastSyncResourceVersion returns the resource version passed to the last Replace.
+func (f *FairQueue[T]) LastSyncResourceVersion() string {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return f.lastSyncResourceVersion
+}
+
+// Resync will ensure that every object in the Store has its key in the queue.
+// It is a no-op, because that property is maintained by all operations.
+func (f *FairQueue[T]) Resync() error {
+	return nil
+}
+
+// addLocked adds or updates the item of key in group.
+// The caller must hold the lock.
+func (f *FairQueue[T]) addLocked(key, group string, obj T) {
+	g, exists := f.items[key]
+	if exists && g.name == group {
+		g.items[key].Value.obj = obj
+		return
+	}
+	if exists {
+		// the object moved to another group, which it joins at the end.
+		f.unlinkLocked(g, g.items[key])
+	} else {
+		f.metrics.add(key)
+	}
+	g = f.groupLocked(group)
+	g.items[key] = g.queue.PushBack(fifoEntry[T]{key, obj})
+	f.items[key] = g
+	f.metrics.setDepth(len(f.items))
+	f.cond.Broadcast()
+}
+
+// groupLocked returns the group of name, a new group takes the last turn.
+// The caller must hold the lock.
+func (f *FairQueue[T]) groupLocked(name string) *fairGroup[T] {
+	if g, exists := f.groups[name]; exists {
+		return g
+	}
+	g := &fairGroup[T]{
+		name:  name,
+		items: map[string]*list.Element[fifoEntry[T]]{},
+		queue: list.New[fifoEntry[T]](),
+	}
+	g.elem = f.active.PushBack(g)
+	f.groups[name] = g
+	return g
+}
+
+// popLocked pops the first ready item and processes it, it returns false if
+// no item is ready. The caller must hold the lock.
+func (f *FairQueue[T]) popLocked(process PopProcessFunc[T]) (item T, ok bool, err error) {
+	front := f.active.Front()
+	if front == nil {
+		return item, false, nil
+	}
+	g := front.Value
+	if g.deficit <= 0 {
+		// the group starts its turn.
+		g.deficit += f.weight(g.name)
+	}
+	g.deficit--
+	entry := f.removeLocked(g, g.queue.Front())
+	if g.queue.Len() > 0 && g.deficit <= 0 {
+		// the turn is over, the group waits for the others.
+		f.active.MoveToBack(g.elem)
+	}
+	f.metrics.get(entry.key)
+	f.metrics.setDepth(len(f.items))
+
+	if process != nil {
+		err = process(entry.obj)
+	}
+	f.metrics.done(entry.key)
+	if e, ok := err.(ErrRequeue); ok {
+		f.metrics.retry()
+		err = e.Err
+		if _, exists := f.items[entry.key]; !exists {
+			f.addLocked(entry.key, g.name, entry.obj)
+		}
+	}
+	return entry.obj, true, err
+}
+
+// removeLocked removes the element from the group (and the store).
+// The caller must hold the lock.
+func (f *FairQueue[T]) removeLocked(g *fairGroup[T], e *list.Element[fifoEntry[T]]) fifoEntry[T] {
+	if f.initialPopulationCount > 0 {
+		f.initialPopulationCount--
+	}
+	return f.unlinkLocked(g, e)
+}
+
+// unlinkLocked unlinks the element from the group, and drops the group once
+// it is empty. The caller must hold the lock.
+func (f *FairQueue[T]) unlinkLocked(g *fairGroup[T], e *list.Element[fifoEntry[T]]) fifoEntry[T] {
+	entry := g.queue.Remove(e)
+	delete(g.items, entry.key)
+	delete(f.items, entry.key)
+	if g.queue.Len() == 0 {
+		f.active.Remove(g.elem)
+		delete(f.groups, g.name)
+	}
+	return entry
+}
+
+// weight returns the weight of group, at least 1.
+func (f *FairQueue[T]) weight(group string) int {
+	if f.groupWeight == nil {
+		return 1
+	}
+	return max(f.groupWeight(group), 1)
+}
@@ -0,0 +1,164 @@
+package fifo
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testFifoObjectGroupFunc groups the objects by the prefix of their name before "/".
+func testFifoObjectGroupFunc(obj testFifoObject) string {
+	group, _, _ := strings.Cut(obj.name, "/")
+	return group
+}
+
+func popNames(t *testing.T, f *FairQueue[testFifoObject], n int) []string {
+	t.Helper()
+	names := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		obj, err := f.TryPop(nil)
+		if err != nil {
+			t.Fatalf("unexpected error %v after %v pops", err, i)
+		}
+		names = append(names, obj.name)
+	}
+	return names
+}
+
+func Test_FairQueue_roundRobin(t *testing.T) {
+	f := NewFairQueue(testFifoObjectKeyFunc, testFifoObjectGroupFunc)
+	// the noisy group a is queued first.
+	for _, name := range []string{"a/1", "a/2", "a/3", "a/4", "b/1", "c/1", "c/2"} {
+		f.Add(mkFifoObj(name, 1)) // nolint: errcheck
+	}
+	if e, a := []string{"a", "b", "c"}, f.Groups(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected groups %v, got %v", e, a)
+	}
+
+	e := []string{"a/1", "b/1", "c/1", "a/2", "c/2", "a/3", "a/4"}
+	if a := popNames(t, f, len(e)); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if _, err := f.TryPop(nil); err != ErrFIFOEmpty {
+		t.Errorf("expected %v, got %v", ErrFIFOEmpty, err)
+	}
+	if groups := f.Groups(); len(groups) != 0 {
+		t.Errorf("expected the empty groups to be dropped, got %v", groups)
+	}
+}
+
+func Test_FairQueue_weighted(t *testing.T) {
+	weights := map[string]int{"a": 3, "b": 1}
+	f := NewFairQueue(testFifoObjectKeyFunc, testFifoObjectGroupFunc,
+		WithGroupWeight[testFifoObject](func(group string) int { return weights[group] }))
+	for _, name := range []string{"a/1", "a/2", "a/3", "a/4", "a/5", "b/1", "b/2", "c/1"} {
+		f.Add(mkFifoObj(name, 1)) // nolint: errcheck
+	}
+
+	// c has no weight, it is taken as 1.
+	e := []string{"a/1", "a/2", "a/3", "b/1", "c/1", "a/4", "a/5", "b/2"}
+	if a := popNames(t, f, len(e)); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_FairQueue_dedupe(t *testing.T) {
+	f := NewFairQueue(testFifoObjectKeyFunc, func(obj testFifoObject) string { return obj.val.(string) })
+	f.Add(mkFifoObj("foo", "x"))             // nolint: errcheck
+	f.Add(mkFifoObj("bar", "x"))             // nolint: errcheck
+	f.Add(mkFifoObj("baz", "y"))             // nolint: errcheck
+	f.AddIfNotPresent(mkFifoObj("foo", "y")) // nolint: errcheck
+	if item, _, _ := f.GetByKey("foo"); item.val != "x" {
+		t.Errorf("AddIfNotPresent should not update, got %v", item)
+	}
+	// foo moves to the end of group y.
+	f.Update(mkFifoObj("foo", "y")) // nolint: errcheck
+	if e, a := 3, len(f.ListKeys()); e != a {
+		t.Errorf("expected %v items, got %v", e, a)
+	}
+
+	e := []string{"bar", "baz", "foo"}
+	if a := popNames(t, f, len(e)); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_FairQueue_Delete(t *testing.T) {
+	f := NewFairQueue(testFifoObjectKeyFunc, testFifoObjectGroupFunc)
+	f.Add(mkFifoObj("a/1", 1))    // nolint: errcheck
+	f.Add(mkFifoObj("b/1", 1))    // nolint: errcheck
+	f.Add(mkFifoObj("b/2", 1))    // nolint: errcheck
+	f.Delete(mkFifoObj("a/1", 1)) // nolint: errcheck
+	if e, a := []string{"b"}, f.Groups(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected groups %v, got %v", e, a)
+	}
+	if _, exists, _ := f.Get(mkFifoObj("a/1", 1)); exists {
+		t.Errorf("deleted item should not exist")
+	}
+
+	// a group created again takes the last turn.
+	f.Add(mkFifoObj("a/2", 1)) // nolint: errcheck
+	e := []string{"b/1", "a/2", "b/2"}
+	if a := popNames(t, f, len(e)); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_FairQueue_requeue(t *testing.T) {
+	f := NewFairQueue(testFifoObjectKeyFunc, testFifoObjectGroupFunc)
+	f.Add(mkFifoObj("a/1", 1)) // nolint: errcheck
+	f.Add(mkFifoObj("a/2", 1)) // nolint: errcheck
+	f.Add(mkFifoObj("b/1", 1)) // nolint: errcheck
+
+	f.Pop(func(testFifoObject) error { return ErrRequeue{} }) // nolint: errcheck
+	e := []string{"b/1", "a/2", "a/1"}
+	if a := popNames(t, f, len(e)); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_FairQueue_ReplaceAndHasSynced(t *testing.T) {
+	f := NewFairQueue(testFifoObjectKeyFunc, testFifoObjectGroupFunc)
+	f.Add(mkFifoObj("z/1", 1))  // nolint: errcheck
+	f.Replace([]testFifoObject{ // nolint: errcheck
+		mkFifoObj("b/2", 1),
+		mkFifoObj("a/1", 1),
+		mkFifoObj("b/1", 1),
+		mkFifoObj("a/2", 1),
+	}, "3")
+	if e, a := "3", f.LastSyncResourceVersion(); e != a {
+		t.Errorf("expected resource version %v, got %v", e, a)
+	}
+	if e, a := []string{"a", "b"}, f.Groups(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected groups %v, got %v", e, a)
+	}
+
+	f = NewFairQueue(testFifoObjectKeyFunc, testFifoObjectGroupFunc)
+	f.Replace([]testFifoObject{mkFifoObj("a/1", 1), mkFifoObj("b/1", 1)}, "1") // nolint: errcheck
+	if f.HasSynced() {
+		t.Errorf("expected not synced before the first batch is popped")
+	}
+	e := []string{"a/1", "b/1"}
+	if a := popNames(t, f, len(e)); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if !f.HasSynced() {
+		t.Errorf("expected synced once the first batch is popped")
+	}
+}
+
+func Test_FairQueue_PopShouldUnblockWhenClosed(t *testing.T) {
+	f := NewFairQueue(testFifoObjectKeyFunc, testFifoObjectGroupFunc)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := f.Pop(nil)
+		errCh <- err
+	}()
+	f.Close()
+	if err := <-errCh; err != ErrFIFOClosed {
+		t.Errorf("expected %v, got %v", ErrFIFOClosed, err)
+	}
+	if !f.IsClosed() {
+		t.Errorf("expected closed")
+	}
+}
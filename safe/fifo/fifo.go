@@ -1,24 +1,37 @@
 package fifo
 
 import (
+	"context"
 	"errors"
 	"sync"
 
 	"github.com/things-go/container"
+	"github.com/things-go/container/clock"
+	"github.com/things-go/container/comparator"
+	"github.com/things-go/container/go/list"
 )
 
 // ErrFIFOClosed used when FIFO is closed.
 var ErrFIFOClosed = errors.New("fifo: manipulating with closed queue")
 
+// ErrFIFOEmpty used when TryPop is called on an empty FIFO.
+var ErrFIFOEmpty = errors.New("fifo: no item is ready in queue")
+
 // PopProcessFunc is passed to Pop() method of Queue interface.
 // It is supposed to process the accumulator popped from the queue.
 type PopProcessFunc[T any] func(T) error
 
 // ErrRequeue may be returned by a PopProcessFunc to safely requeue
 // the current item. The value of Err will be returned from Pop.
+//
+// It may also be returned by the process function of PopBatch to requeue
+// all or part of the batch.
 type ErrRequeue struct {
 	// Err is returned by the Pop function
 	Err error
+	// Indexes of the items in the batch which should be requeued,
+	// empty means the whole batch. It is only used by PopBatch.
+	Indexes []int
 }
 
 // Error implement error interface
@@ -49,6 +62,15 @@ type Queue[T any] interface {
 	// Pop.
 	Pop(PopProcessFunc[T]) (T, error)
 
+	// PopContext is the same as Pop, but it also returns with ctx.Err()
+	// once ctx is done while it is blocking.
+	PopContext(context.Context, PopProcessFunc[T]) (T, error)
+
+	// TryPop is the same as Pop, but it never blocks. It returns
+	// ErrFIFOEmpty if there is no key to process, or ErrFIFOClosed if
+	// the Queue is closed and there is no key to process.
+	TryPop(PopProcessFunc[T]) (T, error)
+
 	// AddIfNotPresent puts the given accumulator into the Queue (in
 	// association with the accumulator's key) if and only if that key
 	// is not already associated with a non-empty accumulator.
@@ -100,9 +122,12 @@ var _ Queue[int] = (*FIFO[int])(nil)
 type FIFO[T any] struct {
 	rw   sync.RWMutex
 	cond sync.Cond
-	// We depend on the property that every key in `items` is also in `queue`
-	items map[string]T
-	queue []string
+	// `items` maps a key to its element in `queue`, `queue` maintains
+	// FIFO order of the items for consumption in Pop().
+	// A key is in `items` if and only if it is in `queue`, so Delete
+	// unlinks the element in O(1) and no stale key is left behind.
+	items map[string]*list.Element[fifoEntry[T]]
+	queue *list.List[fifoEntry[T]]
 
 	// populated is true if the first batch of items inserted by Replace() has been populated
 	// or Delete/Push/Update was called first.
@@ -114,19 +139,66 @@ type FIFO[T any] struct {
 	// should be deterministic.
 	keyFunc container.KeyFunc[T]
 
+	// compare is used to order the keys queued by Replace(), default by key.
+	compare comparator.Comparable[T]
+	// lastSyncResourceVersion is the resource version passed to the last Replace().
+	lastSyncResourceVersion string
+	// metrics of the queue, nil if no MetricsProvider is set.
+	metrics *queueMetrics
+	// journal persists the operations of the queue, nil if it is not durable.
+	journal *journal[T]
+	// maxRequeues is the number of times an item can be requeued before it
+	// is dead-lettered, negative means unlimited.
+	maxRequeues int
+	// requeues counts the requeues of the keys, if maxRequeues is set.
+	requeues map[string]int
+	// deadLetters holds the dead-lettered items.
+	deadLetters container.Store[DeadLetter[T]]
+	// clock runs the timers of the leases.
+	clock clock.Clock
+	// leases holds the leased items by their lease IDs, and leasedKeys by their keys.
+	leases     map[LeaseID]*fifoLease[T]
+	leasedKeys map[string]*fifoLease[T]
+	// nextLeaseID is the ID of the last lease.
+	nextLeaseID LeaseID
+	// inFlight counts the items of the keys popped by Run, which are
+	// processed outside of the lock until Run calls Requeue or Forget.
+	inFlight map[string]int
+
 	// Indication the queue is closed.
 	// Used to indicate a queue is closed so a control loop can exit when a queue is empty.
 	// Currently, not used to gate any of CRED operations.
 	closed bool
+	// draining is true once ShutDownWithDrain is called, new items are rejected.
+	draining bool
+}
+
+// fifoEntry is an item in the queue of FIFO.
+type fifoEntry[T any] struct {
+	key string
+	obj T
 }
 
 // New returns a Store which can be used to queue up items to process.
 // keyFunc is used to make the key used for queued item insertion and retrieval, and should be deterministic.
-func New[T any](keyFunc container.KeyFunc[T]) *FIFO[T] {
+func New[T any](keyFunc container.KeyFunc[T], opts ...Option[T]) *FIFO[T] {
+	o := newOptions(opts...)
 	f := &FIFO[T]{
-		items:   map[string]T{},
-		queue:   []string{},
-		keyFunc: keyFunc,
+		items:       map[string]*list.Element[fifoEntry[T]]{},
+		queue:       list.New[fifoEntry[T]](),
+		keyFunc:     keyFunc,
+		compare:     o.compare,
+		metrics:     newQueueMetrics(o.metricsName, o.metricsProvider, o.clock),
+		maxRequeues: o.maxRequeues,
+		requeues:    map[string]int{},
+		deadLetters: o.deadLetters,
+		clock:       o.clock,
+		leases:      map[LeaseID]*fifoLease[T]{},
+		leasedKeys:  map[string]*fifoLease[T]{},
+		inFlight:    map[string]int{},
+	}
+	if f.deadLetters == nil {
+		f.deadLetters = newDeadLetterStore[T]()
 	}
 	f.cond.L = &f.rw
 	return f
@@ -137,7 +209,45 @@ func (f *FIFO[T]) Close() {
 	f.rw.Lock()
 	defer f.rw.Unlock()
 	f.closed = true
+	f.stopLeasesLocked()
+	f.metrics.stop()
+	f.journal.close() // nolint: errcheck
+	f.cond.Broadcast()
+}
+
+// ShutDownWithDrain stops accepting new items, Add, Update, AddIfNotPresent
+// and Replace return ErrFIFOClosed from now on, while the consumers keep
+// popping the queued items. It blocks until the queue is empty and no item is
+// in flight, then closes the queue. An item popped by Run is in flight until
+// Run calls Requeue or Forget, and a leased item until it is acked, or nacked
+// or expired and drained. The items requeued with ErrRequeue or Requeue are
+// still accepted and drained.
+// If ctx is done first, the queue is closed with the remaining items in it
+// and ctx.Err() is returned.
+func (f *FIFO[T]) ShutDownWithDrain(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		f.rw.Lock()
+		defer f.rw.Unlock()
+		f.cond.Broadcast()
+	})
+	defer stop()
+
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.draining = true
+	var err error
+	for (len(f.items) > 0 || len(f.leases) > 0 || len(f.inFlight) > 0) && !f.closed {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		f.cond.Wait()
+	}
+	f.closed = true
+	f.stopLeasesLocked()
+	f.metrics.stop()
+	f.journal.close() // nolint: errcheck
 	f.cond.Broadcast()
+	return err
 }
 
 // HasSynced returns true if an Push/Update/Delete/AddIfNotPresent are called first,
@@ -150,6 +260,8 @@ func (f *FIFO[T]) HasSynced() bool {
 
 // Add inserts an item, and puts it in the queue.
 // The item is only enqueued if it doesn't already exist in the set.
+// If its key is leased, it is enqueued once the lease ends, see Lease.
+// It returns ErrFIFOClosed once ShutDownWithDrain is called.
 func (f *FIFO[T]) Add(obj T) error {
 	key, err := f.keyFunc(obj)
 	if err != nil {
@@ -157,11 +269,25 @@ func (f *FIFO[T]) Add(obj T) error {
 	}
 	f.rw.Lock()
 	defer f.rw.Unlock()
+	if f.draining {
+		return ErrFIFOClosed
+	}
+	if f.deferLeasedLocked(key, obj, true) {
+		f.populated = true
+		return nil
+	}
+	if err = f.journal.add(key, obj); err != nil {
+		return err
+	}
 	f.populated = true
-	if _, exists := f.items[key]; !exists {
-		f.queue = append(f.queue, key)
+	if e, exists := f.items[key]; exists {
+		e.Value.obj = obj
+	} else {
+		f.items[key] = f.queue.PushBack(fifoEntry[T]{key, obj})
+		f.metrics.add(key)
 	}
-	f.items[key] = obj
+	f.metrics.setDepth(len(f.items))
+	f.journal.maybeCompact(f.queue)
 	f.cond.Broadcast()
 	return nil
 }
@@ -171,7 +297,7 @@ func (f *FIFO[T]) Add(obj T) error {
 //
 // This is useful in a single producer/consumer scenario so that the consumer can
 // safely retry items without contending with the producer and potentially enqueueing
-// stale items.
+// stale items. It returns ErrFIFOClosed once ShutDownWithDrain is called.
 func (f *FIFO[T]) AddIfNotPresent(obj T) error {
 	key, err := f.keyFunc(obj)
 	if err != nil {
@@ -179,21 +305,33 @@ func (f *FIFO[T]) AddIfNotPresent(obj T) error {
 	}
 	f.rw.Lock()
 	defer f.rw.Unlock()
-	f.addIfNotPresent(key, obj)
-	return nil
+	if f.draining {
+		return ErrFIFOClosed
+	}
+	if f.deferLeasedLocked(key, obj, false) {
+		f.populated = true
+		return nil
+	}
+	return f.addIfNotPresent(key, obj)
 }
 
 // addIfNotPresent assumes the fifo lock is already held and adds the provided
 // item to the queue under id if it does not already exist.
-func (f *FIFO[T]) addIfNotPresent(key string, obj T) {
+func (f *FIFO[T]) addIfNotPresent(key string, obj T) error {
 	f.populated = true
 	if _, exists := f.items[key]; exists {
-		return
+		return nil
+	}
+	if err := f.journal.add(key, obj); err != nil {
+		return err
 	}
 
-	f.queue = append(f.queue, key)
-	f.items[key] = obj
+	f.items[key] = f.queue.PushBack(fifoEntry[T]{key, obj})
+	f.metrics.add(key)
+	f.metrics.setDepth(len(f.items))
+	f.journal.maybeCompact(f.queue)
 	f.cond.Broadcast()
+	return nil
 }
 
 // Update is the same as Add in this implementation.
@@ -203,7 +341,8 @@ func (f *FIFO[T]) Update(obj T) error {
 
 // Delete removes an item. It doesn't add it to the queue, because
 // this implementation assumes the consumer only cares about the objects,
-// not the order in which they were created/added.
+// not the order in which they were created/added. The item is removed
+// from the queue too, like it was popped for HasSynced.
 func (f *FIFO[T]) Delete(obj T) error {
 	id, err := f.keyFunc(obj)
 	if err != nil {
@@ -212,15 +351,32 @@ func (f *FIFO[T]) Delete(obj T) error {
 	f.rw.Lock()
 	defer f.rw.Unlock()
 	f.populated = true
-	delete(f.items, id)
-	return err
+	delete(f.requeues, id)
+	f.deleteLeasedLocked(id)
+	if e, exists := f.items[id]; exists {
+		if err = f.journal.delete(id); err != nil {
+			return err
+		}
+		f.removeLocked(e)
+		f.metrics.remove(id)
+		f.metrics.setDepth(len(f.items))
+		f.journal.maybeCompact(f.queue)
+		if f.draining {
+			f.cond.Broadcast()
+		}
+	}
+	return nil
 }
 
 // List returns a list of all the items.
 func (f *FIFO[T]) List() []T {
 	f.rw.RLock()
 	defer f.rw.RUnlock()
-	return mapValues(f.items)
+	r := make([]T, 0, len(f.items))
+	for _, e := range f.items {
+		r = append(r, e.Value.obj)
+	}
+	return r
 }
 
 // ListKeys returns a list of all the keys of the objects currently
@@ -244,8 +400,11 @@ func (f *FIFO[T]) Get(obj T) (item T, exists bool, err error) {
 func (f *FIFO[T]) GetByKey(key string) (item T, exists bool, err error) {
 	f.rw.RLock()
 	defer f.rw.RUnlock()
-	item, exists = f.items[key]
-	return item, exists, nil
+	e, exists := f.items[key]
+	if !exists {
+		return item, false, nil
+	}
+	return e.Value.obj, true, nil
 }
 
 // IsClosed checks if the queue is closed.
@@ -262,106 +421,298 @@ func (f *FIFO[T]) IsClosed() bool {
 // AddIfNotPresent(). process function is called under lock, so it is safe
 // update data structures in it that need to be in sync with the queue.
 func (f *FIFO[T]) Pop(process PopProcessFunc[T]) (T, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	for {
+		if item, ok, err := f.popLocked(process); ok {
+			return item, err
+		}
+		// When the queue is empty, invocation of Pop() is blocked until new item is enqueued.
+		// When Close() is called, the f.closed is set and the condition is broadcasted.
+		// Which causes this loop to continue and return from the Pop().
+		if f.closed {
+			var placeholder T
+			return placeholder, ErrFIFOClosed
+		}
+		f.cond.Wait()
+	}
+}
+
+// PopContext is the same as Pop, but it also returns with ctx.Err() once ctx is
+// done while it is blocking. A ready item is always processed first, even if
+// ctx is done.
+func (f *FIFO[T]) PopContext(ctx context.Context, process PopProcessFunc[T]) (T, error) {
+	// wake up the waiters once ctx is done, the lock makes sure that the
+	// broadcast can not happen between checking ctx.Err() and f.cond.Wait().
+	stop := context.AfterFunc(ctx, func() {
+		f.rw.Lock()
+		defer f.rw.Unlock()
+		f.cond.Broadcast()
+	})
+	defer stop()
+
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	for {
+		if item, ok, err := f.popLocked(process); ok {
+			return item, err
+		}
+		var placeholder T
+		if f.closed {
+			return placeholder, ErrFIFOClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return placeholder, err
+		}
+		f.cond.Wait()
+	}
+}
+
+// TryPop is the same as Pop, but it never blocks. It returns ErrFIFOEmpty if
+// no item is ready, or ErrFIFOClosed if the queue is closed and no item is ready.
+func (f *FIFO[T]) TryPop(process PopProcessFunc[T]) (T, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if item, ok, err := f.popLocked(process); ok {
+		return item, err
+	}
 	var placeholder T
+	if f.closed {
+		return placeholder, ErrFIFOClosed
+	}
+	return placeholder, ErrFIFOEmpty
+}
 
+// PopBatch waits until at least one item is ready and processes up to max
+// ready items as a batch, max <= 0 means all the ready items. The items are
+// in the order in which they were added/updated. Like Pop, the items are
+// removed from the queue (and the store) before they are processed, and
+// process function is called under lock.
+// The process function may return an ErrRequeue, in this case the items
+// selected by its Indexes are requeued in that order (the whole batch in batch
+// order if empty), and the inner error is returned from PopBatch.
+func (f *FIFO[T]) PopBatch(max int, process func([]T) error) ([]T, error) {
 	f.rw.Lock()
 	defer f.rw.Unlock()
+
+	var keys []string
+	var items []T
 	for {
-		for len(f.queue) == 0 {
-			// When the queue is empty, invocation of Pop() is blocked until new item is enqueued.
-			// When Close() is called, the f.closed is set and the condition is broadcasted.
-			// Which causes this loop to continue and return from the Pop().
-			if f.closed {
-				return placeholder, ErrFIFOClosed
+		var popErr error
+		for max <= 0 || len(items) < max {
+			var key string
+			var item T
+			var ok bool
+			key, item, ok, popErr = f.popItemLocked()
+			if !ok {
+				break
 			}
-
-			f.cond.Wait()
+			keys = append(keys, key)
+			items = append(items, item)
+		}
+		if len(items) > 0 {
+			break
+		}
+		if popErr != nil {
+			return nil, popErr
 		}
-		key := f.queue[0]
-		f.queue = f.queue[1:]
-		if f.initialPopulationCount > 0 {
-			f.initialPopulationCount--
+		// When the queue is empty, invocation of PopBatch() is blocked until new item is enqueued.
+		if f.closed {
+			return nil, ErrFIFOClosed
 		}
-		item, ok := f.items[key]
-		if !ok { // Item may have been deleted subsequently.
-			continue
+		f.cond.Wait()
+	}
+
+	var err error
+	if process != nil {
+		err = process(items)
+	}
+	for _, key := range keys {
+		f.metrics.done(key)
+	}
+	e, ok := err.(ErrRequeue)
+	if !ok {
+		for _, key := range keys {
+			delete(f.requeues, key)
 		}
-		delete(f.items, key)
-
-		var err error
-		if process != nil {
-			err = process(item)
-			if e, ok := err.(ErrRequeue); ok {
-				f.addIfNotPresent(key, item)
-				err = e.Err
+		return items, err
+	}
+	err = e.Err
+	indexes := e.Indexes
+	if len(indexes) == 0 {
+		indexes = make([]int, len(keys))
+		for i := range indexes {
+			indexes[i] = i
+		}
+	}
+	requeued := make(map[int]bool, len(indexes))
+	for _, i := range indexes {
+		if i >= 0 && i < len(keys) && !requeued[i] {
+			requeued[i] = true
+			if addErr := f.requeueLocked(keys[i], items[i], e.Err); addErr != nil {
+				err = addErr
 			}
 		}
-		return item, err
 	}
+	for i, key := range keys {
+		if !requeued[i] {
+			delete(f.requeues, key)
+		}
+	}
+	return items, err
+}
+
+// popLocked pops the first ready item and processes it, it returns false if
+// no item is ready. The caller must hold the lock.
+// A ready item which can not be popped is reported with true and the error.
+func (f *FIFO[T]) popLocked(process PopProcessFunc[T]) (item T, ok bool, err error) {
+	key, item, ok, err := f.popItemLocked()
+	if !ok {
+		return item, err != nil, err
+	}
+	if process != nil {
+		err = process(item)
+	}
+	if err == errPopped {
+		// the item is done once Run releases it.
+		f.inFlight[key]++
+		return item, true, nil
+	}
+	f.metrics.done(key)
+	if e, ok := err.(ErrRequeue); ok {
+		err = e.Err
+		if addErr := f.requeueLocked(key, item, e.Err); addErr != nil {
+			err = addErr
+		}
+	} else {
+		// processed, the requeues of Run are counted until it calls Forget.
+		delete(f.requeues, key)
+	}
+	return item, true, err
+}
+
+// popItemLocked removes the first ready item from the queue (and the store),
+// it returns false if no item is ready, or with the error if the pop can not
+// be persisted, in which case the item stays in the queue.
+// The caller must hold the lock.
+func (f *FIFO[T]) popItemLocked() (key string, item T, ok bool, err error) {
+	e := f.queue.Front()
+	if e == nil {
+		return "", item, false, nil
+	}
+	if err = f.journal.pop(e.Value.key); err != nil {
+		return "", item, false, err
+	}
+	entry := f.removeLocked(e)
+	f.journal.maybeCompact(f.queue)
+	f.metrics.get(entry.key)
+	f.metrics.setDepth(len(f.items))
+	if f.draining {
+		// wake up ShutDownWithDrain, which checks the queue once
+		// the item is processed and the lock is released.
+		f.cond.Broadcast()
+	}
+	return entry.key, entry.obj, true, nil
 }
 
-// Replace will delete the contents of 'f', using instead the given map.
-// 'f' takes ownership of the map, you should not reference the map again
+// removeLocked removes the element from the queue (and the store).
+// The caller must hold the lock.
+func (f *FIFO[T]) removeLocked(e *list.Element[fifoEntry[T]]) fifoEntry[T] {
+	entry := f.queue.Remove(e)
+	delete(f.items, entry.key)
+	if f.initialPopulationCount > 0 {
+		f.initialPopulationCount--
+	}
+	return entry
+}
+
+// Replace will delete the contents of 'f', using instead the given list.
+// 'f' takes ownership of the list, you should not reference the list again
 // after calling this function. f's queue is reset, too; upon return, it
-// will contain the items in the map, in no particular order.
-func (f *FIFO[T]) Replace(list []T, _ string) error {
-	items := make(map[string]T, len(list))
+// will contain the items in the list, ordered by key or by the function
+// set with WithReplaceOrder. The replacement is atomic with respect to
+// concurrent readers, and resourceVersion is recorded as the last sync
+// resource version.
+func (f *FIFO[T]) Replace(list []T, resourceVersion string) error {
+	objs := make(map[string]T, len(list))
+	keys := make([]string, 0, len(list))
 	for _, item := range list {
 		key, err := f.keyFunc(item)
 		if err != nil {
 			return container.KeyError[T]{Obj: item, Err: err}
 		}
-		items[key] = item
+		if _, exists := objs[key]; !exists {
+			keys = append(keys, key)
+		}
+		objs[key] = item
 	}
+	sortKeys(keys, objs, f.compare)
+	items, queue := newFIFOQueue(keys, objs)
 
 	f.rw.Lock()
 	defer f.rw.Unlock()
+	if f.draining {
+		return ErrFIFOClosed
+	}
+	keys = f.replaceLeasedLocked(keys, items, queue)
+	if err := f.journal.compact(queue); err != nil {
+		return err
+	}
 
 	if !f.populated {
 		f.populated = true
 		f.initialPopulationCount = len(items)
 	}
 
-	f.items = items
-	f.queue = f.queue[:0]
-	for key := range items {
-		f.queue = append(f.queue, key)
-	}
-	if len(f.queue) > 0 {
-		f.cond.Broadcast()
+	if f.metrics != nil {
+		for key := range f.items {
+			if _, exists := items[key]; !exists {
+				f.metrics.remove(key)
+			}
+		}
+		for _, key := range keys {
+			if _, exists := f.items[key]; !exists {
+				f.metrics.add(key)
+			}
+		}
+		f.metrics.setDepth(len(items))
 	}
-	return nil
-}
 
-// Resync will ensure that every object in the Store has its key in the queue.
-// This should be a no-op, because that property is maintained by all operations.
-func (f *FIFO[T]) Resync() error {
-	f.rw.Lock()
-	defer f.rw.Unlock()
-
-	inQueue := make(map[string]struct{}, len(f.queue))
-	for _, v := range f.queue {
-		inQueue[v] = struct{}{}
-	}
-	for key := range f.items {
-		if _, ok := inQueue[key]; !ok {
-			f.queue = append(f.queue, key)
+	for key := range f.requeues {
+		if _, exists := items[key]; !exists && f.leasedKeys[key] == nil && f.inFlight[key] == 0 {
+			delete(f.requeues, key)
 		}
 	}
-	if len(f.queue) > 0 {
+	f.items = items
+	f.queue = queue
+	f.lastSyncResourceVersion = resourceVersion
+	if len(f.items) > 0 {
 		f.cond.Broadcast()
 	}
 	return nil
 }
 
-// MapValues returns the values of the map m.
-// The values will be in an indeterminate order.
-func mapValues[M ~map[K]V, K comparable, V any](m M) []V {
-	r := make([]V, 0, len(m))
-	for _, v := range m {
-		r = append(r, v)
+// newFIFOQueue returns the items and the queue of FIFO, which holds objs in the order of keys.
+func newFIFOQueue[T any](keys []string, objs map[string]T) (map[string]*list.Element[fifoEntry[T]], *list.List[fifoEntry[T]]) {
+	items := make(map[string]*list.Element[fifoEntry[T]], len(keys))
+	queue := list.New[fifoEntry[T]]()
+	for _, key := range keys {
+		items[key] = queue.PushBack(fifoEntry[T]{key, objs[key]})
 	}
-	return r
+	return items, queue
+}
+
+// LastSyncResourceVersion returns the resource version passed to the last Replace.
+func (f *FIFO[T]) LastSyncResourceVersion() string {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return f.lastSyncResourceVersion
+}
+
+// Resync will ensure that every object in the Store has its key in the queue.
+// It is a no-op, because that property is maintained by all operations.
+func (f *FIFO[T]) Resync() error {
+	return nil
 }
 
 // mapKeys returns the keys of the map m.
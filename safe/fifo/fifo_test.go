@@ -1,6 +1,8 @@
 package fifo
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"runtime"
@@ -160,6 +162,62 @@ func Test_FIFO_addReplace(t *testing.T) {
 	}
 }
 
+func Test_FIFO_Replace(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+	f.Add(mkFifoObj("zoo", 1)) // nolint: errcheck
+	err := f.Replace([]testFifoObject{
+		mkFifoObj("c", 3), mkFifoObj("a", 1), mkFifoObj("b", 2), mkFifoObj("a", 10),
+	}, "5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := "5", f.LastSyncResourceVersion(); e != a {
+		t.Errorf("expected resource version %v, got %v", e, a)
+	}
+	// queued by key, the last duplicate wins.
+	for _, expected := range []testFifoObject{mkFifoObj("a", 10), mkFifoObj("b", 2), mkFifoObj("c", 3)} {
+		if e, a := expected, Pop[testFifoObject](f); e != a {
+			t.Errorf("expected %v, got %v", e, a)
+		}
+	}
+	if _, err := f.TryPop(nil); !errors.Is(err, ErrFIFOEmpty) {
+		t.Errorf("expected %v, got %v", ErrFIFOEmpty, err)
+	}
+
+	// the failed replace leaves the queue unchanged.
+	f = New(func(obj testFifoObject) (string, error) {
+		if obj.name == "" {
+			return "", errors.New("empty name")
+		}
+		return obj.name, nil
+	})
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+	if err := f.Replace([]testFifoObject{mkFifoObj("bar", 2), {}}, "6"); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if e, a := []string{"foo"}, f.ListKeys(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+	if e, a := "", f.LastSyncResourceVersion(); e != a {
+		t.Errorf("expected resource version %v, got %v", e, a)
+	}
+}
+
+func Test_FIFO_ReplaceOrder(t *testing.T) {
+	f := New(testFifoObjectKeyFunc, WithReplaceOrder(func(a, b testFifoObject) int {
+		return b.val.(int) - a.val.(int)
+	}))
+	f.Replace([]testFifoObject{ // nolint: errcheck
+		mkFifoObj("a", 1), mkFifoObj("b", 3), mkFifoObj("c", 2), mkFifoObj("d", 3),
+	}, "1")
+	// descending by value, equal values by key.
+	for _, expected := range []string{"b", "d", "c", "a"} {
+		if e, a := expected, Pop[testFifoObject](f).name; e != a {
+			t.Errorf("expected %v, got %v", e, a)
+		}
+	}
+}
+
 func Test_FIFO_detectLineJumpers(t *testing.T) {
 	f := New[testFifoObject](testFifoObjectKeyFunc)
 
@@ -281,6 +339,16 @@ func Test_FIFO_HasSynced(t *testing.T) {
 			},
 			expectedSynced: true,
 		},
+		{
+			actions: []func(f *FIFO[testFifoObject]){
+				func(f *FIFO[testFifoObject]) {
+					f.Replace([]testFifoObject{mkFifoObj("a", 1), mkFifoObj("b", 2)}, "0") // nolint: errcheck
+				},
+				func(f *FIFO[testFifoObject]) { Pop[testFifoObject](f) },
+				func(f *FIFO[testFifoObject]) { f.Delete(mkFifoObj("b", 0)) }, // nolint: errcheck
+			},
+			expectedSynced: true,
+		},
 	}
 
 	for i, test := range tests {
@@ -332,3 +400,250 @@ func Test_FIFO_Resync(t *testing.T) {
 		t.Fatalf("expected value nil, got %d", err)
 	}
 }
+
+func Test_FIFO_PopContext(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+
+	// ready item is popped even if ctx is done.
+	f.Add(mkFifoObj("foo", 10)) // nolint: errcheck
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	obj, err := f.PopContext(ctx, nil)
+	if err != nil || obj.val != 10 {
+		t.Fatalf("expected foo, got %v %v", obj, err)
+	}
+
+	// canceled while waiting.
+	ctx, cancel = context.WithCancel(context.Background())
+	c := make(chan error, 1)
+	go func() {
+		_, err := f.PopContext(ctx, nil)
+		c <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-c:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context canceled, got %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatalf("timed out waiting for PopContext to return after cancel")
+	}
+
+	// timeout
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err = f.PopContext(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// item arrives while waiting.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Add(mkFifoObj("bar", 11)) // nolint: errcheck
+	}()
+	obj, err = f.PopContext(context.Background(), nil)
+	if err != nil || obj.val != 11 {
+		t.Fatalf("expected bar, got %v %v", obj, err)
+	}
+
+	// closed
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Close()
+	}()
+	if _, err = f.PopContext(context.Background(), nil); !errors.Is(err, ErrFIFOClosed) {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+}
+
+func Test_FIFO_TryPop(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+
+	if _, err := f.TryPop(nil); !errors.Is(err, ErrFIFOEmpty) {
+		t.Fatalf("expected empty error, got %v", err)
+	}
+
+	f.Add(mkFifoObj("foo", 10))    // nolint: errcheck
+	f.Add(mkFifoObj("bar", 11))    // nolint: errcheck
+	f.Delete(mkFifoObj("foo", 10)) // nolint: errcheck
+	obj, err := f.TryPop(func(obj testFifoObject) error {
+		return ErrRequeue{Err: fmt.Errorf("test error")}
+	})
+	if err == nil || err.Error() != "test error" || obj.val != 11 {
+		t.Fatalf("unexpected result: %v %v", obj, err)
+	}
+	if obj, err = f.TryPop(nil); err != nil || obj.val != 11 {
+		t.Fatalf("unexpected result: %v %v", obj, err)
+	}
+
+	f.Close()
+	if _, err := f.TryPop(nil); !errors.Is(err, ErrFIFOClosed) {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+}
+
+func Test_FIFO_PopBatch(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+
+	for i := 0; i < 5; i++ {
+		f.Add(mkFifoObj(fmt.Sprintf("foo%d", i), i)) // nolint: errcheck
+	}
+	f.Delete(mkFifoObj("foo1", 1)) // nolint: errcheck
+
+	batch, err := f.PopBatch(3, func(items []testFifoObject) error {
+		if len(items) != 3 {
+			t.Fatalf("expected batch of 3, got %v", items)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := []testFifoObject{mkFifoObj("foo0", 0), mkFifoObj("foo2", 2), mkFifoObj("foo3", 3)}, batch; !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %+v, got %+v", e, a)
+	}
+
+	// requeue part of the batch
+	f.Add(mkFifoObj("foo5", 5)) // nolint: errcheck
+	f.Add(mkFifoObj("foo6", 6)) // nolint: errcheck
+	batch, err = f.PopBatch(0, func(items []testFifoObject) error {
+		return ErrRequeue{Err: fmt.Errorf("test error"), Indexes: []int{2, 0, 10}}
+	})
+	if err == nil || err.Error() != "test error" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := 3, len(batch); e != a {
+		t.Fatalf("expected batch length %d, got %d", e, a)
+	}
+	// requeued in the order of indexes.
+	if e, a := []int{6, 4}, []int{Pop[testFifoObject](f).val.(int), Pop[testFifoObject](f).val.(int)}; !reflect.DeepEqual(e, a) {
+		t.Errorf("Expected %+v, got %+v", e, a)
+	}
+
+	// requeue the whole batch
+	f.Add(mkFifoObj("foo7", 7)) // nolint: errcheck
+	f.Add(mkFifoObj("foo8", 8)) // nolint: errcheck
+	if _, err = f.PopBatch(10, func([]testFifoObject) error { return ErrRequeue{} }); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e, a := 2, len(f.items); e != a {
+		t.Fatalf("expected queue length %d, got %d", e, a)
+	}
+	if batch, _ = f.PopBatch(10, nil); len(batch) != 2 {
+		t.Fatalf("expected batch of 2, got %v", batch)
+	}
+
+	// block until an item is ready
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		f.Add(mkFifoObj("foo9", 9)) // nolint: errcheck
+	}()
+	if batch, err = f.PopBatch(10, nil); err != nil || len(batch) != 1 {
+		t.Fatalf("unexpected result: %v %v", batch, err)
+	}
+
+	f.Close()
+	if _, err = f.PopBatch(10, nil); !errors.Is(err, ErrFIFOClosed) {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+}
+
+func Test_FIFO_ShutDownWithDrain(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+	for i := 0; i < 10; i++ {
+		f.Add(mkFifoObj(fmt.Sprintf("foo%d", i), i)) // nolint: errcheck
+	}
+
+	drained := make(chan error, 1)
+	go func() {
+		drained <- f.ShutDownWithDrain(context.Background())
+	}()
+	for {
+		if err := f.Add(mkFifoObj("bar", 1)); err != nil {
+			if !errors.Is(err, ErrFIFOClosed) {
+				t.Fatalf("expected %v, got %v", ErrFIFOClosed, err)
+			}
+			break
+		}
+		f.Delete(mkFifoObj("bar", 1)) // nolint: errcheck
+		runtime.Gosched()
+	}
+	if err := f.Replace([]testFifoObject{mkFifoObj("bar", 1)}, "1"); !errors.Is(err, ErrFIFOClosed) {
+		t.Errorf("expected %v, got %v", ErrFIFOClosed, err)
+	}
+
+	requeued := false
+	popped := 0
+	for {
+		_, err := f.Pop(func(obj testFifoObject) error {
+			select {
+			case <-drained:
+				t.Errorf("drained with in-flight item %v", obj.name)
+			default:
+			}
+			// the requeued item is still drained.
+			if obj.name == "foo5" && !requeued {
+				requeued = true
+				return ErrRequeue{}
+			}
+			popped++
+			return nil
+		})
+		if errors.Is(err, ErrFIFOClosed) {
+			break
+		}
+	}
+	if e, a := 10, popped; e != a {
+		t.Errorf("expected %v items popped, got %v", e, a)
+	}
+	if err := <-drained; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if !f.IsClosed() {
+		t.Errorf("expected the queue closed")
+	}
+}
+
+func Test_FIFO_ShutDownWithDrainTimeout(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := f.ShutDownWithDrain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if !f.IsClosed() {
+		t.Errorf("expected the queue closed")
+	}
+	// the remaining item is still in the queue.
+	if e, a := 1, len(f.List()); e != a {
+		t.Errorf("expected %v items, got %v", e, a)
+	}
+}
+
+func Test_FIFO_deleteLeavesNoStaleKeys(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+	for i := 0; i < 1000; i++ {
+		f.Add(mkFifoObj(fmt.Sprintf("foo%d", i), i)) // nolint: errcheck
+		if i%2 == 0 {
+			f.Delete(mkFifoObj(fmt.Sprintf("foo%d", i), i)) // nolint: errcheck
+		}
+	}
+	if e, a := 500, f.queue.Len(); e != a {
+		t.Errorf("expected %v keys in queue, got %v", e, a)
+	}
+	for i := 1; i < 1000; i += 2 {
+		if e, a := fmt.Sprintf("foo%d", i), Pop[testFifoObject](f).name; e != a {
+			t.Fatalf("expected %v, got %v", e, a)
+		}
+	}
+	if e, a := 0, f.queue.Len(); e != a {
+		t.Errorf("expected %v keys in queue, got %v", e, a)
+	}
+	if _, err := f.TryPop(nil); !errors.Is(err, ErrFIFOEmpty) {
+		t.Errorf("expected %v, got %v", ErrFIFOEmpty, err)
+	}
+}
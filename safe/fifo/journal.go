@@ -0,0 +1,388 @@
+package fifo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/things-go/container/go/list"
+)
+
+// ErrCorruptSnapshot used when the snapshot of a durable FIFO can not be decoded.
+var ErrCorruptSnapshot = errors.New("fifo: corrupt snapshot")
+
+// ErrCorruptLog used when a record in the middle of the log of a durable FIFO
+// does not match its checksum, or an intact record can not be decoded.
+var ErrCorruptLog = errors.New("fifo: corrupt log")
+
+// the operations of the records.
+const (
+	opAdd byte = iota + 1
+	opDelete
+	opPop
+	opSnapshot
+)
+
+const (
+	snapshotFileName = "snapshot"
+	walFilePrefix    = "wal-"
+	// recordHeaderSize is the size of length and checksum of a record.
+	recordHeaderSize = 8
+	// defaultCompactThreshold is the default number of the records in the log
+	// which triggers a compaction.
+	defaultCompactThreshold = 1000
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// journal persists the operations of a FIFO into a write-ahead log, which is
+// compacted into a snapshot once it grows too long. A nil *journal persists
+// nothing. It is not thread-safe, the FIFO calls it under its lock.
+//
+// Every record is framed as: length(uint32) | crc32c(uint32) | payload.
+// The log of generation N is only valid on top of the snapshot of generation N,
+// so a crash in the middle of a compaction leaves the previous pair in effect.
+type journal[T any] struct {
+	dir   string
+	codec Codec[T]
+	// sync calls fsync after every record.
+	sync bool
+	// compactThreshold is the number of the records in the log which triggers a compaction.
+	compactThreshold int
+
+	// gen is the generation of the snapshot and the log.
+	gen uint64
+	wal *os.File
+	// records is the number of the records in the log.
+	records int
+	buf     []byte
+}
+
+// openJournal opens the journal in dir, and replays the snapshot and the log
+// into the returned items and queue. A torn record at the end of the log,
+// left by a crash in the middle of a write, is truncated, while a bad record
+// in the middle of the log or an intact record which can not be decoded
+// fails the open with ErrCorruptLog.
+func openJournal[T any](dir string, codec Codec[T], o *options[T]) (*journal[T], map[string]*list.Element[fifoEntry[T]], *list.List[fifoEntry[T]], error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, nil, err
+	}
+	j := &journal[T]{
+		dir:              dir,
+		codec:            codec,
+		sync:             o.syncWrites,
+		compactThreshold: o.compactThreshold,
+	}
+	if j.compactThreshold <= 0 {
+		j.compactThreshold = defaultCompactThreshold
+	}
+	items := map[string]*list.Element[fifoEntry[T]]{}
+	queue := list.New[fifoEntry[T]]()
+
+	if err := j.loadSnapshot(items, queue); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := j.openWAL(items, queue); err != nil {
+		return nil, nil, nil, err
+	}
+	j.removeStaleWALs()
+	return j, items, queue, nil
+}
+
+// add records that obj is added or updated under key.
+func (j *journal[T]) add(key string, obj T) error {
+	if j == nil {
+		return nil
+	}
+	data, err := j.codec.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	return j.writeRecord(encodePayload(opAdd, key, data))
+}
+
+// delete records that key is deleted.
+func (j *journal[T]) delete(key string) error {
+	if j == nil {
+		return nil
+	}
+	return j.writeRecord(encodePayload(opDelete, key, nil))
+}
+
+// pop records that key is popped.
+func (j *journal[T]) pop(key string) error {
+	if j == nil {
+		return nil
+	}
+	return j.writeRecord(encodePayload(opPop, key, nil))
+}
+
+// maybeCompact compacts the log into a snapshot of queue once the log holds
+// more than the threshold records and more than twice the live items.
+// A failed compaction keeps the current log, so it is not reported.
+func (j *journal[T]) maybeCompact(queue *list.List[fifoEntry[T]]) {
+	if j == nil || j.records < j.compactThreshold || j.records <= 2*queue.Len() {
+		return
+	}
+	j.compact(queue) // nolint: errcheck
+}
+
+// compact writes queue as the snapshot of the next generation, and starts
+// a new empty log. It is used by Replace, which swaps the whole content.
+func (j *journal[T]) compact(queue *list.List[fifoEntry[T]]) error {
+	if j == nil {
+		return nil
+	}
+	nextGen := j.gen + 1
+	tmpName := filepath.Join(j.dir, snapshotFileName+".tmp")
+	if err := j.writeSnapshot(tmpName, nextGen, queue); err != nil {
+		os.Remove(tmpName) // nolint: errcheck
+		return err
+	}
+	wal, err := os.OpenFile(j.walName(nextGen), os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0o644)
+	if err != nil {
+		os.Remove(tmpName) // nolint: errcheck
+		return err
+	}
+	// the rename is the commit point of the compaction.
+	if err = os.Rename(tmpName, filepath.Join(j.dir, snapshotFileName)); err != nil {
+		wal.Close()                   // nolint: errcheck
+		os.Remove(tmpName)            // nolint: errcheck
+		os.Remove(j.walName(nextGen)) // nolint: errcheck
+		return err
+	}
+	syncDir(j.dir)
+	j.wal.Close()               // nolint: errcheck
+	os.Remove(j.walName(j.gen)) // nolint: errcheck
+	j.wal = wal
+	j.gen = nextGen
+	j.records = 0
+	return nil
+}
+
+// close the log.
+func (j *journal[T]) close() error {
+	if j == nil || j.wal == nil {
+		return nil
+	}
+	err := j.wal.Close()
+	j.wal = nil
+	return err
+}
+
+func (j *journal[T]) writeRecord(payload []byte) error {
+	if j.wal == nil {
+		return os.ErrClosed
+	}
+	j.buf = appendRecord(j.buf[:0], payload)
+	if _, err := j.wal.Write(j.buf); err != nil {
+		return err
+	}
+	if j.sync {
+		if err := j.wal.Sync(); err != nil {
+			return err
+		}
+	}
+	j.records++
+	return nil
+}
+
+func (j *journal[T]) writeSnapshot(name string, gen uint64, queue *list.List[fifoEntry[T]]) error {
+	file, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	buf := appendRecord(nil, binary.AppendUvarint([]byte{opSnapshot}, gen))
+	for e := queue.Front(); e != nil; e = e.Next() {
+		data, err := j.codec.Marshal(e.Value.obj)
+		if err != nil {
+			return err
+		}
+		buf = appendRecord(buf, encodePayload(opAdd, e.Value.key, data))
+	}
+	if _, err = file.Write(buf); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func (j *journal[T]) loadSnapshot(items map[string]*list.Element[fifoEntry[T]], queue *list.List[fifoEntry[T]]) error {
+	data, err := os.ReadFile(filepath.Join(j.dir, snapshotFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	payload, n, ok := readRecord(data)
+	if !ok || len(payload) == 0 || payload[0] != opSnapshot {
+		return ErrCorruptSnapshot
+	}
+	gen, m := binary.Uvarint(payload[1:])
+	if m <= 0 {
+		return ErrCorruptSnapshot
+	}
+	j.gen = gen
+	for data = data[n:]; len(data) > 0; data = data[n:] {
+		payload, n, ok = readRecord(data)
+		if !ok {
+			return ErrCorruptSnapshot
+		}
+		if err = j.apply(payload, items, queue); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+	}
+	return nil
+}
+
+// openWAL replays the log of the current generation, and opens it for appending.
+// Only a short record, or a record with a bad checksum which ends the log, is
+// taken as a torn tail. A bad checksum followed by more records fails with
+// ErrCorruptLog, rather than dropping the good records after it.
+func (j *journal[T]) openWAL(items map[string]*list.Element[fifoEntry[T]], queue *list.List[fifoEntry[T]]) error {
+	wal, err := os.OpenFile(j.walName(j.gen), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(wal)
+	if err != nil {
+		wal.Close() // nolint: errcheck
+		return err
+	}
+	offset := 0
+	for offset < len(data) {
+		payload, n, ok := readRecord(data[offset:])
+		if !ok {
+			if n > 0 && offset+n < len(data) {
+				wal.Close() // nolint: errcheck
+				return fmt.Errorf("%w: bad checksum at offset %d", ErrCorruptLog, offset)
+			}
+			break
+		}
+		if err = j.apply(payload, items, queue); err != nil {
+			wal.Close() // nolint: errcheck
+			return fmt.Errorf("%w: %v", ErrCorruptLog, err)
+		}
+		offset += n
+		j.records++
+	}
+	if offset < len(data) {
+		// drop the torn tail, so the new records follow the last good one.
+		if err = wal.Truncate(int64(offset)); err != nil {
+			wal.Close() // nolint: errcheck
+			return err
+		}
+	}
+	j.wal = wal
+	return nil
+}
+
+// removeStaleWALs removes the logs of the other generations, left by a crash
+// in the middle of a compaction.
+func (j *journal[T]) removeStaleWALs() {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		return
+	}
+	current := filepath.Base(j.walName(j.gen))
+	for _, entry := range entries {
+		if name := entry.Name(); strings.HasPrefix(name, walFilePrefix) && name != current {
+			os.Remove(filepath.Join(j.dir, name)) // nolint: errcheck
+		}
+	}
+}
+
+// apply replays a record on items and queue.
+func (j *journal[T]) apply(payload []byte, items map[string]*list.Element[fifoEntry[T]], queue *list.List[fifoEntry[T]]) error {
+	op, key, data, err := decodePayload(payload)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case opAdd:
+		obj, err := j.codec.Unmarshal(data)
+		if err != nil {
+			return err
+		}
+		if e, exists := items[key]; exists {
+			e.Value.obj = obj
+		} else {
+			items[key] = queue.PushBack(fifoEntry[T]{key, obj})
+		}
+	case opDelete, opPop:
+		if e, exists := items[key]; exists {
+			queue.Remove(e)
+			delete(items, key)
+		}
+	default:
+		return fmt.Errorf("unknown operation %d", op)
+	}
+	return nil
+}
+
+func (j *journal[T]) walName(gen uint64) string {
+	return filepath.Join(j.dir, walFilePrefix+strconv.FormatUint(gen, 10))
+}
+
+// encodePayload encodes a record as: op | uvarint(len(key)) | key | data.
+func encodePayload(op byte, key string, data []byte) []byte {
+	payload := make([]byte, 0, 1+binary.MaxVarintLen64+len(key)+len(data))
+	payload = append(payload, op)
+	payload = binary.AppendUvarint(payload, uint64(len(key)))
+	payload = append(payload, key...)
+	return append(payload, data...)
+}
+
+func decodePayload(payload []byte) (op byte, key string, data []byte, err error) {
+	if len(payload) == 0 {
+		return 0, "", nil, errors.New("empty record")
+	}
+	keyLen, n := binary.Uvarint(payload[1:])
+	if n <= 0 || uint64(len(payload)-1-n) < keyLen {
+		return 0, "", nil, errors.New("invalid key length")
+	}
+	rest := payload[1+n:]
+	return payload[0], string(rest[:keyLen]), rest[keyLen:], nil
+}
+
+func appendRecord(buf, payload []byte) []byte {
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(payload, crcTable))
+	return append(buf, payload...)
+}
+
+// readRecord reads the first record of data, it returns false if the record
+// is short, with n = 0, or does not match its checksum, with n the size of
+// the record.
+func readRecord(data []byte) (payload []byte, n int, ok bool) {
+	if len(data) < recordHeaderSize {
+		return nil, 0, false
+	}
+	length := binary.LittleEndian.Uint32(data)
+	if uint64(len(data)-recordHeaderSize) < uint64(length) {
+		return nil, 0, false
+	}
+	payload = data[recordHeaderSize : recordHeaderSize+int(length)]
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(data[4:]) {
+		return nil, recordHeaderSize + int(length), false
+	}
+	return payload, recordHeaderSize + int(length), true
+}
+
+// syncDir makes the rename in dir durable, it is best effort.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()  // nolint: errcheck
+	d.Close() // nolint: errcheck
+}
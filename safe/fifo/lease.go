@@ -0,0 +1,219 @@
+package fifo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/things-go/container/clock"
+	"github.com/things-go/container/go/list"
+)
+
+// ErrLeaseNotFound used when a lease does not exist, it is already acked,
+// nacked or expired.
+var ErrLeaseNotFound = errors.New("fifo: lease not found")
+
+// ErrLeaseExpired is the error of a leased item which is requeued after its
+// lease expires, it is the Err of its DeadLetter.
+var ErrLeaseExpired = errors.New("fifo: lease expired")
+
+// LeaseID identifies a lease of FIFO.
+type LeaseID uint64
+
+// fifoLease is a leased item of FIFO.
+type fifoLease[T any] struct {
+	id    LeaseID
+	key   string
+	obj   T
+	timer clock.Timer
+	// pending is the newer object added to the key during the lease,
+	// it is valid if hasPending is true.
+	pending    T
+	hasPending bool
+	// deleted is true if the key is deleted during the lease.
+	deleted bool
+}
+
+// Lease waits until an item is ready, and leases it for timeout, like the
+// visibility timeout of a message queue. The item is taken out of the queue
+// like Pop, but it is put back to the end of the queue if it is not acked
+// with Ack before the lease expires, or if it is nacked with Nack, so the
+// item is not lost if its consumer dies while processing it.
+//
+// While the key is leased, an Add or Update of it is deferred until the lease
+// ends: after Ack the newer object is queued, after Nack or expiry the newer
+// object is queued instead of the leased one. A Delete of the key drops it
+// once the lease ends. The leases count as in-flight for ShutDownWithDrain,
+// and they do not expire any more once the queue is closed.
+// The leases are not persisted by a durable FIFO.
+func (f *FIFO[T]) Lease(timeout time.Duration) (T, LeaseID, error) {
+	return f.LeaseContext(context.Background(), timeout)
+}
+
+// LeaseContext is the same as Lease, but it also returns with ctx.Err() once
+// ctx is done while it is blocking.
+func (f *FIFO[T]) LeaseContext(ctx context.Context, timeout time.Duration) (T, LeaseID, error) {
+	stop := context.AfterFunc(ctx, func() {
+		f.rw.Lock()
+		defer f.rw.Unlock()
+		f.cond.Broadcast()
+	})
+	defer stop()
+
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	for {
+		key, item, ok, err := f.popItemLocked()
+		if err != nil {
+			return item, 0, err
+		}
+		if ok {
+			f.nextLeaseID++
+			l := &fifoLease[T]{id: f.nextLeaseID, key: key, obj: item}
+			l.timer = f.clock.AfterFunc(timeout, func() { f.expireLease(l.id) })
+			f.leases[l.id] = l
+			f.leasedKeys[key] = l
+			return item, l.id, nil
+		}
+		var placeholder T
+		if f.closed {
+			return placeholder, 0, ErrFIFOClosed
+		}
+		if err = ctx.Err(); err != nil {
+			return placeholder, 0, err
+		}
+		f.cond.Wait()
+	}
+}
+
+// Ack finalizes the lease, the item is processed. If the key is added
+// during the lease, the newer object is queued now.
+// It returns ErrLeaseNotFound if the lease has already ended.
+func (f *FIFO[T]) Ack(id LeaseID) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	l, err := f.endLeaseLocked(id)
+	if err != nil {
+		return err
+	}
+	delete(f.requeues, l.key)
+	if l.hasPending {
+		return f.addIfNotPresent(l.key, l.pending)
+	}
+	return nil
+}
+
+// Nack ends the lease, and puts the item back to the end of the queue, or
+// the newer object if the key is added during the lease. It counts against
+// WithMaxRequeues like an ErrRequeue. It returns ErrLeaseNotFound if the
+// lease has already ended.
+func (f *FIFO[T]) Nack(id LeaseID) error {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	l, err := f.endLeaseLocked(id)
+	if err != nil {
+		return err
+	}
+	return f.requeueLeaseLocked(l, nil)
+}
+
+// expireLease puts the item of the lease back to the queue once it expires.
+func (f *FIFO[T]) expireLease(id LeaseID) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if f.closed {
+		// a timer which fired while the queue was closing.
+		return
+	}
+	if l, err := f.endLeaseLocked(id); err == nil {
+		f.requeueLeaseLocked(l, ErrLeaseExpired) // nolint: errcheck
+	}
+}
+
+// endLeaseLocked removes the lease of id. The caller must hold the lock.
+func (f *FIFO[T]) endLeaseLocked(id LeaseID) (*fifoLease[T], error) {
+	l, exists := f.leases[id]
+	if !exists {
+		return nil, ErrLeaseNotFound
+	}
+	l.timer.Stop()
+	delete(f.leases, id)
+	delete(f.leasedKeys, l.key)
+	f.metrics.done(l.key)
+	if f.draining {
+		f.cond.Broadcast()
+	}
+	return l, nil
+}
+
+// stopLeasesLocked stops the timers of the leases once the queue is closed,
+// the leases can still be acked or nacked. The caller must hold the lock.
+func (f *FIFO[T]) stopLeasesLocked() {
+	for _, l := range f.leases {
+		l.timer.Stop()
+	}
+}
+
+// requeueLeaseLocked puts the item of an ended lease back to the queue.
+// The caller must hold the lock.
+func (f *FIFO[T]) requeueLeaseLocked(l *fifoLease[T], err error) error {
+	switch {
+	case l.hasPending:
+		return f.requeueLocked(l.key, l.pending, err)
+	case l.deleted:
+		delete(f.requeues, l.key)
+		return nil
+	default:
+		return f.requeueLocked(l.key, l.obj, err)
+	}
+}
+
+// deferLeasedLocked defers the add of obj to key if the key is leased,
+// it returns false if the key is not leased. The caller must hold the lock.
+func (f *FIFO[T]) deferLeasedLocked(key string, obj T, overwrite bool) bool {
+	l, leased := f.leasedKeys[key]
+	if !leased {
+		return false
+	}
+	if overwrite || !l.hasPending {
+		l.pending = obj
+		l.hasPending = true
+		l.deleted = false
+	}
+	return true
+}
+
+// deleteLeasedLocked marks the key deleted if it is leased.
+// The caller must hold the lock.
+func (f *FIFO[T]) deleteLeasedLocked(key string) {
+	if l, leased := f.leasedKeys[key]; leased {
+		var placeholder T
+		l.pending = placeholder
+		l.hasPending = false
+		l.deleted = true
+	}
+}
+
+// replaceLeasedLocked defers the items of the leased keys in the replacement,
+// and marks the leased keys absent from it deleted. It returns the keys which
+// are not leased. The caller must hold the lock.
+func (f *FIFO[T]) replaceLeasedLocked(keys []string, items map[string]*list.Element[fifoEntry[T]], queue *list.List[fifoEntry[T]]) []string {
+	if len(f.leasedKeys) == 0 {
+		return keys
+	}
+	for key := range f.leasedKeys {
+		if e, exists := items[key]; exists {
+			f.deferLeasedLocked(key, queue.Remove(e).obj, true)
+			delete(items, key)
+		} else {
+			f.deleteLeasedLocked(key)
+		}
+	}
+	r := keys[:0]
+	for _, key := range keys {
+		if f.leasedKeys[key] == nil {
+			r = append(r, key)
+		}
+	}
+	return r
+}
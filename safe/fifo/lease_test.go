@@ -0,0 +1,182 @@
+package fifo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/things-go/container/clock"
+)
+
+func Test_FIFO_leaseAckNack(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+	f.Add(mkFifoObj("bar", 2)) // nolint: errcheck
+
+	obj, id, err := f.Lease(time.Minute)
+	if err != nil || obj.name != "foo" {
+		t.Fatalf("expected foo, got %v, %v", obj, err)
+	}
+	if _, exists, _ := f.GetByKey("foo"); exists {
+		t.Errorf("expected the leased item to be out of the queue")
+	}
+	if err = f.Nack(id); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err = f.Ack(id); err != ErrLeaseNotFound {
+		t.Errorf("expected %v, got %v", ErrLeaseNotFound, err)
+	}
+
+	// the nacked item is put back to the end of the queue.
+	obj, id, _ = f.Lease(time.Minute)
+	if obj.name != "bar" {
+		t.Fatalf("expected bar, got %v", obj)
+	}
+	if err = f.Ack(id); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err = f.Nack(id); err != ErrLeaseNotFound {
+		t.Errorf("expected %v, got %v", ErrLeaseNotFound, err)
+	}
+	if obj = Pop[testFifoObject](f); obj.name != "foo" {
+		t.Errorf("expected foo, got %v", obj)
+	}
+}
+
+func Test_FIFO_leaseExpire(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	f := New(testFifoObjectKeyFunc, WithClock[testFifoObject](fakeClock), WithMaxRequeues[testFifoObject](1))
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+
+	_, id, _ := f.Lease(time.Minute)
+	fakeClock.Step(59 * time.Second)
+	if _, exists, _ := f.GetByKey("foo"); exists {
+		t.Errorf("expected foo to be leased")
+	}
+	fakeClock.Step(time.Second)
+	waitFor(t, func() bool {
+		_, exists, _ := f.GetByKey("foo")
+		return exists
+	})
+	if err := f.Ack(id); err != ErrLeaseNotFound {
+		t.Errorf("expected %v, got %v", ErrLeaseNotFound, err)
+	}
+
+	// it is dead-lettered once it expires more than the max requeues.
+	f.Lease(time.Minute) // nolint: errcheck
+	fakeClock.Step(time.Minute)
+	waitFor(t, func() bool { return len(f.DeadLetters()) == 1 })
+	if d, _, _ := f.GetDeadLetter("foo"); d.Err != ErrLeaseExpired || d.Attempts != 2 {
+		t.Errorf("unexpected dead letter %+v", d)
+	}
+}
+
+func Test_FIFO_leaseReconcile(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+
+	// an Add during the lease is queued after Ack.
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+	_, id, _ := f.Lease(time.Minute)
+	f.Add(mkFifoObj("foo", 2))             // nolint: errcheck
+	f.AddIfNotPresent(mkFifoObj("foo", 3)) // nolint: errcheck
+	if _, exists, _ := f.GetByKey("foo"); exists {
+		t.Errorf("expected the add to be deferred")
+	}
+	f.Ack(id) // nolint: errcheck
+	if obj, _, _ := f.GetByKey("foo"); obj.val != 2 {
+		t.Errorf("expected 2, got %v", obj.val)
+	}
+
+	// the newer object is queued instead of the leased one after Nack.
+	_, id, _ = f.Lease(time.Minute)
+	f.Update(mkFifoObj("foo", 4)) // nolint: errcheck
+	f.Nack(id)                    // nolint: errcheck
+	if obj, _, _ := f.GetByKey("foo"); obj.val != 4 {
+		t.Errorf("expected 4, got %v", obj.val)
+	}
+
+	// a deleted key is dropped after Nack.
+	_, id, _ = f.Lease(time.Minute)
+	f.Delete(mkFifoObj("foo", 4)) // nolint: errcheck
+	f.Nack(id)                    // nolint: errcheck
+	if keys := f.ListKeys(); len(keys) != 0 {
+		t.Errorf("expected an empty queue, got %v", keys)
+	}
+
+	// Replace defers the leased keys, and deletes the absent ones.
+	f.Add(mkFifoObj("foo", 5)) // nolint: errcheck
+	f.Add(mkFifoObj("bar", 1)) // nolint: errcheck
+	_, fooID, _ := f.Lease(time.Minute)
+	_, barID, _ := f.Lease(time.Minute)
+	f.Replace([]testFifoObject{mkFifoObj("foo", 6), mkFifoObj("baz", 1)}, "1") // nolint: errcheck
+	if keys := f.ListKeys(); len(keys) != 1 || keys[0] != "baz" {
+		t.Errorf("expected [baz], got %v", keys)
+	}
+	f.Nack(fooID) // nolint: errcheck
+	f.Nack(barID) // nolint: errcheck
+	if obj, _, _ := f.GetByKey("foo"); obj.val != 6 {
+		t.Errorf("expected 6, got %v", obj.val)
+	}
+	if _, exists, _ := f.GetByKey("bar"); exists {
+		t.Errorf("expected bar to be dropped")
+	}
+}
+
+func Test_FIFO_leaseContextAndDrain(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := f.LeaseContext(ctx, time.Minute); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+	_, id, _ := f.Lease(time.Minute)
+	done := make(chan error, 1)
+	go func() { done <- f.ShutDownWithDrain(context.Background()) }()
+	select {
+	case <-done:
+		t.Fatal("expected ShutDownWithDrain to wait for the lease")
+	case <-time.After(10 * time.Millisecond):
+	}
+	f.Nack(id) // nolint: errcheck
+	obj, id, err := f.Lease(time.Minute)
+	if err != nil || obj.name != "foo" {
+		t.Fatalf("expected foo, got %v, %v", obj, err)
+	}
+	f.Ack(id) // nolint: errcheck
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ShutDownWithDrain did not return after the lease is acked")
+	}
+	if _, _, err = f.Lease(time.Minute); err != ErrFIFOClosed {
+		t.Errorf("expected %v, got %v", ErrFIFOClosed, err)
+	}
+}
+
+func Test_FIFO_leaseClose(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	f := New(testFifoObjectKeyFunc, WithClock[testFifoObject](fakeClock))
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+	_, id, err := f.Lease(time.Minute)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// the lease timers are stopped once the queue is closed.
+	f.Close()
+	if fakeClock.HasWaiters() {
+		t.Errorf("expected the lease timer to be stopped")
+	}
+	fakeClock.Step(time.Minute)
+	if keys := f.ListKeys(); len(keys) != 0 {
+		t.Errorf("expected the lease not to expire into the closed queue, got %v", keys)
+	}
+	if err = f.Ack(id); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package fifo
+
+import (
+	"sync"
+	"time"
+
+	"github.com/things-go/container/clock"
+)
+
+// unfinishedWorkUpdatePeriod is how often the unfinished work and the
+// longest running processor metrics are updated.
+const unfinishedWorkUpdatePeriod = 500 * time.Millisecond
+
+// GaugeMetric represents a single numerical value that can arbitrarily go up
+// and down.
+type GaugeMetric interface {
+	Set(float64)
+}
+
+// CounterMetric represents a single numerical value that only ever
+// goes up.
+type CounterMetric interface {
+	Inc()
+}
+
+// HistogramMetric counts individual observations.
+type HistogramMetric interface {
+	Observe(float64)
+}
+
+// MetricsProvider generates various metrics used by the queues,
+// name is the name of the queue the metric belongs to.
+// The durations are observed in seconds. A queue built on top of another
+// may ask for the same metric of the same name more than once, the provider
+// should return the same metric in this case.
+type MetricsProvider interface {
+	// NewDepthMetric the number of the items in the queue.
+	NewDepthMetric(name string) GaugeMetric
+	// NewAddsMetric the number of the items added to the queue.
+	NewAddsMetric(name string) CounterMetric
+	// NewLatencyMetric how long an item stays in the queue before it is popped.
+	NewLatencyMetric(name string) HistogramMetric
+	// NewWorkDurationMetric how long processing an item takes.
+	NewWorkDurationMetric(name string) HistogramMetric
+	// NewUnfinishedWorkSecondsMetric how many seconds of work has been done
+	// that is in progress and hasn't been observed by work duration.
+	NewUnfinishedWorkSecondsMetric(name string) GaugeMetric
+	// NewLongestRunningProcessorSecondsMetric how many seconds has the longest
+	// running processor been running.
+	NewLongestRunningProcessorSecondsMetric(name string) GaugeMetric
+	// NewRetriesMetric the number of the items requeued.
+	NewRetriesMetric(name string) CounterMetric
+}
+
+type noopMetric struct{}
+
+func (noopMetric) Set(float64)     {}
+func (noopMetric) Inc()            {}
+func (noopMetric) Observe(float64) {}
+
+// noopMetricsProvider is the default MetricsProvider, it does nothing.
+type noopMetricsProvider struct{}
+
+func (noopMetricsProvider) NewDepthMetric(string) GaugeMetric                 { return noopMetric{} }
+func (noopMetricsProvider) NewAddsMetric(string) CounterMetric                { return noopMetric{} }
+func (noopMetricsProvider) NewLatencyMetric(string) HistogramMetric           { return noopMetric{} }
+func (noopMetricsProvider) NewWorkDurationMetric(string) HistogramMetric      { return noopMetric{} }
+func (noopMetricsProvider) NewUnfinishedWorkSecondsMetric(string) GaugeMetric { return noopMetric{} }
+func (noopMetricsProvider) NewLongestRunningProcessorSecondsMetric(string) GaugeMetric {
+	return noopMetric{}
+}
+func (noopMetricsProvider) NewRetriesMetric(string) CounterMetric { return noopMetric{} }
+
+// queueMetrics records the metrics of a queue by key, a nil *queueMetrics
+// records nothing. It has its own lock, so that the unfinished work can be
+// updated while the queue lock is held by a long running processor.
+//
+// The unfinished work is updated by a goroutine which only runs while an
+// item is being processed, it is started by the first one and returns once
+// none is left, so a queue which is dropped without Close leaks nothing.
+type queueMetrics struct {
+	clock clock.Clock
+
+	depth                   GaugeMetric
+	adds                    CounterMetric
+	latency                 HistogramMetric
+	workDuration            HistogramMetric
+	unfinishedWorkSeconds   GaugeMetric
+	longestRunningProcessor GaugeMetric
+	retries                 CounterMetric
+
+	mu sync.Mutex
+	// addTimes is the time the key entered the queue.
+	addTimes map[string]time.Time
+	// processingStartTimes is the time the key started to be processed.
+	processingStartTimes map[string]time.Time
+	// updating is true while the unfinished work loop runs.
+	updating bool
+	// stopped is true once the queue is closed, the loop is not started any more.
+	stopped bool
+
+	stopOnce sync.Once
+	stopCh   chan struct{}
+}
+
+// newQueueMetrics returns nil for the noop provider, so the queue
+// pays nothing for the metrics by default.
+func newQueueMetrics(name string, provider MetricsProvider, c clock.Clock) *queueMetrics {
+	if _, ok := provider.(noopMetricsProvider); ok || provider == nil {
+		return nil
+	}
+	m := &queueMetrics{
+		clock:                   c,
+		depth:                   provider.NewDepthMetric(name),
+		adds:                    provider.NewAddsMetric(name),
+		latency:                 provider.NewLatencyMetric(name),
+		workDuration:            provider.NewWorkDurationMetric(name),
+		unfinishedWorkSeconds:   provider.NewUnfinishedWorkSecondsMetric(name),
+		longestRunningProcessor: provider.NewLongestRunningProcessorSecondsMetric(name),
+		retries:                 provider.NewRetriesMetric(name),
+		addTimes:                map[string]time.Time{},
+		processingStartTimes:    map[string]time.Time{},
+		stopCh:                  make(chan struct{}),
+	}
+	return m
+}
+
+// add records that key entered the queue.
+func (m *queueMetrics) add(key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.adds.Inc()
+	if _, exists := m.addTimes[key]; !exists {
+		m.addTimes[key] = m.clock.Now()
+	}
+}
+
+// remove records that key left the queue without being processed.
+func (m *queueMetrics) remove(key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.addTimes, key)
+}
+
+// get records that key was popped and starts to be processed.
+func (m *queueMetrics) get(key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	if startTime, exists := m.addTimes[key]; exists {
+		m.latency.Observe(now.Sub(startTime).Seconds())
+		delete(m.addTimes, key)
+	}
+	m.processingStartTimes[key] = now
+	if !m.updating && !m.stopped {
+		m.updating = true
+		go m.updateUnfinishedWorkLoop()
+	}
+}
+
+// done records that key finished being processed.
+func (m *queueMetrics) done(key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if startTime, exists := m.processingStartTimes[key]; exists {
+		m.workDuration.Observe(m.clock.Since(startTime).Seconds())
+		delete(m.processingStartTimes, key)
+	}
+}
+
+// retry records that an item was requeued.
+func (m *queueMetrics) retry() {
+	if m == nil {
+		return
+	}
+	m.retries.Inc()
+}
+
+// setDepth records the number of the items in the queue.
+func (m *queueMetrics) setDepth(depth int) {
+	if m == nil {
+		return
+	}
+	m.depth.Set(float64(depth))
+}
+
+// stop the unfinished work loop, it is safe to call multiple times.
+func (m *queueMetrics) stop() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	m.stopped = true
+	m.mu.Unlock()
+	m.stopOnce.Do(func() { close(m.stopCh) })
+}
+
+// updateUnfinishedWorkLoop updates the unfinished work periodically, until
+// no item is being processed or the queue is closed.
+func (m *queueMetrics) updateUnfinishedWorkLoop() {
+	t := m.clock.NewTicker(unfinishedWorkUpdatePeriod)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C():
+			if !m.updateUnfinishedWork() {
+				return
+			}
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// updateUnfinishedWork updates the unfinished work, it returns false and
+// ends the loop if no item is being processed.
+func (m *queueMetrics) updateUnfinishedWork() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var total float64
+	var oldest float64
+	now := m.clock.Now()
+	for _, t := range m.processingStartTimes {
+		age := now.Sub(t).Seconds()
+		total += age
+		oldest = max(oldest, age)
+	}
+	m.unfinishedWorkSeconds.Set(total)
+	m.longestRunningProcessor.Set(oldest)
+	if len(m.processingStartTimes) == 0 {
+		m.updating = false
+		return false
+	}
+	return true
+}
@@ -0,0 +1,220 @@
+package fifo
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/things-go/container/clock"
+)
+
+type testMetric struct {
+	mu           sync.Mutex
+	inc          int
+	gaugeValue   float64
+	observations []float64
+	notifyCh     chan<- struct{}
+}
+
+func (m *testMetric) Inc() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inc++
+}
+
+func (m *testMetric) Set(f float64) {
+	m.mu.Lock()
+	m.gaugeValue = f
+	m.mu.Unlock()
+	if m.notifyCh != nil {
+		m.notifyCh <- struct{}{}
+	}
+}
+
+func (m *testMetric) Observe(f float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observations = append(m.observations, f)
+}
+
+func (m *testMetric) count() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.inc
+}
+
+func (m *testMetric) gauge() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gaugeValue
+}
+
+func (m *testMetric) observed() []float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]float64(nil), m.observations...)
+}
+
+type testMetricsProvider struct {
+	depth      testMetric
+	adds       testMetric
+	latency    testMetric
+	duration   testMetric
+	unfinished testMetric
+	longest    testMetric
+	retries    testMetric
+}
+
+func (m *testMetricsProvider) NewDepthMetric(string) GaugeMetric            { return &m.depth }
+func (m *testMetricsProvider) NewAddsMetric(string) CounterMetric           { return &m.adds }
+func (m *testMetricsProvider) NewLatencyMetric(string) HistogramMetric      { return &m.latency }
+func (m *testMetricsProvider) NewWorkDurationMetric(string) HistogramMetric { return &m.duration }
+func (m *testMetricsProvider) NewUnfinishedWorkSecondsMetric(string) GaugeMetric {
+	return &m.unfinished
+}
+func (m *testMetricsProvider) NewLongestRunningProcessorSecondsMetric(string) GaugeMetric {
+	return &m.longest
+}
+func (m *testMetricsProvider) NewRetriesMetric(string) CounterMetric { return &m.retries }
+
+func Test_FIFO_metrics(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	mp := &testMetricsProvider{}
+	f := New(testFifoObjectKeyFunc, WithMetrics[testFifoObject]("test", mp), WithClock[testFifoObject](fakeClock))
+	defer f.Close()
+
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+	f.Add(mkFifoObj("bar", 2)) // nolint: errcheck
+	f.Add(mkFifoObj("foo", 3)) // nolint: errcheck
+	if e, a := 2, mp.adds.count(); e != a {
+		t.Errorf("expected %v adds, got %v", e, a)
+	}
+	if e, a := 2.0, mp.depth.gauge(); e != a {
+		t.Errorf("expected depth %v, got %v", e, a)
+	}
+
+	fakeClock.Step(50 * time.Millisecond)
+	f.Pop(func(testFifoObject) error { // nolint: errcheck
+		fakeClock.Step(25 * time.Millisecond)
+		return nil
+	})
+	if e, a := []float64{0.05}, mp.latency.observed(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected latency %v, got %v", e, a)
+	}
+	if e, a := []float64{0.025}, mp.duration.observed(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected work duration %v, got %v", e, a)
+	}
+	if e, a := 1.0, mp.depth.gauge(); e != a {
+		t.Errorf("expected depth %v, got %v", e, a)
+	}
+
+	// requeue counts a retry and a new add.
+	f.Pop(func(testFifoObject) error { return ErrRequeue{} }) // nolint: errcheck
+	if e, a := 1, mp.retries.count(); e != a {
+		t.Errorf("expected %v retries, got %v", e, a)
+	}
+	if e, a := 3, mp.adds.count(); e != a {
+		t.Errorf("expected %v adds, got %v", e, a)
+	}
+
+	f.Delete(mkFifoObj("bar", 2)) // nolint: errcheck
+	if e, a := 0.0, mp.depth.gauge(); e != a {
+		t.Errorf("expected depth %v, got %v", e, a)
+	}
+
+	f.Replace([]testFifoObject{mkFifoObj("a", 1), mkFifoObj("b", 2)}, "1") // nolint: errcheck
+	if e, a := 5, mp.adds.count(); e != a {
+		t.Errorf("expected %v adds, got %v", e, a)
+	}
+	if e, a := 2.0, mp.depth.gauge(); e != a {
+		t.Errorf("expected depth %v, got %v", e, a)
+	}
+}
+
+func Test_FIFO_metricsUnfinishedWork(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	notifyCh := make(chan struct{}, 1)
+	mp := &testMetricsProvider{}
+	mp.longest.notifyCh = notifyCh
+	f := New(testFifoObjectKeyFunc, WithMetrics[testFifoObject]("test", mp), WithClock[testFifoObject](fakeClock))
+	defer f.Close()
+
+	// the loop only runs while an item is being processed.
+	if fakeClock.HasWaiters() {
+		t.Errorf("expected no unfinished work loop before processing")
+	}
+	f.Add(mkFifoObj("foo", 1))         // nolint: errcheck
+	f.Pop(func(testFifoObject) error { // nolint: errcheck
+		for !fakeClock.HasWaiters() {
+			time.Sleep(time.Millisecond)
+		}
+		fakeClock.Step(unfinishedWorkUpdatePeriod)
+		<-notifyCh
+		if e, a := 0.5, mp.unfinished.gauge(); e != a {
+			t.Errorf("expected unfinished work %v, got %v", e, a)
+		}
+		if e, a := 0.5, mp.longest.gauge(); e != a {
+			t.Errorf("expected longest running processor %v, got %v", e, a)
+		}
+		return nil
+	})
+
+	fakeClock.Step(unfinishedWorkUpdatePeriod)
+	<-notifyCh
+	if e, a := 0.0, mp.longest.gauge(); e != a {
+		t.Errorf("expected longest running processor %v, got %v", e, a)
+	}
+	waitFor(t, func() bool { return !fakeClock.HasWaiters() })
+}
+
+func Test_DeltaFIFO_metrics(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	mp := &testMetricsProvider{}
+	f := NewDeltaFIFO(testFifoObjectKeyFunc, WithMetrics[testFifoObject]("test", mp), WithClock[testFifoObject](fakeClock))
+	defer f.Close()
+
+	f.Add(mkFifoObj("foo", 1))    // nolint: errcheck
+	f.Update(mkFifoObj("foo", 2)) // nolint: errcheck
+	if e, a := 1, mp.adds.count(); e != a {
+		t.Errorf("expected %v adds, got %v", e, a)
+	}
+	if e, a := 1.0, mp.depth.gauge(); e != a {
+		t.Errorf("expected depth %v, got %v", e, a)
+	}
+
+	fakeClock.Step(time.Second)
+	f.PopDeltas(func(Deltas[testFifoObject]) error { return ErrRequeue{} }) // nolint: errcheck
+	if e, a := []float64{1}, mp.latency.observed(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected latency %v, got %v", e, a)
+	}
+	if e, a := 1, mp.retries.count(); e != a {
+		t.Errorf("expected %v retries, got %v", e, a)
+	}
+	if e, a := 1.0, mp.depth.gauge(); e != a {
+		t.Errorf("expected depth %v, got %v", e, a)
+	}
+}
+
+func Test_FIFO_metricsRun(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	mp := &testMetricsProvider{}
+	f := New(testFifoObjectKeyFunc, WithMetrics[testFifoObject]("test", mp), WithClock[testFifoObject](fakeClock))
+	defer f.Close()
+
+	// an item popped by Run is done once it is released, not once it is popped.
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+	obj, err := f.popForRun(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if a := mp.duration.observed(); len(a) != 0 {
+		t.Errorf("expected no work duration while in flight, got %v", a)
+	}
+	fakeClock.Step(25 * time.Millisecond)
+	f.Forget(obj)
+	if e, a := []float64{0.025}, mp.duration.observed(); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected work duration %v, got %v", e, a)
+	}
+}
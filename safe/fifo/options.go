@@ -0,0 +1,152 @@
+package fifo
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/clock"
+	"github.com/things-go/container/comparator"
+)
+
+// options of the queues.
+type options[T any] struct {
+	// knownObjects list keys that are "known" --- affecting Delete(),
+	// Replace(), and Resync()
+	knownObjects KeyListerGetter[T]
+	// compare is used to order the keys queued by Replace(), default by key.
+	compare comparator.Comparable[T]
+	// metricsName is the name of the queue the metrics belong to.
+	metricsName string
+	// metricsProvider generates the metrics of the queue, default no-op.
+	metricsProvider MetricsProvider
+	// clock is used to measure the metrics and to run the timers of the leases,
+	// default clock.RealClock.
+	clock clock.Clock
+	// compactThreshold is the number of the records in the log of a durable
+	// FIFO which triggers a compaction.
+	compactThreshold int
+	// syncWrites calls fsync after every record of a durable FIFO.
+	syncWrites bool
+	// groupWeight returns the weight of a group of FairQueue, default 1.
+	groupWeight func(group string) int
+	// maxRequeues is the number of times an item of FIFO can be requeued
+	// before it is dead-lettered, negative means unlimited.
+	maxRequeues int
+	// deadLetters holds the dead-lettered items of FIFO, default in memory.
+	deadLetters container.Store[DeadLetter[T]]
+}
+
+// Option for the queues.
+type Option[T any] func(*options[T])
+
+// WithKnownObjects set the known objects which the DeltaFIFO consults
+// when Delete, Replace or Resync is called, usually it is the cache that
+// the consumer of the DeltaFIFO keeps up to date. It is only used by DeltaFIFO.
+func WithKnownObjects[T any](knownObjects KeyListerGetter[T]) Option[T] {
+	return func(o *options[T]) {
+		o.knownObjects = knownObjects
+	}
+}
+
+// WithReplaceOrder set the function which orders the objects queued by Replace,
+// the objects are ordered by key if it is not set.
+func WithReplaceOrder[T any](compare comparator.Comparable[T]) Option[T] {
+	return func(o *options[T]) {
+		o.compare = compare
+	}
+}
+
+// WithMetrics set the MetricsProvider which generates the metrics of the queue,
+// name is passed to the provider to tell the queues apart.
+func WithMetrics[T any](name string, provider MetricsProvider) Option[T] {
+	return func(o *options[T]) {
+		o.metricsName = name
+		o.metricsProvider = provider
+	}
+}
+
+// WithClock with a custom clock which measures the metrics and runs the timers
+// of the leases, default clock.RealClock.
+// It is mostly used to inject a fake clock in tests.
+func WithClock[T any](c clock.Clock) Option[T] {
+	return func(o *options[T]) {
+		o.clock = c
+	}
+}
+
+// WithCompactThreshold set the number of the records in the log of a durable
+// FIFO which triggers a compaction into a snapshot, once the log also holds
+// more than twice the records of the items, default 1000.
+func WithCompactThreshold[T any](n int) Option[T] {
+	return func(o *options[T]) {
+		o.compactThreshold = n
+	}
+}
+
+// WithSyncWrites makes a durable FIFO call fsync after every record,
+// so the records also survive a power loss, at the cost of throughput.
+func WithSyncWrites[T any]() Option[T] {
+	return func(o *options[T]) {
+		o.syncWrites = true
+	}
+}
+
+// WithGroupWeight set the function which returns the weight of a group,
+// a group pops up to weight items in its turn of the round-robin.
+// A weight less than 1 is taken as 1, which is also the default.
+// It is only used by FairQueue.
+func WithGroupWeight[T any](weight func(group string) int) Option[T] {
+	return func(o *options[T]) {
+		o.groupWeight = weight
+	}
+}
+
+// WithMaxRequeues set the number of times an item can be requeued, by an
+// ErrRequeue or FIFO.Requeue, before it is moved into the dead letters along
+// with its last error and the number of attempts, default unlimited.
+// A negative n means unlimited, and zero dead-letters an item on its first requeue.
+// The count of a key is reset once its item is processed without requeue,
+// deleted or redriven. It is only used by FIFO.
+func WithMaxRequeues[T any](n int) Option[T] {
+	return func(o *options[T]) {
+		o.maxRequeues = max(n, -1)
+	}
+}
+
+// WithDeadLetterStore set the Store which holds the dead-lettered items,
+// default in memory. The store is keyed by DeadLetterKeyFunc, and the FIFO
+// calls it under its lock. It is only used by FIFO.
+func WithDeadLetterStore[T any](store container.Store[DeadLetter[T]]) Option[T] {
+	return func(o *options[T]) {
+		o.deadLetters = store
+	}
+}
+
+func newOptions[T any](opts ...Option[T]) *options[T] {
+	o := &options[T]{
+		metricsProvider: noopMetricsProvider{},
+		clock:           clock.RealClock{},
+		maxRequeues:     -1,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// sortKeys sorts keys by the objects they map to in items with compare,
+// or by key if compare is nil.
+func sortKeys[T any](keys []string, items map[string]T, compare comparator.Comparable[T]) {
+	if compare == nil {
+		slices.Sort(keys)
+		return
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		if c := compare(items[a], items[b]); c != 0 {
+			return c
+		}
+		// fallback by key, keeps the order deterministic
+		return cmp.Compare(a, b)
+	})
+}
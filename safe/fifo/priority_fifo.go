@@ -0,0 +1,450 @@
+package fifo
+
+import (
+	"context"
+	"sync"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/comparator"
+	"github.com/things-go/container/go/heap"
+)
+
+// PriorityFunc returns the priority of an object, the higher priority pops first.
+// It should be deterministic.
+type PriorityFunc[T any] func(T) int
+
+// PriorityFIFO is a Queue
+var _ Queue[int] = (*PriorityFIFO[int])(nil)
+
+// PriorityFIFO is a Queue in which (a) each accumulator is simply the most
+// recently provided object and (b) the collection of keys to process is
+// ordered by the priority of the objects, the items of the same priority
+// are processed in the order they were added. The Resync operation is a no-op.
+//
+// Like FIFO, if multiple adds/updates of a single object happen while that
+// object's key is in the queue, it will only be processed once, with the most
+// recent version. An update takes the priority of the new version, but keeps
+// the place of the key among the items of the same priority.
+type PriorityFIFO[T any] struct {
+	rw   sync.RWMutex
+	cond sync.Cond
+	// `items` maps a key to its entry in `queue`, `queue` is the heap
+	// of the entries for consumption in Pop().
+	items map[string]*priorityEntry[T]
+	queue priorityQueue[T]
+	// seq is the sequence number of the next new entry.
+	seq uint64
+
+	// populated is true if the first batch of items inserted by Replace() has been populated
+	// or Delete/Push/Update was called first.
+	populated bool
+	// initialPopulationCount is the number of items inserted by the first call of Replace()
+	initialPopulationCount int
+
+	// keyFunc is used to make the key used for queued item insertion and retrieval, and
+	// should be deterministic.
+	keyFunc container.KeyFunc[T]
+	// priorityFunc is used to make the priority of the queued items.
+	priorityFunc PriorityFunc[T]
+
+	// compare is used to order the keys of the same priority queued by Replace(), default by key.
+	compare comparator.Comparable[T]
+	// lastSyncResourceVersion is the resource version passed to the last Replace().
+	lastSyncResourceVersion string
+	// metrics of the queue, nil if no MetricsProvider is set.
+	metrics *queueMetrics
+
+	// Indication the queue is closed.
+	closed bool
+}
+
+// NewPriorityFIFO returns a PriorityFIFO which orders the items by priorityFunc.
+// keyFunc is used to make the key used for queued item insertion and retrieval, and should be deterministic.
+func NewPriorityFIFO[T any](keyFunc container.KeyFunc[T], priorityFunc PriorityFunc[T], opts ...Option[T]) *PriorityFIFO[T] {
+	o := newOptions(opts...)
+	f := &PriorityFIFO[T]{
+		items:        map[string]*priorityEntry[T]{},
+		keyFunc:      keyFunc,
+		priorityFunc: priorityFunc,
+		compare:      o.compare,
+		metrics:      newQueueMetrics(o.metricsName, o.metricsProvider, o.clock),
+	}
+	f.cond.L = &f.rw
+	return f
+}
+
+// Close the queue.
+func (f *PriorityFIFO[T]) Close() {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.closed = true
+	f.metrics.stop()
+	f.cond.Broadcast()
+}
+
+// IsClosed checks if the queue is closed.
+func (f *PriorityFIFO[T]) IsClosed() bool {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return f.closed
+}
+
+// HasSynced returns true if an Push/Update/Delete/AddIfNotPresent are called first,
+// or the first batch of items inserted by Replace() has been popped.
+func (f *PriorityFIFO[T]) HasSynced() bool {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	return f.populated && f.initialPopulationCount == 0
+}
+
+// Add inserts an item, and puts it in the queue. The item is only enqueued
+// if it doesn't already exist in the set, otherwise it is updated and moved
+// by its new priority.
+func (f *PriorityFIFO[T]) Add(obj T) error {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	priority := f.priorityFunc(obj)
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.populated = true
+	if entry, exists := f.items[key]; exists {
+		entry.obj = obj
+		entry.priority = priority
+		heap.Fix[*priorityEntry[T]](&f.queue, entry.index)
+		return nil
+	}
+	f.addLocked(key, priority, obj)
+	return nil
+}
+
+// AddIfNotPresent inserts an item, and puts it in the queue. If the item is already
+// present in the set, it is neither enqueued nor added to the set.
+func (f *PriorityFIFO[T]) AddIfNotPresent(obj T) error {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	priority := f.priorityFunc(obj)
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.populated = true
+	if _, exists := f.items[key]; !exists {
+		f.addLocked(key, priority, obj)
+	}
+	return nil
+}
+
+// Update is the same as Add in this implementation.
+func (f *PriorityFIFO[T]) Update(obj T) error {
+	return f.Add(obj)
+}
+
+// Delete removes an item. It doesn't add it to the queue, because
+// this implementation assumes the consumer only cares about the objects,
+// not the order in which they were created/added. The item is removed
+// from the queue too, like it was popped for HasSynced.
+func (f *PriorityFIFO[T]) Delete(obj T) error {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	f.populated = true
+	if entry, exists := f.items[key]; exists {
+		heap.Remove[*priorityEntry[T]](&f.queue, entry.index)
+		f.removeLocked(entry)
+		f.metrics.remove(key)
+		f.metrics.setDepth(len(f.items))
+	}
+	return nil
+}
+
+// List returns a list of all the items.
+func (f *PriorityFIFO[T]) List() []T {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	r := make([]T, 0, len(f.items))
+	for _, entry := range f.items {
+		r = append(r, entry.obj)
+	}
+	return r
+}
+
+// ListKeys returns a list of all the keys of the objects currently
+// in the PriorityFIFO.
+func (f *PriorityFIFO[T]) ListKeys() []string {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return mapKeys(f.items)
+}
+
+// Get returns the requested item, or sets exists=false.
+func (f *PriorityFIFO[T]) Get(obj T) (item T, exists bool, err error) {
+	key, err := f.keyFunc(obj)
+	if err != nil {
+		return item, false, container.KeyError[T]{Obj: obj, Err: err}
+	}
+	return f.GetByKey(key)
+}
+
+// GetByKey returns the requested item, or sets exists=false.
+func (f *PriorityFIFO[T]) GetByKey(key string) (item T, exists bool, err error) {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	entry, exists := f.items[key]
+	if !exists {
+		return item, false, nil
+	}
+	return entry.obj, true, nil
+}
+
+// Pop waits until an item is ready and processes it. The item of the highest
+// priority is processed first, the items of the same priority are processed
+// in the order in which they were added. The item is removed from the queue
+// (and the store) before it is processed, so if you don't successfully process
+// it, it should be added back with AddIfNotPresent(). process function is called
+// under lock, so it is safe update data structures in it that need to be in
+// sync with the queue.
+func (f *PriorityFIFO[T]) Pop(process PopProcessFunc[T]) (T, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	for {
+		if item, ok, err := f.popLocked(process); ok {
+			return item, err
+		}
+		if f.closed {
+			var placeholder T
+			return placeholder, ErrFIFOClosed
+		}
+		f.cond.Wait()
+	}
+}
+
+// PopContext is the same as Pop, but it also returns with ctx.Err() once ctx is
+// done while it is blocking. A ready item is always processed first, even if
+// ctx is done.
+func (f *PriorityFIFO[T]) PopContext(ctx context.Context, process PopProcessFunc[T]) (T, error) {
+	stop := context.AfterFunc(ctx, func() {
+		f.rw.Lock()
+		defer f.rw.Unlock()
+		f.cond.Broadcast()
+	})
+	defer stop()
+
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	for {
+		if item, ok, err := f.popLocked(process); ok {
+			return item, err
+		}
+		var placeholder T
+		if f.closed {
+			return placeholder, ErrFIFOClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return placeholder, err
+		}
+		f.cond.Wait()
+	}
+}
+
+// TryPop is the same as Pop, but it never blocks. It returns ErrFIFOEmpty if
+// no item is ready, or ErrFIFOClosed if the queue is closed and no item is ready.
+func (f *PriorityFIFO[T]) TryPop(process PopProcessFunc[T]) (T, error) {
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if item, ok, err := f.popLocked(process); ok {
+		return item, err
+	}
+	var placeholder T
+	if f.closed {
+		return placeholder, ErrFIFOClosed
+	}
+	return placeholder, ErrFIFOEmpty
+}
+
+// Replace will delete the contents of 'f', using instead the given list.
+// 'f' takes ownership of the list, you should not reference the list again
+// after calling this function. f's queue is reset, too; upon return, it
+// will contain the items in the list ordered by priority, the items of the
+// same priority are ordered by key or by the function set with WithReplaceOrder.
+// resourceVersion is recorded as the last sync resource version.
+func (f *PriorityFIFO[T]) Replace(list []T, resourceVersion string) error {
+	objs := make(map[string]T, len(list))
+	keys := make([]string, 0, len(list))
+	for _, item := range list {
+		key, err := f.keyFunc(item)
+		if err != nil {
+			return container.KeyError[T]{Obj: item, Err: err}
+		}
+		if _, exists := objs[key]; !exists {
+			keys = append(keys, key)
+		}
+		objs[key] = item
+	}
+	sortKeys(keys, objs, f.compare)
+	items := make(map[string]*priorityEntry[T], len(keys))
+	queue := make(priorityQueue[T], 0, len(keys))
+	for i, key := range keys {
+		entry := &priorityEntry[T]{
+			key:      key,
+			obj:      objs[key],
+			priority: f.priorityFunc(objs[key]),
+			seq:      uint64(i),
+			index:    i,
+		}
+		items[key] = entry
+		queue = append(queue, entry)
+	}
+	heap.Init[*priorityEntry[T]](&queue)
+
+	f.rw.Lock()
+	defer f.rw.Unlock()
+	if !f.populated {
+		f.populated = true
+		f.initialPopulationCount = len(items)
+	}
+
+	if f.metrics != nil {
+		for key := range f.items {
+			if _, exists := items[key]; !exists {
+				f.metrics.remove(key)
+			}
+		}
+		for _, key := range keys {
+			if _, exists := f.items[key]; !exists {
+				f.metrics.add(key)
+			}
+		}
+		f.metrics.setDepth(len(items))
+	}
+
+	f.items = items
+	f.queue = queue
+	f.seq = uint64(len(keys))
+	f.lastSyncResourceVersion = resourceVersion
+	if len(f.items) > 0 {
+		f.cond.Broadcast()
+	}
+	return nil
+}
+
+// LastSyncResourceVersion returns the resource version passed to the last Replace.
+func (f *PriorityFIFO[T]) LastSyncResourceVersion() string {
+	f.rw.RLock()
+	defer f.rw.RUnlock()
+	return f.lastSyncResourceVersion
+}
+
+// Resync will ensure that every object in the Store has its key in the queue.
+// It is a no-op, because that property is maintained by all operations.
+func (f *PriorityFIFO[T]) Resync() error {
+	return nil
+}
+
+// addLocked adds a new item of key, which goes after the items of the same priority.
+// The caller must hold the lock.
+func (f *PriorityFIFO[T]) addLocked(key string, priority int, obj T) {
+	entry := &priorityEntry[T]{
+		key:      key,
+		obj:      obj,
+		priority: priority,
+		seq:      f.seq,
+	}
+	f.seq++
+	heap.Push[*priorityEntry[T]](&f.queue, entry)
+	f.items[key] = entry
+	f.metrics.add(key)
+	f.metrics.setDepth(len(f.items))
+	f.cond.Broadcast()
+}
+
+// popLocked pops the first ready item and processes it, it returns false if
+// no item is ready. The caller must hold the lock.
+func (f *PriorityFIFO[T]) popLocked(process PopProcessFunc[T]) (item T, ok bool, err error) {
+	if f.queue.Len() == 0 {
+		return item, false, nil
+	}
+	entry := heap.Pop[*priorityEntry[T]](&f.queue)
+	f.removeLocked(entry)
+	f.metrics.get(entry.key)
+	f.metrics.setDepth(len(f.items))
+
+	if process != nil {
+		err = process(entry.obj)
+	}
+	f.metrics.done(entry.key)
+	if e, ok := err.(ErrRequeue); ok {
+		f.metrics.retry()
+		err = e.Err
+		if _, exists := f.items[entry.key]; !exists {
+			f.addLocked(entry.key, entry.priority, entry.obj)
+		}
+	}
+	return entry.obj, true, err
+}
+
+// removeLocked removes the entry, which is already out of the queue, from the store.
+// The caller must hold the lock.
+func (f *PriorityFIFO[T]) removeLocked(entry *priorityEntry[T]) {
+	delete(f.items, entry.key)
+	if f.initialPopulationCount > 0 {
+		f.initialPopulationCount--
+	}
+}
+
+// priorityEntry is an item in the queue of PriorityFIFO.
+type priorityEntry[T any] struct {
+	key      string
+	obj      T
+	priority int
+	// seq is the order in which the key was added, it breaks the ties of priority.
+	seq uint64
+	// index in the priority queue (heap)
+	index int
+}
+
+// priorityQueue implements heap.Interface. The item of the highest priority,
+// then of the lowest sequence number, is at the root.
+type priorityQueue[T any] []*priorityEntry[T]
+
+// Len implement heap.Interface.
+func (pq priorityQueue[T]) Len() int {
+	return len(pq)
+}
+
+// Less implement heap.Interface.
+func (pq priorityQueue[T]) Less(i, j int) bool {
+	if pq[i].priority != pq[j].priority {
+		return pq[i].priority > pq[j].priority
+	}
+	return pq[i].seq < pq[j].seq
+}
+
+// Swap implement heap.Interface.
+func (pq priorityQueue[T]) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+	pq[i].index = i
+	pq[j].index = j
+}
+
+// Push adds an item to the queue. Push should not be called directly; instead,
+// use `heap.Push`.
+func (pq *priorityQueue[T]) Push(x *priorityEntry[T]) {
+	x.index = len(*pq)
+	*pq = append(*pq, x)
+}
+
+// Pop removes an item from the queue. Pop should not be called directly;
+// instead, use `heap.Pop`.
+func (pq *priorityQueue[T]) Pop() *priorityEntry[T] {
+	n := len(*pq)
+	item := (*pq)[n-1]
+	(*pq)[n-1] = nil // avoid memory leak
+	item.index = -1
+	*pq = (*pq)[0:(n - 1)]
+	return item
+}
@@ -0,0 +1,139 @@
+package fifo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testFifoObjectPriorityFunc(obj testFifoObject) int {
+	return obj.val.(int)
+}
+
+func popAllNames(t *testing.T, f Queue[testFifoObject]) []string {
+	t.Helper()
+	var names []string
+	for {
+		obj, err := f.TryPop(nil)
+		if err == ErrFIFOEmpty {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		names = append(names, obj.name)
+	}
+}
+
+func Test_PriorityFIFO_order(t *testing.T) {
+	f := NewPriorityFIFO(testFifoObjectKeyFunc, testFifoObjectPriorityFunc)
+	f.Add(mkFifoObj("a", 1)) // nolint: errcheck
+	f.Add(mkFifoObj("b", 3)) // nolint: errcheck
+	f.Add(mkFifoObj("c", 1)) // nolint: errcheck
+	f.Add(mkFifoObj("d", 2)) // nolint: errcheck
+	f.Add(mkFifoObj("e", 3)) // nolint: errcheck
+	f.Add(mkFifoObj("f", 1)) // nolint: errcheck
+
+	if e, a := []string{"b", "e", "d", "a", "c", "f"}, popAllNames(t, f); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_PriorityFIFO_addUpdate(t *testing.T) {
+	f := NewPriorityFIFO(testFifoObjectKeyFunc, testFifoObjectPriorityFunc)
+	f.Add(mkFifoObj("a", 1)) // nolint: errcheck
+	f.Add(mkFifoObj("b", 2)) // nolint: errcheck
+	f.Add(mkFifoObj("c", 3)) // nolint: errcheck
+	f.Add(mkFifoObj("d", 1)) // nolint: errcheck
+
+	// the updates move the items by their new priority, but they keep
+	// their places among the items of the same priority.
+	f.Update(mkFifoObj("a", 4))          // nolint: errcheck
+	f.Update(mkFifoObj("d", 5))          // nolint: errcheck
+	f.Update(mkFifoObj("d", 1))          // nolint: errcheck
+	f.AddIfNotPresent(mkFifoObj("b", 9)) // nolint: errcheck
+	f.Update(mkFifoObj("a", 1))          // nolint: errcheck
+	if e, a := 4, len(f.List()); e != a {
+		t.Errorf("expected %v items, got %v", e, a)
+	}
+	if item, _, _ := f.GetByKey("b"); item.val != 2 {
+		t.Errorf("AddIfNotPresent should not update, got %v", item)
+	}
+
+	if e, a := []string{"c", "b", "a", "d"}, popAllNames(t, f); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_PriorityFIFO_Delete(t *testing.T) {
+	f := NewPriorityFIFO(testFifoObjectKeyFunc, testFifoObjectPriorityFunc)
+	f.Add(mkFifoObj("a", 1))    // nolint: errcheck
+	f.Add(mkFifoObj("b", 2))    // nolint: errcheck
+	f.Add(mkFifoObj("c", 3))    // nolint: errcheck
+	f.Delete(mkFifoObj("b", 2)) // nolint: errcheck
+	if _, exists, _ := f.Get(mkFifoObj("b", 2)); exists {
+		t.Errorf("deleted item should not exist")
+	}
+	if e, a := []string{"c", "a"}, popAllNames(t, f); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_PriorityFIFO_requeue(t *testing.T) {
+	f := NewPriorityFIFO(testFifoObjectKeyFunc, testFifoObjectPriorityFunc)
+	f.Add(mkFifoObj("a", 1)) // nolint: errcheck
+	f.Add(mkFifoObj("b", 1)) // nolint: errcheck
+
+	// the requeued item goes after the items of the same priority.
+	f.Pop(func(testFifoObject) error { return ErrRequeue{} }) // nolint: errcheck
+	if e, a := []string{"b", "a"}, popAllNames(t, f); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_PriorityFIFO_Replace(t *testing.T) {
+	f := NewPriorityFIFO(testFifoObjectKeyFunc, testFifoObjectPriorityFunc)
+	f.Add(mkFifoObj("z", 9))    // nolint: errcheck
+	f.Replace([]testFifoObject{ // nolint: errcheck
+		mkFifoObj("d", 1),
+		mkFifoObj("c", 2),
+		mkFifoObj("b", 1),
+		mkFifoObj("a", 2),
+	}, "2")
+	if e, a := "2", f.LastSyncResourceVersion(); e != a {
+		t.Errorf("expected resource version %v, got %v", e, a)
+	}
+	f.Add(mkFifoObj("e", 2)) // nolint: errcheck
+
+	if e, a := []string{"a", "c", "e", "b", "d"}, popAllNames(t, f); !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, got %v", e, a)
+	}
+}
+
+func Test_PriorityFIFO_HasSynced(t *testing.T) {
+	f := NewPriorityFIFO(testFifoObjectKeyFunc, testFifoObjectPriorityFunc)
+	if f.HasSynced() {
+		t.Errorf("expected not synced before Replace")
+	}
+	f.Replace([]testFifoObject{mkFifoObj("a", 1), mkFifoObj("b", 2)}, "1") // nolint: errcheck
+	f.Delete(mkFifoObj("a", 1))                                            // nolint: errcheck
+	if f.HasSynced() {
+		t.Errorf("expected not synced before the first batch is popped")
+	}
+	f.Pop(nil) // nolint: errcheck
+	if !f.HasSynced() {
+		t.Errorf("expected synced once the first batch is popped")
+	}
+}
+
+func Test_PriorityFIFO_PopShouldUnblockWhenClosed(t *testing.T) {
+	f := NewPriorityFIFO(testFifoObjectKeyFunc, testFifoObjectPriorityFunc)
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := f.Pop(nil)
+		errCh <- err
+	}()
+	f.Close()
+	if err := <-errCh; err != ErrFIFOClosed {
+		t.Errorf("expected %v, got %v", ErrFIFOClosed, err)
+	}
+}
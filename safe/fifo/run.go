@@ -0,0 +1,253 @@
+package fifo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// ProcessFunc is passed to Run, it processes an item popped from the queue.
+// It may return an ErrRequeue to requeue the item.
+type ProcessFunc[T any] func(ctx context.Context, obj T) error
+
+// PanicError is the error of a ProcessFunc which panics.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value any
+	// Stack is the stack trace of the panic.
+	Stack []byte
+}
+
+// Error implement error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("fifo: process panic: %v", e.Value)
+}
+
+// errPopped is returned by the process function of popForRun, it tells the
+// FIFO that the item is processed outside of Pop, and Run reports the result
+// with Requeue or Forget later.
+var errPopped = errors.New("fifo: item is popped to be processed outside of the queue")
+
+// runPopper is a queue which hands the items over to Run, such as FIFO and
+// the queues which embed it.
+type runPopper[T any] interface {
+	popForRun(ctx context.Context) (T, error)
+}
+
+// popForRun is the same as PopContext, but the item is in flight until Run
+// calls Requeue or Forget.
+func (f *FIFO[T]) popForRun(ctx context.Context) (T, error) {
+	return f.PopContext(ctx, func(T) error { return errPopped })
+}
+
+// drainer is a queue which can be shut down after its items are drained, such as FIFO.
+type drainer interface {
+	ShutDownWithDrain(ctx context.Context) error
+}
+
+// retrier is a queue which counts the requeues of the items, such as FIFO.
+type retrier[T any] interface {
+	Requeue(obj T, err error) error
+	Forget(obj T)
+}
+
+// runOptions of Run.
+type runOptions[T any] struct {
+	// itemTimeout is the time limit to process an item, zero means no limit.
+	itemTimeout time.Duration
+	// drain drains the queue when ctx is done, instead of closing it.
+	drain bool
+	// drainTimeout is the time limit to drain the queue, zero means no limit.
+	drainTimeout time.Duration
+	// errorHandler is called with the item and the error of a failed process.
+	errorHandler func(obj T, err error)
+}
+
+// RunOption for Run.
+type RunOption[T any] func(*runOptions[T])
+
+// WithItemTimeout limits the time to process an item. The context passed to
+// the ProcessFunc is done once the time is up, and the worker stops waiting
+// for it and reports context.DeadlineExceeded, so a stuck item can not block
+// a worker forever. A ProcessFunc which ignores the context keeps running
+// in the background, the item stays in flight until it returns, and then it
+// is requeued like an ErrRequeue with context.DeadlineExceeded. Run waits
+// for such a ProcessFunc before it returns.
+func WithItemTimeout[T any](d time.Duration) RunOption[T] {
+	return func(o *runOptions[T]) {
+		o.itemTimeout = d
+	}
+}
+
+// WithDrain makes Run drain the queue once ctx is done, if the queue supports
+// ShutDownWithDrain like FIFO, instead of closing it at once. The queued items
+// are still processed, with a context which is not canceled along with ctx.
+// An item requeued while draining is accepted by a queue which has a Requeue,
+// like FIFO, until the queue is closed, otherwise it is rejected with ErrFIFOClosed.
+// timeout limits the time to drain, zero means no limit.
+func WithDrain[T any](timeout time.Duration) RunOption[T] {
+	return func(o *runOptions[T]) {
+		o.drain = true
+		o.drainTimeout = timeout
+	}
+}
+
+// WithErrorHandler set the function which is called with the item and the error
+// of a failed process, including a *PanicError, an error of the queue while
+// requeueing, and context.DeadlineExceeded of WithItemTimeout.
+// The errors are dropped if it is not set.
+func WithErrorHandler[T any](handler func(obj T, err error)) RunOption[T] {
+	return func(o *runOptions[T]) {
+		o.errorHandler = handler
+	}
+}
+
+// Run starts workers goroutines, at least one, which pop the items from queue
+// and process them until ctx is done. It blocks until all the workers have returned.
+//
+// The item is popped under the lock of the queue, but processed outside of it,
+// so the workers process the items concurrently. An item whose process returns
+// an ErrRequeue is added back with the Requeue of the queue if it has one, like
+// FIFO, so it counts against WithMaxRequeues, otherwise with AddIfNotPresent.
+// A panic of process is recovered into a *PanicError, see WithErrorHandler.
+//
+// Once ctx is done, the queue is closed, and the workers return after their
+// current item. With WithDrain the queue is drained first.
+// Run returns the error of ShutDownWithDrain, if any.
+func Run[T any](ctx context.Context, queue Queue[T], workers int, process ProcessFunc[T], opts ...RunOption[T]) error {
+	o := &runOptions[T]{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	d, drain := queue.(drainer)
+	drain = drain && o.drain
+	retry, _ := queue.(retrier[T])
+	pop := func(ctx context.Context) (T, error) {
+		return queue.PopContext(ctx, nil)
+	}
+	if p, ok := queue.(runPopper[T]); ok {
+		pop = p.popForRun
+	}
+
+	popCtx, processCtx := ctx, ctx
+	if drain {
+		// the workers pop until the queue is closed after the drain.
+		popCtx = context.Background()
+		processCtx = context.WithoutCancel(ctx)
+	}
+
+	workers = max(workers, 1)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for popCtx.Err() == nil {
+				obj, err := pop(popCtx)
+				if err != nil {
+					if errors.Is(err, ErrFIFOClosed) || popCtx.Err() != nil {
+						return
+					}
+					o.handleError(obj, err)
+					continue
+				}
+				late, err := o.process(processCtx, process, obj)
+				if late != nil {
+					// the item stays in flight until its process returns.
+					o.handleError(obj, err)
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						<-late
+						if err := finish(queue, retry, obj, ErrRequeue{Err: context.DeadlineExceeded}); err != context.DeadlineExceeded {
+							o.handleError(obj, err)
+						}
+					}()
+					continue
+				}
+				if err = finish(queue, retry, obj, err); err != nil {
+					o.handleError(obj, err)
+				}
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	var err error
+	if drain {
+		drainCtx := context.Background()
+		if o.drainTimeout > 0 {
+			var cancel context.CancelFunc
+			drainCtx, cancel = context.WithTimeout(drainCtx, o.drainTimeout)
+			defer cancel()
+		}
+		err = d.ShutDownWithDrain(drainCtx)
+	} else {
+		queue.Close()
+	}
+	wg.Wait()
+	return err
+}
+
+// finish reports the result of processing obj to the queue, it returns the
+// error to report, if any.
+func finish[T any](queue Queue[T], retry retrier[T], obj T, err error) error {
+	var e ErrRequeue
+	switch {
+	case !errors.As(err, &e):
+		if retry != nil {
+			retry.Forget(obj)
+		}
+	case retry != nil:
+		if err = retry.Requeue(obj, e.Err); err == nil {
+			err = e.Err
+		}
+	default:
+		if err = queue.AddIfNotPresent(obj); err == nil {
+			err = e.Err
+		}
+	}
+	return err
+}
+
+// process calls process with obj, under the item timeout if it is set.
+// If the time is up first, it returns a channel which is closed once
+// process returns, and ctx.Err().
+func (o *runOptions[T]) process(ctx context.Context, process ProcessFunc[T], obj T) (<-chan struct{}, error) {
+	if o.itemTimeout <= 0 {
+		return nil, safeProcess(ctx, process, obj)
+	}
+	ctx, cancel := context.WithTimeout(ctx, o.itemTimeout)
+	defer cancel()
+	var err error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err = safeProcess(ctx, process, obj)
+	}()
+	select {
+	case <-done:
+		return nil, err
+	case <-ctx.Done():
+		return done, ctx.Err()
+	}
+}
+
+func (o *runOptions[T]) handleError(obj T, err error) {
+	if o.errorHandler != nil {
+		o.errorHandler(obj, err)
+	}
+}
+
+// safeProcess calls process with obj, and recovers a panic into a *PanicError.
+func safeProcess[T any](ctx context.Context, process ProcessFunc[T], obj T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return process(ctx, obj)
+}
@@ -0,0 +1,265 @@
+package fifo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testErrors collects the errors reported to the error handler of Run.
+type testErrors struct {
+	mu   sync.Mutex
+	errs map[string]error
+}
+
+func (e *testErrors) handle(obj testFifoObject, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.errs == nil {
+		e.errs = map[string]error{}
+	}
+	e.errs[obj.name] = err
+}
+
+func (e *testErrors) get(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.errs[name]
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition never satisfied")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func Test_Run(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+	const amount = 100
+	for i := 0; i < amount; i++ {
+		f.Add(mkFifoObj(string([]rune{'a', rune(i)}), i)) // nolint: errcheck
+	}
+
+	var processed, concurrent, maxConcurrent atomic.Int64
+	var requeued atomic.Bool
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, Queue[testFifoObject](f), 4, func(_ context.Context, obj testFifoObject) error {
+			n := concurrent.Add(1)
+			defer concurrent.Add(-1)
+			for m := maxConcurrent.Load(); n > m && !maxConcurrent.CompareAndSwap(m, n); m = maxConcurrent.Load() {
+			}
+			time.Sleep(time.Millisecond)
+			if obj.val == 0 && requeued.CompareAndSwap(false, true) {
+				return ErrRequeue{}
+			}
+			processed.Add(1)
+			return nil
+		})
+	}()
+
+	waitFor(t, func() bool { return processed.Load() == amount })
+	if maxConcurrent.Load() < 2 {
+		t.Errorf("expected the items to be processed concurrently, got %v at most", maxConcurrent.Load())
+	}
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after ctx is done")
+	}
+	if !f.IsClosed() {
+		t.Errorf("expected the queue to be closed")
+	}
+}
+
+func Test_Run_panicAndTimeout(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+	f.Add(mkFifoObj("panic", 1)) // nolint: errcheck
+	f.Add(mkFifoObj("stuck", 2)) // nolint: errcheck
+	f.Add(mkFifoObj("fail", 3))  // nolint: errcheck
+	f.Add(mkFifoObj("ok", 4))    // nolint: errcheck
+
+	errs := &testErrors{}
+	var ok atomic.Bool
+	unblock := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, Queue[testFifoObject](f), 1, func(ctx context.Context, obj testFifoObject) error {
+			switch obj.name {
+			case "panic":
+				panic("boom")
+			case "stuck":
+				// ignores ctx, the only worker must not be blocked by it.
+				<-unblock
+			case "fail":
+				return ErrRequeue{Err: errors.New("failed")}
+			case "ok":
+				ok.Store(true)
+			}
+			return nil
+		}, WithItemTimeout[testFifoObject](10*time.Millisecond), WithErrorHandler(errs.handle))
+	}()
+
+	waitFor(t, ok.Load)
+	var panicErr *PanicError
+	if err := errs.get("panic"); !errors.As(err, &panicErr) || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Errorf("expected a *PanicError of boom, got %v", err)
+	}
+	if err := errs.get("stuck"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if err := errs.get("fail"); err == nil || err.Error() != "failed" {
+		t.Errorf("expected the inner error of ErrRequeue, got %v", err)
+	}
+	cancel()
+	// Run waits for the stuck process.
+	close(unblock)
+	<-done
+}
+
+func Test_Run_timeoutInFlight(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+
+	errs := &testErrors{}
+	var attempts atomic.Int64
+	unblock := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, Queue[testFifoObject](f), 2, func(ctx context.Context, obj testFifoObject) error {
+			if attempts.Add(1) == 1 {
+				// ignores ctx.
+				<-unblock
+			}
+			return nil
+		}, WithItemTimeout[testFifoObject](10*time.Millisecond), WithErrorHandler(errs.handle))
+	}()
+
+	waitFor(t, func() bool { return errs.get("foo") != nil })
+	if err := errs.get("foo"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	// the timed out item stays in flight until its process returns.
+	f.rw.RLock()
+	inFlight := f.inFlight["foo"]
+	f.rw.RUnlock()
+	if inFlight != 1 {
+		t.Errorf("expected the item to be in flight, got %v", inFlight)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if a := attempts.Load(); a != 1 {
+		t.Errorf("expected 1 attempt while the process is stuck, got %v", a)
+	}
+
+	// then it is requeued, and processed again.
+	close(unblock)
+	waitFor(t, func() bool { return attempts.Load() == 2 })
+	waitFor(t, func() bool {
+		f.rw.RLock()
+		defer f.rw.RUnlock()
+		return len(f.inFlight) == 0 && len(f.requeues) == 0
+	})
+	cancel()
+	<-done
+}
+
+func Test_Run_drain(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+	var processed atomic.Int64
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, Queue[testFifoObject](f), 1, func(ctx context.Context, obj testFifoObject) error {
+			if obj.name == "first" {
+				close(started)
+				<-release
+			}
+			if ctx.Err() != nil {
+				t.Errorf("the item %v is processed with a canceled context", obj.name)
+			}
+			processed.Add(1)
+			return nil
+		}, WithDrain[testFifoObject](time.Second))
+	}()
+
+	f.Add(mkFifoObj("first", 1)) // nolint: errcheck
+	<-started
+	f.Add(mkFifoObj("a", 2)) // nolint: errcheck
+	f.Add(mkFifoObj("b", 3)) // nolint: errcheck
+	// the queued items are still processed after ctx is done.
+	cancel()
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the queue is drained")
+	}
+	if e, a := int64(3), processed.Load(); e != a {
+		t.Errorf("expected %v items processed, got %v", e, a)
+	}
+	if !f.IsClosed() {
+		t.Errorf("expected the queue to be closed")
+	}
+}
+
+func Test_Run_drainInFlight(t *testing.T) {
+	f := New(testFifoObjectKeyFunc)
+	var attempts atomic.Int64
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Run(ctx, Queue[testFifoObject](f), 1, func(context.Context, testFifoObject) error {
+			if attempts.Add(1) == 1 {
+				close(started)
+				<-release
+				return ErrRequeue{Err: errors.New("retry")}
+			}
+			return nil
+		}, WithDrain[testFifoObject](time.Second))
+	}()
+
+	f.Add(mkFifoObj("foo", 1)) // nolint: errcheck
+	<-started
+	// the queue is empty, but the drain waits for the item in flight.
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	if f.IsClosed() {
+		t.Fatal("expected the queue not to be closed while an item is in flight")
+	}
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the queue is drained")
+	}
+	if e, a := int64(2), attempts.Load(); e != a {
+		t.Errorf("expected %v attempts, got %v", e, a)
+	}
+}
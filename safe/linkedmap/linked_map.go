@@ -0,0 +1,200 @@
+// Package linkedmap implements a thread-safe LinkedMap, which protects the
+// LinkedMap of the container/linkedmap package with a sync.RWMutex.
+package linkedmap
+
+import (
+	"sync"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/linkedmap"
+)
+
+var _ container.LinkedMap[int, int] = (*LinkedMap[int, int])(nil)
+
+// LinkedMap is a thread-safe LinkedMap, which protects an inner LinkedMap
+// with a sync.RWMutex. The iterators iterate over a snapshot of the map, so
+// the callback may call the methods of the map. Use Atomically to make
+// multi-step operations atomic.
+type LinkedMap[K comparable, V any] struct {
+	rw    sync.RWMutex
+	inner container.LinkedMap[K, V]
+}
+
+// entry is a mapping of the snapshot of LinkedMap.
+type entry[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+// New creates a thread-safe LinkedMap of linkedmap.LinkedMap, see linkedmap.New.
+func New[K comparable, V any](opts ...linkedmap.Option[K, V]) *LinkedMap[K, V] {
+	return Wrap[K, V](linkedmap.New(opts...))
+}
+
+// Wrap creates a thread-safe LinkedMap which protects inner,
+// inner must not be used directly from now on.
+func Wrap[K comparable, V any](inner container.LinkedMap[K, V]) *LinkedMap[K, V] {
+	return &LinkedMap[K, V]{inner: inner}
+}
+
+// Cap returns the capacity of this map.
+func (lm *LinkedMap[K, V]) Cap() int {
+	lm.rw.RLock()
+	defer lm.rw.RUnlock()
+	return lm.inner.Cap()
+}
+
+// Len returns the number of mappings of this map.
+func (lm *LinkedMap[K, V]) Len() int {
+	lm.rw.RLock()
+	defer lm.rw.RUnlock()
+	return lm.inner.Len()
+}
+
+// IsEmpty returns true if this map contains no mappings.
+func (lm *LinkedMap[K, V]) IsEmpty() bool {
+	lm.rw.RLock()
+	defer lm.rw.RUnlock()
+	return lm.inner.IsEmpty()
+}
+
+// Clear removes all the mappings from this map.
+func (lm *LinkedMap[K, V]) Clear() {
+	lm.rw.Lock()
+	defer lm.rw.Unlock()
+	lm.inner.Clear()
+}
+
+// Push associates v with k in this map, see linkedmap.LinkedMap.Push.
+func (lm *LinkedMap[K, V]) Push(k K, v V) (V, bool) {
+	lm.rw.Lock()
+	defer lm.rw.Unlock()
+	return lm.inner.Push(k, v)
+}
+
+// PushFront associates v with k in this map, and moves it to the front,
+// see linkedmap.LinkedMap.PushFront.
+func (lm *LinkedMap[K, V]) PushFront(k K, v V) (V, bool) {
+	lm.rw.Lock()
+	defer lm.rw.Unlock()
+	return lm.inner.PushFront(k, v)
+}
+
+// PushBack associates v with k in this map, and moves it to the back,
+// see linkedmap.LinkedMap.PushBack.
+func (lm *LinkedMap[K, V]) PushBack(k K, v V) (V, bool) {
+	lm.rw.Lock()
+	defer lm.rw.Unlock()
+	return lm.inner.PushBack(k, v)
+}
+
+// Poll removes and returns the front mapping of this map, or returns false if it is empty.
+func (lm *LinkedMap[K, V]) Poll() (K, V, bool) {
+	lm.rw.Lock()
+	defer lm.rw.Unlock()
+	return lm.inner.Poll()
+}
+
+// PollFront removes and returns the front mapping of this map, or returns false if it is empty.
+func (lm *LinkedMap[K, V]) PollFront() (K, V, bool) {
+	lm.rw.Lock()
+	defer lm.rw.Unlock()
+	return lm.inner.PollFront()
+}
+
+// PollBack removes and returns the back mapping of this map, or returns false if it is empty.
+func (lm *LinkedMap[K, V]) PollBack() (K, V, bool) {
+	lm.rw.Lock()
+	defer lm.rw.Unlock()
+	return lm.inner.PollBack()
+}
+
+// Remove removes the mapping of k from this map if it is present,
+// and returns its value.
+func (lm *LinkedMap[K, V]) Remove(k K) (V, bool) {
+	lm.rw.Lock()
+	defer lm.rw.Unlock()
+	return lm.inner.Remove(k)
+}
+
+// Get returns the value of k, or the defaultValue if there is no mapping of k.
+// It takes the write lock, as it moves the mapping to the back.
+func (lm *LinkedMap[K, V]) Get(k K, defaultValue ...V) V {
+	lm.rw.Lock()
+	defer lm.rw.Unlock()
+	return lm.inner.Get(k, defaultValue...)
+}
+
+// Peek returns the front mapping of this map.
+func (lm *LinkedMap[K, V]) Peek() (K, V, bool) {
+	lm.rw.RLock()
+	defer lm.rw.RUnlock()
+	return lm.inner.Peek()
+}
+
+// PeekFront returns the front mapping of this map.
+func (lm *LinkedMap[K, V]) PeekFront() (K, V, bool) {
+	lm.rw.RLock()
+	defer lm.rw.RUnlock()
+	return lm.inner.PeekFront()
+}
+
+// PeekBack returns the back mapping of this map.
+func (lm *LinkedMap[K, V]) PeekBack() (K, V, bool) {
+	lm.rw.RLock()
+	defer lm.rw.RUnlock()
+	return lm.inner.PeekBack()
+}
+
+// Iterator iterates over a snapshot of the mappings in this map in proper sequence.
+func (lm *LinkedMap[K, V]) Iterator(cb func(k K, v V) bool) {
+	for _, e := range lm.snapshot() {
+		if cb == nil || !cb(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// ReverseIterator iterates over a snapshot of the mappings in this map in reverse sequence.
+func (lm *LinkedMap[K, V]) ReverseIterator(cb func(k K, v V) bool) {
+	entries := lm.snapshot()
+	for i := len(entries) - 1; i >= 0; i-- {
+		if cb == nil || !cb(entries[i].key, entries[i].value) {
+			return
+		}
+	}
+}
+
+// Contains returns true if this map contains a mapping of k.
+func (lm *LinkedMap[K, V]) Contains(k K) bool {
+	lm.rw.RLock()
+	defer lm.rw.RUnlock()
+	return lm.inner.Contains(k)
+}
+
+// ContainsValue returns true if this map maps one or more keys to v.
+func (lm *LinkedMap[K, V]) ContainsValue(v V, equal func(a, b V) bool) bool {
+	lm.rw.RLock()
+	defer lm.rw.RUnlock()
+	return lm.inner.ContainsValue(v, equal)
+}
+
+// Atomically calls f with the inner LinkedMap under the lock, so the steps of f
+// are atomic. f must not call the methods of lm, nor keep inner after it returns.
+func (lm *LinkedMap[K, V]) Atomically(f func(inner container.LinkedMap[K, V])) {
+	lm.rw.Lock()
+	defer lm.rw.Unlock()
+	f(lm.inner)
+}
+
+// snapshot returns a copy of the mappings in proper sequence.
+func (lm *LinkedMap[K, V]) snapshot() []entry[K, V] {
+	lm.rw.RLock()
+	defer lm.rw.RUnlock()
+	entries := make([]entry[K, V], 0, lm.inner.Len())
+	lm.inner.Iterator(func(k K, v V) bool {
+		entries = append(entries, entry[K, V]{k, v})
+		return true
+	})
+	return entries
+}
@@ -0,0 +1,103 @@
+package linkedmap
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/linkedmap"
+)
+
+func Test_LinkedMap(t *testing.T) {
+	lm := New(linkedmap.WithCap[string, int](3))
+	assert.Equal(t, 3, lm.Cap())
+	lm.Push("b", 2)
+	lm.PushBack("c", 3)
+	lm.PushFront("a", 1)
+	assert.Equal(t, 3, lm.Len())
+	assert.False(t, lm.IsEmpty())
+	assert.True(t, lm.Contains("a"))
+	assert.True(t, lm.ContainsValue(2, func(a, b int) bool { return a == b }))
+
+	k, v, ok := lm.Peek()
+	assert.True(t, ok)
+	assert.Equal(t, "a", k)
+	assert.Equal(t, 1, v)
+	k, _, _ = lm.PeekFront()
+	assert.Equal(t, "a", k)
+	k, _, _ = lm.PeekBack()
+	assert.Equal(t, "c", k)
+
+	// Get moves the mapping to the back.
+	assert.Equal(t, 1, lm.Get("a"))
+	assert.Equal(t, 9, lm.Get("x", 9))
+	k, _, _ = lm.PeekBack()
+	assert.Equal(t, "a", k)
+
+	k, _, _ = lm.Poll()
+	assert.Equal(t, "b", k)
+	k, _, _ = lm.PollBack()
+	assert.Equal(t, "a", k)
+	k, _, _ = lm.PollFront()
+	assert.Equal(t, "c", k)
+
+	lm.Push("d", 4)
+	v, ok = lm.Remove("d")
+	assert.True(t, ok)
+	assert.Equal(t, 4, v)
+	lm.Push("e", 5)
+	lm.Clear()
+	assert.True(t, lm.IsEmpty())
+}
+
+func Test_LinkedMap_Iterator(t *testing.T) {
+	lm := New[string, int]()
+	lm.Push("a", 1)
+	lm.Push("b", 2)
+	lm.Push("c", 3)
+
+	// the callback may change the map, which does not affect the iteration.
+	var keys []string
+	lm.Iterator(func(k string, _ int) bool {
+		keys = append(keys, k)
+		lm.Remove(k)
+		return true
+	})
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+	assert.True(t, lm.IsEmpty())
+
+	lm.Push("a", 1)
+	lm.Push("b", 2)
+	keys = keys[:0]
+	lm.ReverseIterator(func(k string, _ int) bool {
+		keys = append(keys, k)
+		return false
+	})
+	assert.Equal(t, []string{"b"}, keys)
+}
+
+func Test_LinkedMap_Concurrent(t *testing.T) {
+	lm := New[int, int]()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				lm.Push(i*500+j, j)
+				lm.Get(j)
+				lm.Iterator(func(int, int) bool { return true })
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 4000, lm.Len())
+
+	// increment a value in one step.
+	lm.Atomically(func(inner container.LinkedMap[int, int]) {
+		inner.Push(1, inner.Get(1)+1)
+	})
+	assert.Equal(t, 2, lm.Get(1))
+}
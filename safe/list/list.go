@@ -0,0 +1,194 @@
+// Package list implements a thread-safe List, which protects the ArrayList
+// and the LinkedList of the container packages with a sync.RWMutex.
+package list
+
+import (
+	"sync"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/arraylist"
+	"github.com/things-go/container/linkedlist"
+)
+
+var _ container.List[int] = (*List[int])(nil)
+
+// List is a thread-safe List, which protects an inner List with a
+// sync.RWMutex. The iterators iterate over a snapshot of the list, so the
+// callback may call the methods of the list. Use Atomically to make
+// multi-step operations atomic.
+type List[T comparable] struct {
+	rw    sync.RWMutex
+	inner container.List[T]
+}
+
+// NewArrayList creates a thread-safe List of arraylist.List.
+func NewArrayList[T comparable]() *List[T] { return Wrap[T](arraylist.New[T]()) }
+
+// NewLinkedList creates a thread-safe List of linkedlist.LinkedList.
+func NewLinkedList[T comparable]() *List[T] { return Wrap[T](linkedlist.New[T]()) }
+
+// Wrap creates a thread-safe List which protects inner,
+// inner must not be used directly from now on.
+func Wrap[T comparable](inner container.List[T]) *List[T] { return &List[T]{inner: inner} }
+
+// Len returns the number of elements of this list.
+func (l *List[T]) Len() int {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return l.inner.Len()
+}
+
+// IsEmpty returns true if this list contains no elements.
+func (l *List[T]) IsEmpty() bool {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return l.inner.IsEmpty()
+}
+
+// Clear removes all the elements from this list.
+func (l *List[T]) Clear() {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	l.inner.Clear()
+}
+
+// Push appends val to the end of this list.
+func (l *List[T]) Push(val T) {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	l.inner.Push(val)
+}
+
+// PushFront inserts val at the front of this list.
+func (l *List[T]) PushFront(val T) {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	l.inner.PushFront(val)
+}
+
+// PushBack inserts val at the back of this list.
+func (l *List[T]) PushBack(val T) {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	l.inner.PushBack(val)
+}
+
+// Add inserts val at the specified position in this list.
+func (l *List[T]) Add(index int, val T) error {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	return l.inner.Add(index, val)
+}
+
+// Poll returns the front element value and then removes it from this list.
+func (l *List[T]) Poll() (T, bool) {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	return l.inner.Poll()
+}
+
+// PollFront returns the front element value and then removes it from this list.
+func (l *List[T]) PollFront() (T, bool) {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	return l.inner.PollFront()
+}
+
+// PollBack returns the back element value and then removes it from this list.
+func (l *List[T]) PollBack() (T, bool) {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	return l.inner.PollBack()
+}
+
+// Remove removes the element at the specified position in this list.
+// It returns an error if the index is out of range.
+func (l *List[T]) Remove(index int) (T, error) {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	return l.inner.Remove(index)
+}
+
+// RemoveValue removes the first occurrence of val from this list, if it is present.
+// It returns false if the val isn't present, otherwise returns true.
+func (l *List[T]) RemoveValue(val T) bool {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	return l.inner.RemoveValue(val)
+}
+
+// Get returns the element at the specified position in this list.
+func (l *List[T]) Get(index int) (T, error) {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return l.inner.Get(index)
+}
+
+// Peek returns the front element value.
+func (l *List[T]) Peek() (T, bool) {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return l.inner.Peek()
+}
+
+// PeekFront returns the front element value.
+func (l *List[T]) PeekFront() (T, bool) {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return l.inner.PeekFront()
+}
+
+// PeekBack returns the back element value.
+func (l *List[T]) PeekBack() (T, bool) {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return l.inner.PeekBack()
+}
+
+// Iterator iterates over a snapshot of the elements in this list in proper sequence.
+func (l *List[T]) Iterator(f func(T) bool) {
+	for _, v := range l.Values() {
+		if f == nil || !f(v) {
+			return
+		}
+	}
+}
+
+// ReverseIterator iterates over a snapshot of the elements in this list in reverse sequence.
+func (l *List[T]) ReverseIterator(f func(T) bool) {
+	values := l.Values()
+	for i := len(values) - 1; i >= 0; i-- {
+		if f == nil || !f(values[i]) {
+			return
+		}
+	}
+}
+
+// Contains returns true if this list contains val.
+func (l *List[T]) Contains(val T) bool {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return l.inner.Contains(val)
+}
+
+// Sort sorts the elements of this list by less.
+func (l *List[T]) Sort(less func(a, b T) int) {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	l.inner.Sort(less)
+}
+
+// Values returns a copy of all the values in this list.
+func (l *List[T]) Values() []T {
+	l.rw.RLock()
+	defer l.rw.RUnlock()
+	return l.inner.Values()
+}
+
+// Atomically calls f with the inner List under the lock, so the steps of f
+// are atomic. f must not call the methods of l, nor keep inner after it returns.
+func (l *List[T]) Atomically(f func(inner container.List[T])) {
+	l.rw.Lock()
+	defer l.rw.Unlock()
+	f(l.inner)
+}
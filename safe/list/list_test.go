@@ -0,0 +1,105 @@
+package list
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/container"
+)
+
+func Test_List(t *testing.T) {
+	for _, l := range []*List[int]{NewArrayList[int](), NewLinkedList[int]()} {
+		l.Push(2)
+		l.PushBack(3)
+		l.PushFront(1)
+		require.NoError(t, l.Add(3, 4))
+		require.Error(t, l.Add(10, 5))
+		assert.Equal(t, []int{1, 2, 3, 4}, l.Values())
+		assert.Equal(t, 4, l.Len())
+		assert.False(t, l.IsEmpty())
+		assert.True(t, l.Contains(3))
+
+		v, err := l.Get(1)
+		require.NoError(t, err)
+		assert.Equal(t, 2, v)
+		v, _ = l.Peek()
+		assert.Equal(t, 1, v)
+		v, _ = l.PeekFront()
+		assert.Equal(t, 1, v)
+		v, _ = l.PeekBack()
+		assert.Equal(t, 4, v)
+
+		l.Sort(func(a, b int) int { return b - a })
+		assert.Equal(t, []int{4, 3, 2, 1}, l.Values())
+		v, _ = l.Poll()
+		assert.Equal(t, 4, v)
+		v, _ = l.PollFront()
+		assert.Equal(t, 3, v)
+		v, _ = l.PollBack()
+		assert.Equal(t, 1, v)
+		assert.True(t, l.RemoveValue(2))
+		assert.False(t, l.RemoveValue(2))
+
+		l.Push(5)
+		v, err = l.Remove(0)
+		require.NoError(t, err)
+		assert.Equal(t, 5, v)
+		l.Push(6)
+		l.Clear()
+		assert.True(t, l.IsEmpty())
+	}
+}
+
+func Test_List_Iterator(t *testing.T) {
+	l := NewArrayList[int]()
+	l.Push(1)
+	l.Push(2)
+	l.Push(3)
+
+	// the callback may change the list, which does not affect the iteration.
+	var got []int
+	l.Iterator(func(v int) bool {
+		got = append(got, v)
+		l.PushBack(v * 10)
+		return true
+	})
+	assert.Equal(t, []int{1, 2, 3}, got)
+	assert.Equal(t, 6, l.Len())
+
+	got = got[:0]
+	l.ReverseIterator(func(v int) bool {
+		got = append(got, v)
+		return len(got) < 2
+	})
+	assert.Equal(t, []int{30, 20}, got)
+}
+
+func Test_List_Concurrent(t *testing.T) {
+	l := NewLinkedList[int]()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				l.PushBack(j)
+				l.Contains(j)
+				l.Iterator(func(int) bool { return true })
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 4000, l.Len())
+
+	// remove the values below 100 in one step.
+	l.Atomically(func(inner container.List[int]) {
+		for i := 0; i < 100; i++ {
+			for inner.RemoveValue(i) {
+			}
+		}
+	})
+	assert.Equal(t, 3200, l.Len())
+}
@@ -0,0 +1,127 @@
+package queue
+
+import (
+	"sync/atomic"
+)
+
+// cacheLineSize is the assumed size of a cache line, the hot fields of MPMC
+// are padded to it against false sharing.
+const cacheLineSize = 64
+
+// mpmcCell is a slot of the ring buffer of MPMC. seq tells the state of the
+// slot to the producers and the consumers: it is the position of the next
+// enqueue which may write it, or that position plus one once it is written.
+type mpmcCell[T any] struct {
+	seq atomic.Uint64
+	val T
+}
+
+// MPMC is a lock-free bounded multi-producer multi-consumer queue, a ring
+// buffer of sequence-numbered slots in the style of Dmitry Vyukov's bounded
+// MPMC queue. Enqueues and dequeues never take a lock, they claim a slot
+// with a single compare-and-swap, and never block, TryEnqueue fails once the
+// queue is full, TryDequeue once it is empty.
+//
+// It implements the non-blocking subset of container.Queue: Len, IsEmpty
+// and Poll. Add, Peek, Remove, Contains and Clear can not be implemented
+// without a lock, use TryEnqueue instead of Add.
+type MPMC[T any] struct {
+	_ [cacheLineSize]byte
+	// enqueuePos is the position of the next enqueue.
+	enqueuePos atomic.Uint64
+	_          [cacheLineSize - 8]byte
+	// dequeuePos is the position of the next dequeue.
+	dequeuePos atomic.Uint64
+	_          [cacheLineSize - 8]byte
+	mask       uint64
+	cells      []mpmcCell[T]
+}
+
+// NewMPMC creates a MPMC whose capacity is capacity rounded up to a power of
+// two, at least 2.
+func NewMPMC[T any](capacity int) *MPMC[T] {
+	size := uint64(2)
+	for size < uint64(capacity) {
+		size <<= 1
+	}
+	q := &MPMC[T]{
+		mask:  size - 1,
+		cells: make([]mpmcCell[T], size),
+	}
+	for i := range q.cells {
+		q.cells[i].seq.Store(uint64(i))
+	}
+	return q
+}
+
+// Cap returns the capacity of the queue.
+func (q *MPMC[T]) Cap() int { return len(q.cells) }
+
+// Len returns the number of the elements in the queue. It is a snapshot
+// which may be stale once it returns, as other goroutines go on.
+func (q *MPMC[T]) Len() int {
+	// load dequeuePos first, so it is never past enqueuePos.
+	dequeuePos := q.dequeuePos.Load()
+	enqueuePos := q.enqueuePos.Load()
+	return int(min(enqueuePos-dequeuePos, q.mask+1))
+}
+
+// IsEmpty returns true if the queue contains no elements, like Len it is a snapshot.
+func (q *MPMC[T]) IsEmpty() bool { return q.Len() == 0 }
+
+// TryEnqueue inserts val into the tail of the queue, it returns false if the queue is full.
+func (q *MPMC[T]) TryEnqueue(val T) bool {
+	pos := q.enqueuePos.Load()
+	for {
+		cell := &q.cells[pos&q.mask]
+		seq := cell.seq.Load()
+		switch diff := int64(seq - pos); {
+		case diff == 0:
+			// the slot is free, claim it.
+			if q.enqueuePos.CompareAndSwap(pos, pos+1) {
+				cell.val = val
+				cell.seq.Store(pos + 1)
+				return true
+			}
+			pos = q.enqueuePos.Load()
+		case diff < 0:
+			// the slot is not dequeued yet since the last lap, the queue is full.
+			return false
+		default:
+			// another producer has claimed the slot, catch up.
+			pos = q.enqueuePos.Load()
+		}
+	}
+}
+
+// TryDequeue retrieves and removes the head of the queue, it returns false if the queue is empty.
+func (q *MPMC[T]) TryDequeue() (val T, ok bool) {
+	var placeholder T
+
+	pos := q.dequeuePos.Load()
+	for {
+		cell := &q.cells[pos&q.mask]
+		seq := cell.seq.Load()
+		switch diff := int64(seq - (pos + 1)); {
+		case diff == 0:
+			// the slot is written, claim it.
+			if q.dequeuePos.CompareAndSwap(pos, pos+1) {
+				val = cell.val
+				cell.val = placeholder // should set nil for gc
+				// free the slot for the enqueue of the next lap.
+				cell.seq.Store(pos + q.mask + 1)
+				return val, true
+			}
+			pos = q.dequeuePos.Load()
+		case diff < 0:
+			// the slot is not written yet, the queue is empty.
+			return val, false
+		default:
+			// another consumer has claimed the slot, catch up.
+			pos = q.dequeuePos.Load()
+		}
+	}
+}
+
+// Poll is the same as TryDequeue.
+func (q *MPMC[T]) Poll() (T, bool) { return q.TryDequeue() }
@@ -0,0 +1,33 @@
+package queue
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/things-go/container/queue"
+)
+
+func BenchmarkMPMC(b *testing.B) {
+	q := NewMPMC[int](1024)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			q.TryEnqueue(1)
+			q.TryDequeue()
+		}
+	})
+}
+
+func BenchmarkMutexQuickQueue(b *testing.B) {
+	var mu sync.Mutex
+	q := queue.NewQuickQueue[int]()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			mu.Lock()
+			q.Add(1)
+			mu.Unlock()
+			mu.Lock()
+			q.Poll()
+			mu.Unlock()
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package queue
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MPMC(t *testing.T) {
+	assert.Equal(t, 2, NewMPMC[int](0).Cap())
+	assert.Equal(t, 8, NewMPMC[int](5).Cap())
+
+	q := NewMPMC[int](4)
+	assert.True(t, q.IsEmpty())
+	_, ok := q.TryDequeue()
+	assert.False(t, ok)
+
+	for i := 0; i < 4; i++ {
+		assert.True(t, q.TryEnqueue(i))
+	}
+	assert.False(t, q.TryEnqueue(4))
+	assert.Equal(t, 4, q.Len())
+
+	// wrap around the ring buffer.
+	for lap := 0; lap < 3; lap++ {
+		for i := 0; i < 4; i++ {
+			v, ok := q.Poll()
+			assert.True(t, ok)
+			assert.Equal(t, lap*4+i, v)
+			assert.True(t, q.TryEnqueue(lap*4+i+4))
+		}
+	}
+	assert.Equal(t, 4, q.Len())
+}
+
+func Test_MPMC_Concurrent(t *testing.T) {
+	const producers, consumers, n = 4, 4, 2000
+	q := NewMPMC[int](64)
+	enqueue := func(v int) {
+		for !q.TryEnqueue(v) {
+			runtime.Gosched()
+		}
+	}
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				enqueue(p*n + i)
+			}
+		}(p)
+	}
+	results := make(chan []int, consumers)
+	for c := 0; c < consumers; c++ {
+		go func() {
+			var got []int
+			for {
+				v, ok := q.TryDequeue()
+				switch {
+				case !ok:
+					runtime.Gosched()
+				case v < 0:
+					results <- got
+					return
+				default:
+					got = append(got, v)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	// stop the consumers once they have dequeued all the elements.
+	for c := 0; c < consumers; c++ {
+		enqueue(-1)
+	}
+
+	seen := make([]bool, producers*n)
+	for c := 0; c < consumers; c++ {
+		last := make(map[int]int)
+		for _, v := range <-results {
+			assert.False(t, seen[v], "duplicate %d", v)
+			seen[v] = true
+			// the elements of a producer are dequeued in order by each consumer.
+			if prev, ok := last[v/n]; ok {
+				assert.Less(t, prev, v)
+			}
+			last[v/n] = v
+		}
+	}
+	for v, ok := range seen {
+		assert.True(t, ok, "missing %d", v)
+	}
+}
@@ -0,0 +1,106 @@
+// Package queue implements a thread-safe Queue, which protects the Queues
+// of the container/queue package with a sync.RWMutex, and MPMC, a lock-free
+// bounded multi-producer multi-consumer queue.
+package queue
+
+import (
+	"cmp"
+	"sync"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/comparator"
+	"github.com/things-go/container/queue"
+)
+
+var _ container.Queue[int] = (*Queue[int])(nil)
+
+// Queue is a thread-safe Queue, which protects an inner Queue with a
+// sync.RWMutex. Use Atomically to make multi-step operations atomic.
+type Queue[T comparable] struct {
+	rw    sync.RWMutex
+	inner container.Queue[T]
+}
+
+// New creates a thread-safe Queue of queue.Queue.
+func New[T comparable]() *Queue[T] { return Wrap[T](queue.New[T]()) }
+
+// NewQuick creates a thread-safe Queue of queue.QuickQueue.
+func NewQuick[T comparable]() *Queue[T] { return Wrap[T](queue.NewQuickQueue[T]()) }
+
+// NewPriority creates a thread-safe Queue of queue.PriorityQueue, see queue.NewPriorityQueue.
+func NewPriority[T cmp.Ordered](maxHeap bool, items ...T) *Queue[T] {
+	return Wrap[T](queue.NewPriorityQueue(maxHeap, items...))
+}
+
+// NewPriorityWith creates a thread-safe Queue of queue.PriorityQueue, see queue.NewPriorityQueueWith.
+func NewPriorityWith[T comparable](maxHeap bool, compare comparator.Comparable[T], items ...T) *Queue[T] {
+	return Wrap[T](queue.NewPriorityQueueWith(maxHeap, compare, items...))
+}
+
+// Wrap creates a thread-safe Queue which protects inner,
+// inner must not be used directly from now on.
+func Wrap[T comparable](inner container.Queue[T]) *Queue[T] { return &Queue[T]{inner: inner} }
+
+// Len returns the length of this queue.
+func (q *Queue[T]) Len() int {
+	q.rw.RLock()
+	defer q.rw.RUnlock()
+	return q.inner.Len()
+}
+
+// IsEmpty returns true if this queue contains no elements.
+func (q *Queue[T]) IsEmpty() bool {
+	q.rw.RLock()
+	defer q.rw.RUnlock()
+	return q.inner.IsEmpty()
+}
+
+// Clear removes all the elements from this queue.
+func (q *Queue[T]) Clear() {
+	q.rw.Lock()
+	defer q.rw.Unlock()
+	q.inner.Clear()
+}
+
+// Add inserts val into this queue.
+func (q *Queue[T]) Add(val T) {
+	q.rw.Lock()
+	defer q.rw.Unlock()
+	q.inner.Add(val)
+}
+
+// Peek retrieves, but does not remove, the head of this queue, or returns false if it is empty.
+func (q *Queue[T]) Peek() (T, bool) {
+	q.rw.RLock()
+	defer q.rw.RUnlock()
+	return q.inner.Peek()
+}
+
+// Poll retrieves and removes the head of this queue, or returns false if it is empty.
+func (q *Queue[T]) Poll() (T, bool) {
+	q.rw.Lock()
+	defer q.rw.Unlock()
+	return q.inner.Poll()
+}
+
+// Remove a single instance of val from this queue, if it is present.
+func (q *Queue[T]) Remove(val T) {
+	q.rw.Lock()
+	defer q.rw.Unlock()
+	q.inner.Remove(val)
+}
+
+// Contains returns true if this queue contains val.
+func (q *Queue[T]) Contains(val T) bool {
+	q.rw.RLock()
+	defer q.rw.RUnlock()
+	return q.inner.Contains(val)
+}
+
+// Atomically calls f with the inner Queue under the lock, so the steps of f
+// are atomic. f must not call the methods of q, nor keep inner after it returns.
+func (q *Queue[T]) Atomically(f func(inner container.Queue[T])) {
+	q.rw.Lock()
+	defer q.rw.Unlock()
+	f(q.inner)
+}
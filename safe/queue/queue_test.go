@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/things-go/container"
+)
+
+func Test_Queue(t *testing.T) {
+	for _, q := range []*Queue[int]{New[int](), NewQuick[int](), NewPriority[int](false)} {
+		q.Add(1)
+		q.Add(2)
+		q.Add(3)
+		assert.Equal(t, 3, q.Len())
+		assert.False(t, q.IsEmpty())
+		assert.True(t, q.Contains(2))
+
+		q.Remove(2)
+		assert.False(t, q.Contains(2))
+		v, ok := q.Peek()
+		assert.True(t, ok)
+		assert.Equal(t, 1, v)
+		v, ok = q.Poll()
+		assert.True(t, ok)
+		assert.Equal(t, 1, v)
+
+		q.Clear()
+		assert.True(t, q.IsEmpty())
+		_, ok = q.Poll()
+		assert.False(t, ok)
+	}
+
+	q := NewPriorityWith(true, func(a, b int) int { return a - b }, 1, 3, 2)
+	v, _ := q.Poll()
+	assert.Equal(t, 3, v)
+}
+
+func Test_Queue_Concurrent(t *testing.T) {
+	q := NewQuick[int]()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	polled := 0
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				q.Add(j)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				if _, ok := q.Poll(); ok {
+					mu.Lock()
+					polled++
+					mu.Unlock()
+				}
+				q.Contains(j)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 8000, q.Len()+polled)
+
+	// poll the head only if it is the expected one.
+	q.Clear()
+	q.Add(1)
+	q.Atomically(func(inner container.Queue[int]) {
+		if v, ok := inner.Peek(); ok && v == 1 {
+			inner.Poll()
+		}
+	})
+	assert.True(t, q.IsEmpty())
+}
@@ -0,0 +1,79 @@
+// Package stack implements a thread-safe Stack, which protects the Stacks
+// of the container/stack package with a sync.RWMutex.
+package stack
+
+import (
+	"sync"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/stack"
+)
+
+var _ container.Stack[int] = (*Stack[int])(nil)
+
+// Stack is a thread-safe Stack, which protects an inner Stack with a
+// sync.RWMutex. Use Atomically to make multi-step operations atomic.
+type Stack[T any] struct {
+	rw    sync.RWMutex
+	inner container.Stack[T]
+}
+
+// New creates a thread-safe Stack of stack.Stack.
+func New[T any]() *Stack[T] { return Wrap[T](stack.New[T]()) }
+
+// NewQuick creates a thread-safe Stack of stack.QuickStack.
+func NewQuick[T any]() *Stack[T] { return Wrap[T](stack.NewQuickStack[T]()) }
+
+// Wrap creates a thread-safe Stack which protects inner,
+// inner must not be used directly from now on.
+func Wrap[T any](inner container.Stack[T]) *Stack[T] { return &Stack[T]{inner: inner} }
+
+// Len returns the length of this stack.
+func (s *Stack[T]) Len() int {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return s.inner.Len()
+}
+
+// IsEmpty returns true if this stack contains no elements.
+func (s *Stack[T]) IsEmpty() bool {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return s.inner.IsEmpty()
+}
+
+// Clear removes all the elements from this stack.
+func (s *Stack[T]) Clear() {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	s.inner.Clear()
+}
+
+// Push pushes val onto the top of this stack.
+func (s *Stack[T]) Push(val T) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	s.inner.Push(val)
+}
+
+// Pop removes and returns the element on the top of this stack, or returns false if it is empty.
+func (s *Stack[T]) Pop() (T, bool) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	return s.inner.Pop()
+}
+
+// Peek returns, but does not remove, the element on the top of this stack, or returns false if it is empty.
+func (s *Stack[T]) Peek() (T, bool) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+	return s.inner.Peek()
+}
+
+// Atomically calls f with the inner Stack under the lock, so the steps of f
+// are atomic. f must not call the methods of s, nor keep inner after it returns.
+func (s *Stack[T]) Atomically(f func(inner container.Stack[T])) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+	f(s.inner)
+}
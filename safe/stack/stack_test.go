@@ -0,0 +1,57 @@
+package stack
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/things-go/container"
+)
+
+func Test_Stack(t *testing.T) {
+	for _, s := range []*Stack[int]{New[int](), NewQuick[int]()} {
+		s.Push(1)
+		s.Push(2)
+		assert.Equal(t, 2, s.Len())
+		assert.False(t, s.IsEmpty())
+
+		v, ok := s.Peek()
+		assert.True(t, ok)
+		assert.Equal(t, 2, v)
+		v, ok = s.Pop()
+		assert.True(t, ok)
+		assert.Equal(t, 2, v)
+
+		s.Clear()
+		assert.True(t, s.IsEmpty())
+		_, ok = s.Pop()
+		assert.False(t, ok)
+	}
+}
+
+func Test_Stack_Concurrent(t *testing.T) {
+	s := New[int]()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				s.Push(j)
+				s.Peek()
+				s.Len()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 8000, s.Len())
+
+	// pop two elements and push their sum atomically.
+	s.Atomically(func(inner container.Stack[int]) {
+		a, _ := inner.Pop()
+		b, _ := inner.Pop()
+		inner.Push(a + b)
+	})
+	assert.Equal(t, 7999, s.Len())
+}
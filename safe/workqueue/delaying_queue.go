@@ -0,0 +1,419 @@
+package workqueue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/clock"
+	"github.com/things-go/container/go/heap"
+	"github.com/things-go/container/safe/fifo"
+)
+
+// DelayingQueue is a Queue
+var _ fifo.Queue[int] = (*DelayingQueue[int])(nil)
+
+// DelayingQueue is a fifo.FIFO which can add an item at a later time.
+// This makes it easier to requeue items after failures without ending up in a hot-loop.
+//
+// The pending items are held in a heap ordered by the time they are ready,
+// a single goroutine moves them into the FIFO when they are due.
+// A pending item is moved with AddIfNotPresent, so it never overwrites
+// a newer version of the object which was added in the meantime.
+// Delete drops the pending item of its key, and Replace the pending items
+// whose keys are not in the new list, so a deleted object does not come back.
+type DelayingQueue[T any] struct {
+	*fifo.FIFO[T]
+
+	keyFunc container.KeyFunc[T]
+	clock   clock.Clock
+
+	// moveMu is held while the due items are moved into the FIFO, and by
+	// Delete and Replace, so a due item can not slip past them. It is taken
+	// before mu and the lock of the FIFO.
+	moveMu sync.Mutex
+
+	mu   sync.Mutex
+	cond sync.Cond
+	// waitingForQueue is a priority queue of the pending items, ordered by ready time.
+	waitingForQueue waitForPriorityQueue[T]
+	// knownEntries is used to merge the pending items with the same key.
+	knownEntries map[string]*waitFor[T]
+	// moving counts the due items which are taken out of waitingForQueue,
+	// but not added to the FIFO yet.
+	moving int
+	// stopped is true when the queue is closed.
+	stopped bool
+	// draining is true once ShutDownWithDrain is called.
+	draining bool
+
+	// wakeup the waiting loop when a new item is pending.
+	wakeup chan struct{}
+	// stopCh lets us signal a shutdown to the waiting loop
+	stopCh chan struct{}
+	// done is closed when the waiting loop exited.
+	done chan struct{}
+}
+
+// NewDelayingQueue returns a queue which can add an item at a later time.
+// keyFunc is used to make the key used for queued item insertion and retrieval, and should be deterministic.
+func NewDelayingQueue[T any](keyFunc container.KeyFunc[T], opts ...Option) *DelayingQueue[T] {
+	return newDelayingQueue(keyFunc, newOptions(opts...), true)
+}
+
+// newDelayingQueue returns a DelayingQueue, countRetries tells whether the
+// FIFO counts the retries, false if a RateLimitingQueue counts them.
+func newDelayingQueue[T any](keyFunc container.KeyFunc[T], o *options, countRetries bool) *DelayingQueue[T] {
+	q := &DelayingQueue[T]{
+		FIFO:         fifo.New(keyFunc, fifoOptions[T](o, countRetries)...),
+		keyFunc:      keyFunc,
+		clock:        o.clock,
+		knownEntries: make(map[string]*waitFor[T]),
+		wakeup:       make(chan struct{}, 1),
+		stopCh:       make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	q.cond.L = &q.mu
+	go q.waitingLoop()
+	return q
+}
+
+// fifoOptions returns the options of the underlying fifo.FIFO.
+func fifoOptions[T any](o *options, countRetries bool) []fifo.Option[T] {
+	if o.metricsProvider == nil {
+		return nil
+	}
+	provider := o.metricsProvider
+	if !countRetries {
+		provider = noRetriesMetricsProvider{provider}
+	}
+	return []fifo.Option[T]{
+		fifo.WithMetrics[T](o.metricsName, provider),
+		fifo.WithClock[T](o.clock),
+	}
+}
+
+// noRetriesMetricsProvider is a MetricsProvider whose retries metric does
+// nothing, so the retries are counted in one place only.
+type noRetriesMetricsProvider struct {
+	fifo.MetricsProvider
+}
+
+// NewRetriesMetric implement fifo.MetricsProvider.
+func (noRetriesMetricsProvider) NewRetriesMetric(string) fifo.CounterMetric { return noopCounter{} }
+
+type noopCounter struct{}
+
+func (noopCounter) Inc() {}
+
+// AddAfter adds the given item to the queue after the given delay.
+// If the key of the item is already pending, the pending entry takes the
+// given object and the earliest of the two ready times.
+// An item without delay is added at once with Add, so it overwrites the
+// queued object of its key, and the pending entry of its key is dropped.
+// It returns ErrFIFOClosed once the queue is closed or ShutDownWithDrain is called.
+func (q *DelayingQueue[T]) AddAfter(obj T, duration time.Duration) error {
+	key, err := q.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+
+	q.mu.Lock()
+	if q.stopped || q.draining {
+		q.mu.Unlock()
+		return fifo.ErrFIFOClosed
+	}
+	if duration <= 0 {
+		q.removePendingLocked(key)
+		q.mu.Unlock()
+		return q.Add(obj)
+	}
+	q.addAfterLocked(key, obj, duration)
+	q.mu.Unlock()
+	q.wake()
+	return nil
+}
+
+// requeueAfter adds back an item popped by fifo.Run after the given delay,
+// and ends its flight in the FIFO, see fifo.FIFO.Requeue. While the queue is
+// draining, the item is requeued at once, so the drain does not wait for it.
+func (q *DelayingQueue[T]) requeueAfter(obj T, duration time.Duration, err error) error {
+	key, keyErr := q.keyFunc(obj)
+	if keyErr != nil {
+		return container.KeyError[T]{Obj: obj, Err: keyErr}
+	}
+
+	q.mu.Lock()
+	if q.stopped || q.draining || duration <= 0 {
+		q.mu.Unlock()
+		return q.FIFO.Requeue(obj, err)
+	}
+	q.addAfterLocked(key, obj, duration)
+	q.mu.Unlock()
+	q.wake()
+	// pending now, ShutDownWithDrain waits for it.
+	q.FIFO.Forget(obj)
+	return nil
+}
+
+// Delete removes an item from the queue, and drops the pending item of its key.
+func (q *DelayingQueue[T]) Delete(obj T) error {
+	key, err := q.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	q.moveMu.Lock()
+	defer q.moveMu.Unlock()
+	if err = q.FIFO.Delete(obj); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.removePendingLocked(key)
+	return nil
+}
+
+// Replace will delete the contents of the queue, using instead the given list,
+// see fifo.FIFO.Replace. The pending items whose keys are not in the list are
+// dropped, the others take the object of the list.
+func (q *DelayingQueue[T]) Replace(list []T, resourceVersion string) error {
+	objs := make(map[string]T, len(list))
+	for _, obj := range list {
+		key, err := q.keyFunc(obj)
+		if err != nil {
+			return container.KeyError[T]{Obj: obj, Err: err}
+		}
+		objs[key] = obj
+	}
+	q.moveMu.Lock()
+	defer q.moveMu.Unlock()
+	if err := q.FIFO.Replace(list, resourceVersion); err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for key, entry := range q.knownEntries {
+		if obj, exists := objs[key]; exists {
+			entry.obj = obj
+		} else {
+			q.removePendingLocked(key)
+		}
+	}
+	return nil
+}
+
+// removePendingLocked drops the pending item of key, if any.
+// The caller must hold the lock.
+func (q *DelayingQueue[T]) removePendingLocked(key string) {
+	entry, exists := q.knownEntries[key]
+	if !exists {
+		return
+	}
+	heap.Remove[*waitFor[T]](&q.waitingForQueue, entry.index)
+	delete(q.knownEntries, key)
+	if q.draining {
+		// wake up ShutDownWithDrain.
+		q.cond.Broadcast()
+	}
+}
+
+// addAfterLocked adds the item of key to the pending items, or merges it
+// into the pending entry of key. The caller must hold the lock.
+func (q *DelayingQueue[T]) addAfterLocked(key string, obj T, duration time.Duration) {
+	readyAt := q.clock.Now().Add(duration)
+	if entry, exists := q.knownEntries[key]; exists {
+		entry.obj = obj
+		if readyAt.Before(entry.readyAt) {
+			entry.readyAt = readyAt
+			heap.Fix[*waitFor[T]](&q.waitingForQueue, entry.index)
+		}
+	} else {
+		entry = &waitFor[T]{key: key, obj: obj, readyAt: readyAt}
+		heap.Push[*waitFor[T]](&q.waitingForQueue, entry)
+		q.knownEntries[key] = entry
+	}
+}
+
+// wake up the waiting loop for a new pending item.
+func (q *DelayingQueue[T]) wake() {
+	select {
+	case q.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Close the queue, the pending items are dropped and the waiting loop exits
+// before Close returns.
+func (q *DelayingQueue[T]) Close() {
+	q.stop()
+	q.FIFO.Close()
+}
+
+// ShutDownWithDrain stops accepting new delayed items, AddAfter returns
+// ErrFIFOClosed from now on. It blocks until the pending items are due and
+// moved into the FIFO, then drains the FIFO with fifo.FIFO.ShutDownWithDrain,
+// and stops the waiting loop as Close does. The items requeued by fifo.Run
+// while draining are requeued at once, rather than after their delay.
+// If ctx is done first, the queue is closed with the remaining items in it
+// and ctx.Err() is returned.
+func (q *DelayingQueue[T]) ShutDownWithDrain(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.cond.Broadcast()
+	})
+	defer stop()
+
+	q.mu.Lock()
+	q.draining = true
+	var err error
+	for (q.waitingForQueue.Len() > 0 || q.moving > 0) && !q.stopped {
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		q.cond.Wait()
+	}
+	q.mu.Unlock()
+
+	if drainErr := q.FIFO.ShutDownWithDrain(ctx); err == nil {
+		err = drainErr
+	}
+	q.stop()
+	return err
+}
+
+// stop the waiting loop, it returns once the loop exits.
+func (q *DelayingQueue[T]) stop() {
+	q.mu.Lock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.stopCh)
+		q.cond.Broadcast()
+	}
+	q.mu.Unlock()
+
+	<-q.done
+}
+
+// waitingLoop runs until the queue is closed and moves the pending items
+// into the FIFO when they are due.
+func (q *DelayingQueue[T]) waitingLoop() {
+	defer close(q.done)
+
+	var nextReadyAtTimer clock.Timer
+	defer func() {
+		if nextReadyAtTimer != nil {
+			nextReadyAtTimer.Stop()
+		}
+	}()
+
+	for {
+		var nextReadyAt <-chan time.Time
+		var ready []T
+
+		q.moveMu.Lock()
+		q.mu.Lock()
+		if nextReadyAtTimer != nil {
+			nextReadyAtTimer.Stop()
+			nextReadyAtTimer = nil
+		}
+		now := q.clock.Now()
+		for q.waitingForQueue.Len() > 0 {
+			entry := q.waitingForQueue[0]
+			if entry.readyAt.After(now) {
+				break
+			}
+			heap.Pop[*waitFor[T]](&q.waitingForQueue)
+			delete(q.knownEntries, entry.key)
+			ready = append(ready, entry.obj)
+		}
+		q.moving += len(ready)
+		again := false
+		if q.waitingForQueue.Len() > 0 {
+			readyAt := q.waitingForQueue[0].readyAt
+			nextReadyAtTimer = q.clock.NewTimer(readyAt.Sub(now))
+			nextReadyAt = nextReadyAtTimer.C()
+			// the clock may have moved since now was taken.
+			again = !q.clock.Now().Before(readyAt)
+		}
+		q.mu.Unlock()
+
+		for _, obj := range ready {
+			q.AddIfNotPresent(obj) // nolint: errcheck
+		}
+		q.moveMu.Unlock()
+		if len(ready) > 0 {
+			q.mu.Lock()
+			q.moving -= len(ready)
+			if q.draining {
+				// wake up ShutDownWithDrain.
+				q.cond.Broadcast()
+			}
+			q.mu.Unlock()
+		}
+		if again {
+			continue
+		}
+
+		select {
+		case <-q.stopCh:
+			return
+		case <-nextReadyAt:
+		case <-q.wakeup:
+		}
+	}
+}
+
+// waitFor holds the data to add and the time it should be added
+type waitFor[T any] struct {
+	key     string
+	obj     T
+	readyAt time.Time
+	// index in the priority queue (heap)
+	index int
+}
+
+// waitForPriorityQueue implements a priority queue for waitFor items.
+//
+// waitForPriorityQueue implements heap.Interface. The item occurring next in
+// time (i.e., the item with the smallest readyAt) is at the root (index 0).
+// Peek returns this minimum item at index 0. Pop returns the minimum item after
+// it has been removed from the queue and placed at index Len()-1 by
+// heap.Pop().
+type waitForPriorityQueue[T any] []*waitFor[T]
+
+// Len implement heap.Interface.
+func (pq waitForPriorityQueue[T]) Len() int {
+	return len(pq)
+}
+
+// Less implement heap.Interface.
+func (pq waitForPriorityQueue[T]) Less(i, j int) bool {
+	return pq[i].readyAt.Before(pq[j].readyAt)
+}
+
+// Swap implement heap.Interface.
+func (pq waitForPriorityQueue[T]) Swap(i, j int) {
+	pq[i], pq[j] = pq[j], pq[i]
+	pq[i].index = i
+	pq[j].index = j
+}
+
+// Push adds an item to the queue. Push should not be called directly; instead,
+// use `heap.Push`.
+func (pq *waitForPriorityQueue[T]) Push(x *waitFor[T]) {
+	x.index = len(*pq)
+	*pq = append(*pq, x)
+}
+
+// Pop removes an item from the queue. Pop should not be called directly;
+// instead, use `heap.Pop`.
+func (pq *waitForPriorityQueue[T]) Pop() *waitFor[T] {
+	n := len(*pq)
+	item := (*pq)[n-1]
+	(*pq)[n-1] = nil // avoid memory leak
+	item.index = -1
+	*pq = (*pq)[0:(n - 1)]
+	return item
+}
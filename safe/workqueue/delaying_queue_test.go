@@ -0,0 +1,230 @@
+package workqueue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/container/clock"
+	"github.com/things-go/container/safe/fifo"
+)
+
+func waitForAdded[T any](t *testing.T, q *DelayingQueue[T], depth int) {
+	t.Helper()
+	require.Eventually(t, func() bool { return len(q.ListKeys()) == depth }, time.Second, time.Millisecond)
+}
+
+func Test_DelayingQueue_simple(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewDelayingQueue(testObjectKeyFunc, WithClock(fakeClock))
+	defer q.Close()
+
+	require.NoError(t, q.AddAfter(testObject{"foo", 1}, 50*time.Millisecond))
+	require.Never(t, func() bool { return len(q.ListKeys()) != 0 }, 20*time.Millisecond, time.Millisecond)
+
+	fakeClock.Step(60 * time.Millisecond)
+	waitForAdded(t, q, 1)
+	require.Equal(t, testObject{"foo", 1}, fifo.Pop[testObject](q))
+
+	fakeClock.Step(10 * time.Second)
+	require.Never(t, func() bool { return len(q.ListKeys()) != 0 }, 20*time.Millisecond, time.Millisecond)
+}
+
+func Test_DelayingQueue_deduping(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewDelayingQueue(testObjectKeyFunc, WithClock(fakeClock))
+	defer q.Close()
+
+	require.NoError(t, q.AddAfter(testObject{"foo", 1}, 50*time.Millisecond))
+	require.NoError(t, q.AddAfter(testObject{"foo", 2}, 70*time.Millisecond))
+	q.mu.Lock()
+	require.Equal(t, 1, q.waitingForQueue.Len())
+	q.mu.Unlock()
+
+	// step past the first block, we should receive now
+	fakeClock.Step(60 * time.Millisecond)
+	waitForAdded(t, q, 1)
+	// the pending entry takes the newest object.
+	require.Equal(t, testObject{"foo", 2}, fifo.Pop[testObject](q))
+
+	// step past the second add
+	fakeClock.Step(20 * time.Millisecond)
+	require.Never(t, func() bool { return len(q.ListKeys()) != 0 }, 20*time.Millisecond, time.Millisecond)
+
+	// test again, but this time the earlier should override
+	require.NoError(t, q.AddAfter(testObject{"foo", 3}, 50*time.Millisecond))
+	require.NoError(t, q.AddAfter(testObject{"foo", 4}, 20*time.Millisecond))
+
+	fakeClock.Step(30 * time.Millisecond)
+	waitForAdded(t, q, 1)
+	require.Equal(t, testObject{"foo", 4}, fifo.Pop[testObject](q))
+
+	// step past the second add
+	fakeClock.Step(90 * time.Millisecond)
+	require.Never(t, func() bool { return len(q.ListKeys()) != 0 }, 20*time.Millisecond, time.Millisecond)
+}
+
+func Test_DelayingQueue_addTwoFireEarly(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewDelayingQueue(testObjectKeyFunc, WithClock(fakeClock))
+	defer q.Close()
+
+	first := testObject{"foo", 1}
+	second := testObject{"bar", 2}
+	third := testObject{"baz", 3}
+
+	require.NoError(t, q.AddAfter(first, 1*time.Second))
+	require.NoError(t, q.AddAfter(second, 50*time.Millisecond))
+
+	fakeClock.Step(60 * time.Millisecond)
+	waitForAdded(t, q, 1)
+	require.Equal(t, second, fifo.Pop[testObject](q))
+
+	require.NoError(t, q.AddAfter(third, 2*time.Second))
+
+	fakeClock.Step(1 * time.Second)
+	waitForAdded(t, q, 1)
+	require.Equal(t, first, fifo.Pop[testObject](q))
+
+	fakeClock.Step(2 * time.Second)
+	waitForAdded(t, q, 1)
+	require.Equal(t, third, fifo.Pop[testObject](q))
+}
+
+func Test_DelayingQueue_copyShifting(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewDelayingQueue(testObjectKeyFunc, WithClock(fakeClock))
+	defer q.Close()
+
+	first := testObject{"foo", 1}
+	second := testObject{"bar", 2}
+	third := testObject{"baz", 3}
+
+	require.NoError(t, q.AddAfter(first, 1*time.Second))
+	require.NoError(t, q.AddAfter(second, 500*time.Millisecond))
+	require.NoError(t, q.AddAfter(third, 250*time.Millisecond))
+
+	fakeClock.Step(2 * time.Second)
+	waitForAdded(t, q, 3)
+	require.Equal(t, third, fifo.Pop[testObject](q))
+	require.Equal(t, second, fifo.Pop[testObject](q))
+	require.Equal(t, first, fifo.Pop[testObject](q))
+}
+
+func Test_DelayingQueue_addWithoutDelay(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewDelayingQueue(testObjectKeyFunc, WithClock(fakeClock))
+	defer q.Close()
+
+	// the newest object without delay is queued, and the pending one is dropped.
+	require.NoError(t, q.AddAfter(testObject{"foo", 1}, time.Second))
+	require.NoError(t, q.AddAfter(testObject{"foo", 2}, 0))
+	require.NoError(t, q.AddAfter(testObject{"foo", 3}, 0))
+	obj, exists, err := q.GetByKey("foo")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, 3, obj.val)
+	q.mu.Lock()
+	require.Equal(t, 0, q.waitingForQueue.Len())
+	q.mu.Unlock()
+
+	fakeClock.Step(time.Second)
+	require.Equal(t, testObject{"foo", 3}, fifo.Pop[testObject](q))
+	require.Never(t, func() bool { return len(q.ListKeys()) != 0 }, 20*time.Millisecond, time.Millisecond)
+}
+
+func Test_DelayingQueue_Delete(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewDelayingQueue(testObjectKeyFunc, WithClock(fakeClock))
+	defer q.Close()
+
+	require.NoError(t, q.AddAfter(testObject{"foo", 1}, 50*time.Millisecond))
+	require.NoError(t, q.AddAfter(testObject{"bar", 1}, 50*time.Millisecond))
+	// the deleted object does not come back once its delay is up.
+	require.NoError(t, q.Delete(testObject{"foo", 0}))
+	fakeClock.Step(60 * time.Millisecond)
+	waitForAdded(t, q, 1)
+	require.Never(t, func() bool { return len(q.ListKeys()) != 1 }, 20*time.Millisecond, time.Millisecond)
+	require.Equal(t, []string{"bar"}, q.ListKeys())
+}
+
+func Test_DelayingQueue_Replace(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewDelayingQueue(testObjectKeyFunc, WithClock(fakeClock))
+	defer q.Close()
+
+	require.NoError(t, q.AddAfter(testObject{"foo", 1}, 50*time.Millisecond))
+	require.NoError(t, q.AddAfter(testObject{"bar", 1}, 50*time.Millisecond))
+	// the pending foo is dropped, the pending bar takes the replaced object.
+	require.NoError(t, q.Replace([]testObject{{"bar", 2}}, "1"))
+	require.Equal(t, testObject{"bar", 2}, fifo.Pop[testObject](q))
+	q.mu.Lock()
+	require.Equal(t, 1, q.waitingForQueue.Len())
+	q.mu.Unlock()
+
+	fakeClock.Step(60 * time.Millisecond)
+	waitForAdded(t, q, 1)
+	require.Never(t, func() bool { return len(q.ListKeys()) != 1 }, 20*time.Millisecond, time.Millisecond)
+	require.Equal(t, testObject{"bar", 2}, fifo.Pop[testObject](q))
+}
+
+func Test_DelayingQueue_Close(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewDelayingQueue(testObjectKeyFunc, WithClock(fakeClock))
+
+	require.NoError(t, q.AddAfter(testObject{"foo", 1}, time.Second))
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+
+	q.Close()
+	q.Close()
+	// waiting loop exited, timer stopped.
+	require.False(t, fakeClock.HasWaiters())
+	require.ErrorIs(t, q.AddAfter(testObject{"foo", 1}, time.Second), fifo.ErrFIFOClosed)
+	_, err := q.Pop(nil)
+	require.ErrorIs(t, err, fifo.ErrFIFOClosed)
+}
+
+func Test_DelayingQueue_ShutDownWithDrain(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewDelayingQueue(testObjectKeyFunc, WithClock(fakeClock))
+
+	require.NoError(t, q.AddAfter(testObject{"foo", 1}, time.Second))
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() { done <- q.ShutDownWithDrain(context.Background()) }()
+	require.Eventually(t, func() bool {
+		return errors.Is(q.AddAfter(testObject{"bar", 2}, time.Second), fifo.ErrFIFOClosed)
+	}, time.Second, time.Millisecond)
+	// waits for the pending item.
+	require.Never(t, func() bool { return len(done) > 0 }, 20*time.Millisecond, time.Millisecond)
+
+	fakeClock.Step(time.Second)
+	waitForAdded(t, q, 1)
+	require.Equal(t, testObject{"foo", 1}, fifo.Pop[testObject](q))
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("ShutDownWithDrain did not return after the queue is drained")
+	}
+	// waiting loop exited, timer stopped.
+	require.False(t, fakeClock.HasWaiters())
+	require.True(t, q.IsClosed())
+}
+
+func Test_DelayingQueue_ShutDownWithDrainTimeout(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewDelayingQueue(testObjectKeyFunc, WithClock(fakeClock))
+
+	require.NoError(t, q.AddAfter(testObject{"foo", 1}, time.Second))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, q.ShutDownWithDrain(ctx), context.DeadlineExceeded)
+	require.False(t, fakeClock.HasWaiters())
+	require.True(t, q.IsClosed())
+}
@@ -0,0 +1,166 @@
+package workqueue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/things-go/container/clock"
+	"github.com/things-go/container/safe/fifo"
+)
+
+// unfinishedWorkUpdatePeriod is how often the unfinished work and the
+// longest running processor metrics of a Queue are updated.
+const unfinishedWorkUpdatePeriod = 500 * time.Millisecond
+
+// queueMetrics records the metrics of a Queue by key, a nil *queueMetrics
+// records nothing. The Queue hands a key to one worker at a time, so
+// a key has at most one processing start time.
+//
+// The unfinished work is updated by a goroutine which only runs while an
+// item is being processed, like the one of the fifo queues.
+type queueMetrics struct {
+	clock clock.Clock
+
+	depth                   fifo.GaugeMetric
+	adds                    fifo.CounterMetric
+	latency                 fifo.HistogramMetric
+	workDuration            fifo.HistogramMetric
+	unfinishedWorkSeconds   fifo.GaugeMetric
+	longestRunningProcessor fifo.GaugeMetric
+
+	mu sync.Mutex
+	// addTimes is the time the key was marked dirty.
+	addTimes map[string]time.Time
+	// processingStartTimes is the time the key was handed over by Get.
+	processingStartTimes map[string]time.Time
+	// updating is true while the unfinished work loop runs.
+	updating bool
+	// stopped is true once the queue is shut down, the loop is not started any more.
+	stopped bool
+	stopCh  chan struct{}
+}
+
+// newQueueMetrics returns nil if no MetricsProvider is set.
+func newQueueMetrics(o *options) *queueMetrics {
+	if o.metricsProvider == nil {
+		return nil
+	}
+	p := o.metricsProvider
+	return &queueMetrics{
+		clock:                   o.clock,
+		depth:                   p.NewDepthMetric(o.metricsName),
+		adds:                    p.NewAddsMetric(o.metricsName),
+		latency:                 p.NewLatencyMetric(o.metricsName),
+		workDuration:            p.NewWorkDurationMetric(o.metricsName),
+		unfinishedWorkSeconds:   p.NewUnfinishedWorkSecondsMetric(o.metricsName),
+		longestRunningProcessor: p.NewLongestRunningProcessorSecondsMetric(o.metricsName),
+		addTimes:                map[string]time.Time{},
+		processingStartTimes:    map[string]time.Time{},
+		stopCh:                  make(chan struct{}),
+	}
+}
+
+// add records that key was marked dirty.
+func (m *queueMetrics) add(key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.adds.Inc()
+	if _, exists := m.addTimes[key]; !exists {
+		m.addTimes[key] = m.clock.Now()
+	}
+}
+
+// get records that key was handed over by Get.
+func (m *queueMetrics) get(key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	if startTime, exists := m.addTimes[key]; exists {
+		m.latency.Observe(now.Sub(startTime).Seconds())
+		delete(m.addTimes, key)
+	}
+	m.processingStartTimes[key] = now
+	if !m.updating && !m.stopped {
+		m.updating = true
+		go m.updateUnfinishedWorkLoop()
+	}
+}
+
+// done records that key finished being processed.
+func (m *queueMetrics) done(key string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if startTime, exists := m.processingStartTimes[key]; exists {
+		m.workDuration.Observe(m.clock.Since(startTime).Seconds())
+		delete(m.processingStartTimes, key)
+	}
+}
+
+// setDepth records the number of the keys waiting in the queue.
+func (m *queueMetrics) setDepth(depth int) {
+	if m == nil {
+		return
+	}
+	m.depth.Set(float64(depth))
+}
+
+// stop the unfinished work loop, it is safe to call multiple times.
+func (m *queueMetrics) stop() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.stopped {
+		m.stopped = true
+		close(m.stopCh)
+	}
+}
+
+// updateUnfinishedWorkLoop updates the unfinished work periodically, until
+// no item is being processed or the queue is shut down.
+func (m *queueMetrics) updateUnfinishedWorkLoop() {
+	t := m.clock.NewTicker(unfinishedWorkUpdatePeriod)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C():
+			if !m.updateUnfinishedWork() {
+				return
+			}
+		case <-m.stopCh:
+			return
+		}
+	}
+}
+
+// updateUnfinishedWork updates the unfinished work, it returns false and
+// ends the loop if no item is being processed.
+func (m *queueMetrics) updateUnfinishedWork() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var total float64
+	var oldest float64
+	now := m.clock.Now()
+	for _, t := range m.processingStartTimes {
+		age := now.Sub(t).Seconds()
+		total += age
+		oldest = max(oldest, age)
+	}
+	m.unfinishedWorkSeconds.Set(total)
+	m.longestRunningProcessor.Set(oldest)
+	if len(m.processingStartTimes) == 0 {
+		m.updating = false
+		return false
+	}
+	return true
+}
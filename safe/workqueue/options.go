@@ -0,0 +1,45 @@
+package workqueue
+
+import (
+	"github.com/things-go/container/clock"
+	"github.com/things-go/container/safe/fifo"
+)
+
+// options of the queues and rate limiters.
+type options struct {
+	clock clock.Clock
+	// metricsName is the name of the queue the metrics belong to.
+	metricsName string
+	// metricsProvider generates the metrics of the queue, nil means no metrics.
+	metricsProvider fifo.MetricsProvider
+}
+
+// Option for the queues and rate limiters.
+type Option func(*options)
+
+// WithClock with a custom clock, default clock.RealClock.
+// It is mostly used to inject a fake clock in tests.
+func WithClock(c clock.Clock) Option {
+	return func(o *options) {
+		o.clock = c
+	}
+}
+
+// WithMetrics set the MetricsProvider which generates the metrics of the queue,
+// name is passed to the provider to tell the queues apart.
+func WithMetrics(name string, provider fifo.MetricsProvider) Option {
+	return func(o *options) {
+		o.metricsName = name
+		o.metricsProvider = provider
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		clock: clock.RealClock{},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
@@ -0,0 +1,171 @@
+package workqueue
+
+import (
+	"sync"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/go/list"
+	"github.com/things-go/container/safe/fifo"
+)
+
+// Queue is a work queue with Get/Done semantics, which hands a key to
+// only one worker at a time.
+//
+// Unlike fifo.FIFO, the item is processed outside the lock of the queue:
+// Get hands the item over and marks its key as processing, Done releases it.
+// A key added again while it is processing is marked dirty and deferred
+// until Done, so no two workers ever handle the same key concurrently.
+//
+// Queue solves this use case:
+//   - You want to process items with multiple workers concurrently.
+//   - You want to process the most recent version of the object when you process it.
+//   - You want each key to be processed by a single worker at a time.
+//   - You want an item added during its processing to be processed again afterwards.
+//
+// With WithMetrics, the depth, adds, latency, work duration and unfinished
+// work of the queue are recorded. The Queue never requeues an item by itself,
+// so it records no retries.
+type Queue[T any] struct {
+	mu   sync.Mutex
+	cond sync.Cond
+
+	// queue defines the order in which we will work on items. Every
+	// element of queue should be in the dirty set and not in the
+	// processing set. It is a list, so a handed over key does not linger
+	// in a backing array.
+	queue *list.List[string]
+
+	// dirty defines all of the items that need to be processed,
+	// it maps a key to the most recent version of the object.
+	dirty map[string]T
+
+	// Things that are currently being processed are in the processing set.
+	// These things may be simultaneously in the dirty set. When we finish
+	// processing something and remove it from this set, we'll check if
+	// it's in the dirty set, and if so, add it to the queue.
+	processing map[string]struct{}
+
+	// keyFunc is used to make the key used for queued item insertion and retrieval, and
+	// should be deterministic.
+	keyFunc container.KeyFunc[T]
+
+	// metrics of the queue, nil if no MetricsProvider is set.
+	metrics *queueMetrics
+
+	shuttingDown bool
+}
+
+// New returns a work queue with Get/Done semantics.
+// keyFunc is used to make the key used for queued item insertion and retrieval, and should be deterministic.
+func New[T any](keyFunc container.KeyFunc[T], opts ...Option) *Queue[T] {
+	q := &Queue[T]{
+		queue:      list.New[string](),
+		dirty:      map[string]T{},
+		processing: map[string]struct{}{},
+		keyFunc:    keyFunc,
+		metrics:    newQueueMetrics(newOptions(opts...)),
+	}
+	q.cond.L = &q.mu
+	return q
+}
+
+// Add marks item as needing processing. The most recent version of the
+// object is the one handed over by Get. It returns fifo.ErrFIFOClosed
+// if the queue is shutting down.
+func (q *Queue[T]) Add(obj T) error {
+	key, err := q.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.shuttingDown {
+		return fifo.ErrFIFOClosed
+	}
+	_, isDirty := q.dirty[key]
+	q.dirty[key] = obj
+	if isDirty {
+		return nil
+	}
+	q.metrics.add(key)
+	if _, isProcessing := q.processing[key]; isProcessing {
+		// deferred until Done
+		return nil
+	}
+	q.queue.PushBack(key)
+	q.metrics.setDepth(q.queue.Len())
+	q.cond.Signal()
+	return nil
+}
+
+// Len returns the current queue length, for informational purposes only. You
+// shouldn't e.g. gate a call to Add() or Get() on Len() being a particular
+// value, that can't be synchronized properly.
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.queue.Len()
+}
+
+// Get blocks until it can return an item to be processed. If shutdown = true,
+// the caller should end their goroutine. You must call Done with item when you
+// have finished processing it.
+func (q *Queue[T]) Get() (item T, shutdown bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.queue.Len() == 0 && !q.shuttingDown {
+		q.cond.Wait()
+	}
+	if q.queue.Len() == 0 {
+		// We must be shutting down.
+		return item, true
+	}
+
+	key := q.queue.Remove(q.queue.Front())
+
+	item = q.dirty[key]
+	q.processing[key] = struct{}{}
+	delete(q.dirty, key)
+	q.metrics.get(key)
+	q.metrics.setDepth(q.queue.Len())
+	return item, false
+}
+
+// Done marks item as done processing, and if it has been marked as dirty again
+// while it was being processed, it will be re-added to the queue for
+// re-processing. An object whose key can not be made is ignored.
+func (q *Queue[T]) Done(obj T) {
+	key, err := q.keyFunc(obj)
+	if err != nil {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, isProcessing := q.processing[key]; !isProcessing {
+		return
+	}
+	delete(q.processing, key)
+	q.metrics.done(key)
+	if _, isDirty := q.dirty[key]; isDirty {
+		q.queue.PushBack(key)
+		q.metrics.setDepth(q.queue.Len())
+		q.cond.Signal()
+	}
+}
+
+// ShutDown will cause q to ignore all new items added to it and
+// immediately instruct the worker goroutines to exit once the queue is empty.
+func (q *Queue[T]) ShutDown() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.shuttingDown = true
+	q.metrics.stop()
+	q.cond.Broadcast()
+}
+
+// ShuttingDown returns true if the queue is shutting down.
+func (q *Queue[T]) ShuttingDown() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.shuttingDown
+}
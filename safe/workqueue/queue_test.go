@@ -0,0 +1,173 @@
+package workqueue
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/container/clock"
+	"github.com/things-go/container/safe/fifo"
+)
+
+func Test_Queue_basic(t *testing.T) {
+	q := New(testObjectKeyFunc)
+
+	producers := sync.WaitGroup{}
+	const producerCount = 50
+	for i := 0; i < producerCount; i++ {
+		producers.Add(1)
+		go func(i int) {
+			defer producers.Done()
+			for j := 0; j < 50; j++ {
+				q.Add(testObject{name: strconv.Itoa(i), val: j}) // nolint: errcheck
+				time.Sleep(time.Millisecond)
+			}
+		}(i)
+	}
+
+	var processing sync.Map
+	var overlapped atomic.Bool
+	consumers := sync.WaitGroup{}
+	const consumerCount = 10
+	for i := 0; i < consumerCount; i++ {
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			for {
+				item, quit := q.Get()
+				if quit {
+					return
+				}
+				// no two workers handle the same key concurrently.
+				if _, loaded := processing.LoadOrStore(item.name, struct{}{}); loaded {
+					overlapped.Store(true)
+				}
+				time.Sleep(3 * time.Millisecond)
+				processing.Delete(item.name)
+				q.Done(item)
+			}
+		}()
+	}
+
+	producers.Wait()
+	q.ShutDown()
+	require.ErrorIs(t, q.Add(testObject{name: "foo"}), fifo.ErrFIFOClosed)
+	consumers.Wait()
+	require.False(t, overlapped.Load())
+	require.Zero(t, q.Len())
+}
+
+func Test_Queue_addWhileProcessing(t *testing.T) {
+	q := New(testObjectKeyFunc)
+
+	require.NoError(t, q.Add(testObject{"foo", 1}))
+	require.NoError(t, q.Add(testObject{"foo", 2}))
+	require.Equal(t, 1, q.Len())
+
+	item, shutdown := q.Get()
+	require.False(t, shutdown)
+	require.Equal(t, testObject{"foo", 2}, item)
+
+	// re-added while processing, deferred until Done.
+	require.NoError(t, q.Add(testObject{"foo", 3}))
+	require.NoError(t, q.Add(testObject{"foo", 4}))
+	require.Zero(t, q.Len())
+
+	q.Done(item)
+	require.Equal(t, 1, q.Len())
+
+	item, shutdown = q.Get()
+	require.False(t, shutdown)
+	require.Equal(t, testObject{"foo", 4}, item)
+	q.Done(item)
+	require.Zero(t, q.Len())
+}
+
+func Test_Queue_len(t *testing.T) {
+	q := New(testObjectKeyFunc)
+	require.NoError(t, q.Add(testObject{"foo", 1}))
+	require.Equal(t, 1, q.Len())
+	require.NoError(t, q.Add(testObject{"bar", 1}))
+	require.Equal(t, 2, q.Len())
+	require.NoError(t, q.Add(testObject{"foo", 2})) // should not increase the queue length.
+	require.Equal(t, 2, q.Len())
+}
+
+func Test_Queue_reinsert(t *testing.T) {
+	q := New(testObjectKeyFunc)
+	require.NoError(t, q.Add(testObject{"foo", 1}))
+
+	// Start processing
+	item, _ := q.Get()
+	require.Equal(t, "foo", item.name)
+
+	// Add it back while processing
+	require.NoError(t, q.Add(item))
+
+	// Finish it up
+	q.Done(item)
+
+	// It should be back on the queue
+	item, _ = q.Get()
+	require.Equal(t, "foo", item.name)
+
+	// Finish that one up
+	q.Done(item)
+	require.Zero(t, q.Len())
+}
+
+func Test_Queue_ShutDown(t *testing.T) {
+	q := New(testObjectKeyFunc)
+	require.NoError(t, q.Add(testObject{"foo", 1}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// drain the remaining items then quit.
+		item, shutdown := q.Get()
+		assert.False(t, shutdown)
+		q.Done(item)
+		_, shutdown = q.Get()
+		assert.True(t, shutdown)
+	}()
+
+	q.ShutDown()
+	require.True(t, q.ShuttingDown())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for Get to return after ShutDown")
+	}
+}
+
+func Test_Queue_metrics(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	mp := &testMetricsProvider{}
+	q := New(testObjectKeyFunc, WithClock(fakeClock), WithMetrics("test", mp))
+	defer q.ShutDown()
+
+	require.NoError(t, q.Add(testObject{"foo", 1}))
+	require.NoError(t, q.Add(testObject{"foo", 2}))
+	require.EqualValues(t, 1, mp.adds.n.Load())
+	require.EqualValues(t, 1, mp.depth.v.Load())
+
+	item, _ := q.Get()
+	require.EqualValues(t, 1, mp.latency.n.Load())
+	require.EqualValues(t, 0, mp.depth.v.Load())
+
+	// the unfinished work is updated while the item is being processed.
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+	fakeClock.Step(2 * unfinishedWorkUpdatePeriod)
+	require.Eventually(t, func() bool { return mp.unfinished.v.Load() == 1 }, time.Second, time.Millisecond)
+
+	q.Done(item)
+	require.EqualValues(t, 1, mp.workDuration.n.Load())
+	// a second Done of the same item records nothing.
+	q.Done(item)
+	require.EqualValues(t, 1, mp.workDuration.n.Load())
+}
@@ -0,0 +1,190 @@
+package workqueue
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/things-go/container/clock"
+)
+
+// RateLimiter decides how long an item should wait before it is retried.
+// Items are identified by their key, which is made by the queue's KeyFunc.
+type RateLimiter interface {
+	// When gets an item and gets to decide how long that item should wait
+	When(key string) time.Duration
+	// Forget indicates that an item is finished being retried. Doesn't matter whether it's for failing
+	// or for success, we'll stop tracking it
+	Forget(key string)
+	// NumRequeues returns back how many failures the item has had
+	NumRequeues(key string) int
+}
+
+// DefaultControllerRateLimiter is a no-arg constructor for a default rate limiter for a workqueue.
+// It has both overall and per-item rate limiting. The overall is a token bucket and the per-item is exponential
+func DefaultControllerRateLimiter() RateLimiter {
+	return NewMaxOfRateLimiter(
+		NewItemExponentialFailureRateLimiter(5*time.Millisecond, 1000*time.Second),
+		// 10 qps, 100 bucket size.  This is only for retry speed and its only the overall factor (not per item)
+		NewBucketRateLimiter(10, 100),
+	)
+}
+
+// ItemExponentialFailureRateLimiter is a RateLimiter
+var _ RateLimiter = (*ItemExponentialFailureRateLimiter)(nil)
+
+// ItemExponentialFailureRateLimiter does a simple baseDelay*2^<num-failures> limit
+// dealing with max failures and expiration are up to the caller
+type ItemExponentialFailureRateLimiter struct {
+	mu       sync.Mutex
+	failures map[string]int
+
+	baseDelay time.Duration
+	maxDelay  time.Duration
+}
+
+// NewItemExponentialFailureRateLimiter new a per-item exponential backoff rate limiter.
+func NewItemExponentialFailureRateLimiter(baseDelay time.Duration, maxDelay time.Duration) *ItemExponentialFailureRateLimiter {
+	return &ItemExponentialFailureRateLimiter{
+		failures:  map[string]int{},
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+	}
+}
+
+// When returns baseDelay*2^<num-failures> and records a failure of the item.
+func (r *ItemExponentialFailureRateLimiter) When(key string) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	exp := r.failures[key]
+	r.failures[key]++
+
+	// The backoff is capped such that 'calculated' value never overflows.
+	backoff := float64(r.baseDelay.Nanoseconds()) * math.Pow(2, float64(exp))
+	if backoff > math.MaxInt64 {
+		return r.maxDelay
+	}
+
+	calculated := time.Duration(backoff)
+	if calculated > r.maxDelay {
+		return r.maxDelay
+	}
+	return calculated
+}
+
+// NumRequeues returns back how many failures the item has had
+func (r *ItemExponentialFailureRateLimiter) NumRequeues(key string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failures[key]
+}
+
+// Forget stops tracking the item.
+func (r *ItemExponentialFailureRateLimiter) Forget(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.failures, key)
+}
+
+// BucketRateLimiter is a RateLimiter
+var _ RateLimiter = (*BucketRateLimiter)(nil)
+
+// BucketRateLimiter adapts a standard token bucket to the RateLimiter API.
+// The bucket holds at most burst tokens and refills at qps tokens per second,
+// every When takes a token, waiting for it if the bucket is empty.
+type BucketRateLimiter struct {
+	mu     sync.Mutex
+	clock  clock.Clock
+	qps    float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucketRateLimiter new an overall token bucket rate limiter,
+// which allows qps events per second with a maximum burst size of burst.
+// A qps of zero or less means no limit, When always returns 0.
+func NewBucketRateLimiter(qps float64, burst int, opts ...Option) *BucketRateLimiter {
+	o := newOptions(opts...)
+	return &BucketRateLimiter{
+		clock:  o.clock,
+		qps:    qps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   o.clock.Now(),
+	}
+}
+
+// When reserves a token and returns how long to wait until it is available.
+func (r *BucketRateLimiter) When(string) time.Duration {
+	if r.qps <= 0 {
+		// no limit, see NewBucketRateLimiter.
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	if elapsed := now.Sub(r.last); elapsed > 0 {
+		r.tokens = math.Min(r.burst, r.tokens+elapsed.Seconds()*r.qps)
+		r.last = now
+	}
+	r.tokens--
+	if r.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-r.tokens / r.qps * float64(time.Second))
+}
+
+// NumRequeues always returns 0, the bucket does not track items.
+func (r *BucketRateLimiter) NumRequeues(string) int { return 0 }
+
+// Forget is a no-op, the bucket does not track items.
+func (r *BucketRateLimiter) Forget(string) {}
+
+// MaxOfRateLimiter is a RateLimiter
+var _ RateLimiter = (*MaxOfRateLimiter)(nil)
+
+// MaxOfRateLimiter calls every RateLimiter and returns the worst case response
+// When used with a token bucket limiter, the burst could be apparently exceeded in cases where particular items
+// were separately delayed a longer time.
+type MaxOfRateLimiter struct {
+	limiters []RateLimiter
+}
+
+// NewMaxOfRateLimiter new a rate limiter which returns the worst case response of limiters.
+func NewMaxOfRateLimiter(limiters ...RateLimiter) *MaxOfRateLimiter {
+	return &MaxOfRateLimiter{limiters: limiters}
+}
+
+// When returns the longest delay of all the limiters.
+func (r *MaxOfRateLimiter) When(key string) time.Duration {
+	ret := time.Duration(0)
+	for _, limiter := range r.limiters {
+		curr := limiter.When(key)
+		if curr > ret {
+			ret = curr
+		}
+	}
+	return ret
+}
+
+// NumRequeues returns the most failures of all the limiters.
+func (r *MaxOfRateLimiter) NumRequeues(key string) int {
+	ret := 0
+	for _, limiter := range r.limiters {
+		curr := limiter.NumRequeues(key)
+		if curr > ret {
+			ret = curr
+		}
+	}
+	return ret
+}
+
+// Forget forgets the item in all the limiters.
+func (r *MaxOfRateLimiter) Forget(key string) {
+	for _, limiter := range r.limiters {
+		limiter.Forget(key)
+	}
+}
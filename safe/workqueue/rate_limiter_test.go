@@ -0,0 +1,108 @@
+package workqueue
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/container/clock"
+)
+
+func Test_ItemExponentialFailureRateLimiter(t *testing.T) {
+	limiter := NewItemExponentialFailureRateLimiter(1*time.Millisecond, 1*time.Second)
+
+	require.Equal(t, 1*time.Millisecond, limiter.When("one"))
+	require.Equal(t, 2*time.Millisecond, limiter.When("one"))
+	require.Equal(t, 4*time.Millisecond, limiter.When("one"))
+	require.Equal(t, 8*time.Millisecond, limiter.When("one"))
+	require.Equal(t, 16*time.Millisecond, limiter.When("one"))
+	require.Equal(t, 5, limiter.NumRequeues("one"))
+
+	require.Equal(t, 1*time.Millisecond, limiter.When("two"))
+	require.Equal(t, 2*time.Millisecond, limiter.When("two"))
+	require.Equal(t, 2, limiter.NumRequeues("two"))
+
+	limiter.Forget("one")
+	require.Equal(t, 0, limiter.NumRequeues("one"))
+	require.Equal(t, 1*time.Millisecond, limiter.When("one"))
+}
+
+func Test_ItemExponentialFailureRateLimiter_overflow(t *testing.T) {
+	limiter := NewItemExponentialFailureRateLimiter(1*time.Millisecond, 1000*time.Second)
+	for i := 0; i < 5; i++ {
+		limiter.When("one")
+	}
+	require.Equal(t, 32*time.Millisecond, limiter.When("one"))
+
+	for i := 0; i < 1000; i++ {
+		limiter.When("overflow1")
+	}
+	require.Equal(t, 1000*time.Second, limiter.When("overflow1"))
+
+	limiter = NewItemExponentialFailureRateLimiter(1*time.Minute, 1000*time.Hour)
+	for i := 0; i < 2; i++ {
+		limiter.When("two")
+	}
+	require.Equal(t, 4*time.Minute, limiter.When("two"))
+
+	for i := 0; i < 1000; i++ {
+		limiter.When("overflow2")
+	}
+	require.Equal(t, 1000*time.Hour, limiter.When("overflow2"))
+}
+
+func Test_BucketRateLimiter(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	limiter := NewBucketRateLimiter(10, 2, WithClock(fakeClock))
+
+	// burst
+	require.Equal(t, time.Duration(0), limiter.When("one"))
+	require.Equal(t, time.Duration(0), limiter.When("two"))
+	// 10 qps, every token takes 100ms.
+	require.Equal(t, 100*time.Millisecond, limiter.When("three"))
+	require.Equal(t, 200*time.Millisecond, limiter.When("four"))
+
+	fakeClock.Step(200 * time.Millisecond)
+	require.Equal(t, 100*time.Millisecond, limiter.When("five"))
+
+	// refill no more than burst.
+	fakeClock.Step(10 * time.Second)
+	require.Equal(t, time.Duration(0), limiter.When("six"))
+	require.Equal(t, time.Duration(0), limiter.When("seven"))
+	require.Equal(t, 100*time.Millisecond, limiter.When("eight"))
+
+	require.Equal(t, 0, limiter.NumRequeues("one"))
+	limiter.Forget("one")
+}
+
+func Test_BucketRateLimiter_noLimit(t *testing.T) {
+	// a qps of zero or less means no limit, even past the burst.
+	limiter := NewBucketRateLimiter(0, 1)
+	for i := 0; i < 3; i++ {
+		require.Equal(t, time.Duration(0), limiter.When("one"))
+	}
+}
+
+func Test_MaxOfRateLimiter(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	limiter := NewMaxOfRateLimiter(
+		NewItemExponentialFailureRateLimiter(1*time.Millisecond, 1*time.Second),
+		NewBucketRateLimiter(10, 2, WithClock(fakeClock)),
+	)
+
+	require.Equal(t, 1*time.Millisecond, limiter.When("one"))
+	require.Equal(t, 2*time.Millisecond, limiter.When("one"))
+	require.Equal(t, 100*time.Millisecond, limiter.When("one"))
+	require.Equal(t, 3, limiter.NumRequeues("one"))
+
+	limiter.Forget("one")
+	require.Equal(t, 0, limiter.NumRequeues("one"))
+}
+
+func Test_DefaultControllerRateLimiter(t *testing.T) {
+	limiter := DefaultControllerRateLimiter()
+	require.Equal(t, 5*time.Millisecond, limiter.When("one"))
+	require.Equal(t, 10*time.Millisecond, limiter.When("one"))
+	require.Equal(t, 2, limiter.NumRequeues("one"))
+}
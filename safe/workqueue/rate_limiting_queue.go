@@ -0,0 +1,143 @@
+// Package workqueue provides thread-safe work queues, which hand a key to
+// one worker at a time, delay the items or rate limit the retries of failed items.
+package workqueue
+
+import (
+	"context"
+
+	"github.com/things-go/container"
+	"github.com/things-go/container/safe/fifo"
+)
+
+// RateLimitingQueue is a Queue
+var _ fifo.Queue[int] = (*RateLimitingQueue[int])(nil)
+
+// RateLimitingQueue is a DelayingQueue which requeues the failed items after
+// the delay decided by a RateLimiter, instead of putting them straight back.
+//
+// A process function passed to Pop may return fifo.ErrRequeue, in this case
+// the item is added back with Requeue once Pop returns. Any other result
+// forgets the item, so its next failure starts a new backoff.
+// fifo.Run does the same with Requeue and Forget.
+type RateLimitingQueue[T any] struct {
+	*DelayingQueue[T]
+
+	rateLimiter RateLimiter
+	// retries counts the items added with AddRateLimited or Requeue, nil if no MetricsProvider is set.
+	retries fifo.CounterMetric
+}
+
+// NewRateLimitingQueue returns a queue which rate limits the requeued items with rateLimiter.
+// keyFunc is used to make the key used for queued item insertion and retrieval, and should be deterministic.
+func NewRateLimitingQueue[T any](keyFunc container.KeyFunc[T], rateLimiter RateLimiter, opts ...Option) *RateLimitingQueue[T] {
+	o := newOptions(opts...)
+	q := &RateLimitingQueue[T]{
+		// the retries are counted by the queue, rather than by the FIFO.
+		DelayingQueue: newDelayingQueue(keyFunc, o, false),
+		rateLimiter:   rateLimiter,
+	}
+	if o.metricsProvider != nil {
+		q.retries = o.metricsProvider.NewRetriesMetric(o.metricsName)
+	}
+	return q
+}
+
+// AddRateLimited adds an item to the queue after the rate limiter says it's ok.
+// The item is added back with AddIfNotPresent, so it never overwrites a
+// newer version of the object which was added in the meantime.
+func (q *RateLimitingQueue[T]) AddRateLimited(obj T) error {
+	key, err := q.keyFunc(obj)
+	if err != nil {
+		return container.KeyError[T]{Obj: obj, Err: err}
+	}
+	if q.retries != nil {
+		q.retries.Inc()
+	}
+	return q.AddAfter(obj, q.rateLimiter.When(key))
+}
+
+// Requeue adds back an item which failed to be processed outside of Pop,
+// such as by fifo.Run, like AddRateLimited, so it is retried after the
+// backoff of the rate limiter. err is the error of the failed attempt.
+// While the queue is draining, the item is requeued at once.
+func (q *RateLimitingQueue[T]) Requeue(obj T, err error) error {
+	key, keyErr := q.keyFunc(obj)
+	if keyErr != nil {
+		return container.KeyError[T]{Obj: obj, Err: keyErr}
+	}
+	if q.retries != nil {
+		q.retries.Inc()
+	}
+	return q.requeueAfter(obj, q.rateLimiter.When(key), err)
+}
+
+// Forget indicates that an item is finished being retried. Doesn't matter whether it's for perm failing
+// or for success, we'll stop the rate limiter from tracking it.
+// An object whose key can not be made is ignored.
+func (q *RateLimitingQueue[T]) Forget(obj T) {
+	key, err := q.keyFunc(obj)
+	if err != nil {
+		return
+	}
+	q.rateLimiter.Forget(key)
+	q.FIFO.Forget(obj)
+}
+
+// NumRequeues returns back how many times the item was requeued.
+// An object whose key can not be made returns 0.
+func (q *RateLimitingQueue[T]) NumRequeues(obj T) int {
+	key, err := q.keyFunc(obj)
+	if err != nil {
+		return 0
+	}
+	return q.rateLimiter.NumRequeues(key)
+}
+
+// Pop waits until an item is ready and processes it, see fifo.FIFO.Pop.
+// If process returns fifo.ErrRequeue, the item is added back with Requeue
+// after the lock of the queue is released, otherwise the item is forgotten.
+func (q *RateLimitingQueue[T]) Pop(process fifo.PopProcessFunc[T]) (T, error) {
+	return q.pop(func(process fifo.PopProcessFunc[T]) (T, error) {
+		return q.FIFO.Pop(process)
+	}, process)
+}
+
+// PopContext is the same as Pop, but it also returns with ctx.Err() once ctx
+// is done while it is blocking.
+func (q *RateLimitingQueue[T]) PopContext(ctx context.Context, process fifo.PopProcessFunc[T]) (T, error) {
+	return q.pop(func(process fifo.PopProcessFunc[T]) (T, error) {
+		return q.FIFO.PopContext(ctx, process)
+	}, process)
+}
+
+// TryPop is the same as Pop, but it never blocks.
+func (q *RateLimitingQueue[T]) TryPop(process fifo.PopProcessFunc[T]) (T, error) {
+	return q.pop(q.FIFO.TryPop, process)
+}
+
+// pop pops an item with popFunc, and rate limits it if process requeues it.
+func (q *RateLimitingQueue[T]) pop(popFunc func(fifo.PopProcessFunc[T]) (T, error), process fifo.PopProcessFunc[T]) (T, error) {
+	popped := false
+	var requeue *fifo.ErrRequeue
+	obj, err := popFunc(func(obj T) error {
+		popped = true
+		if process == nil {
+			return nil
+		}
+		err := process(obj)
+		if e, ok := err.(fifo.ErrRequeue); ok {
+			requeue = &e
+			return e.Err
+		}
+		return err
+	})
+	if !popped {
+		return obj, err
+	}
+	if requeue != nil {
+		q.Requeue(obj, requeue.Err) // nolint: errcheck
+	} else {
+		q.Forget(obj)
+	}
+	return obj, err
+}
@@ -0,0 +1,293 @@
+package workqueue
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/things-go/container/clock"
+	"github.com/things-go/container/safe/fifo"
+)
+
+type testObject struct {
+	name string
+	val  int
+}
+
+func testObjectKeyFunc(obj testObject) (string, error) {
+	return obj.name, nil
+}
+
+func Test_RateLimitingQueue(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	limiter := NewItemExponentialFailureRateLimiter(1*time.Millisecond, 1*time.Second)
+	q := NewRateLimitingQueue(testObjectKeyFunc, limiter, WithClock(fakeClock))
+	defer q.Close()
+
+	require.NoError(t, q.AddRateLimited(testObject{"one", 1}))
+	require.Equal(t, 0, len(q.ListKeys()))
+	require.Equal(t, 1, q.NumRequeues(testObject{name: "one"}))
+
+	require.NoError(t, q.AddRateLimited(testObject{"one", 1}))
+	require.Equal(t, 2, q.NumRequeues(testObject{name: "one"}))
+
+	require.NoError(t, q.AddRateLimited(testObject{"two", 2}))
+	require.Equal(t, 1, q.NumRequeues(testObject{name: "two"}))
+
+	fakeClock.Step(1 * time.Millisecond)
+	require.Eventually(t, func() bool { return len(q.ListKeys()) == 2 }, time.Second, time.Millisecond)
+
+	q.Forget(testObject{name: "one"})
+	require.Equal(t, 0, q.NumRequeues(testObject{name: "one"}))
+
+	// the second one of "one" is merged into the first one.
+	q.mu.Lock()
+	require.Equal(t, 0, q.waitingForQueue.Len())
+	q.mu.Unlock()
+}
+
+func Test_RateLimitingQueue_requeueOnPop(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	limiter := NewItemExponentialFailureRateLimiter(10*time.Millisecond, 1*time.Second)
+	q := NewRateLimitingQueue(testObjectKeyFunc, limiter, WithClock(fakeClock))
+	defer q.Close()
+
+	require.NoError(t, q.Add(testObject{"foo", 1}))
+
+	_, err := q.Pop(func(testObject) error {
+		return fifo.ErrRequeue{Err: errors.New("test error")}
+	})
+	require.EqualError(t, err, "test error")
+	require.Equal(t, 1, q.NumRequeues(testObject{name: "foo"}))
+	// not requeued until the rate limiter says it's ok.
+	_, exists, _ := q.GetByKey("foo")
+	require.False(t, exists)
+
+	fakeClock.Step(9 * time.Millisecond)
+	_, exists, _ = q.GetByKey("foo")
+	require.False(t, exists)
+
+	fakeClock.Step(1 * time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, exists, _ := q.GetByKey("foo")
+		return exists
+	}, time.Second, time.Millisecond)
+
+	// succeed processing forgets the item.
+	obj, err := q.Pop(func(testObject) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, testObject{"foo", 1}, obj)
+	require.Equal(t, 0, q.NumRequeues(testObject{name: "foo"}))
+}
+
+func Test_RateLimitingQueue_requeueDoesNotOverwriteNewer(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	limiter := NewItemExponentialFailureRateLimiter(10*time.Millisecond, 1*time.Second)
+	q := NewRateLimitingQueue(testObjectKeyFunc, limiter, WithClock(fakeClock))
+	defer q.Close()
+
+	require.NoError(t, q.AddRateLimited(testObject{"foo", 1}))
+	require.NoError(t, q.Add(testObject{"foo", 2}))
+
+	fakeClock.Step(10 * time.Millisecond)
+	require.Eventually(t, func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.waitingForQueue.Len() == 0
+	}, time.Second, time.Millisecond)
+
+	obj, _, _ := q.GetByKey("foo")
+	require.Equal(t, 2, obj.val)
+}
+
+func Test_RateLimitingQueue_Close(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	q := NewRateLimitingQueue(testObjectKeyFunc, DefaultControllerRateLimiter(), WithClock(fakeClock))
+
+	require.NoError(t, q.AddRateLimited(testObject{"foo", 1}))
+	require.Eventually(t, fakeClock.HasWaiters, time.Second, time.Millisecond)
+
+	q.Close()
+	require.False(t, fakeClock.HasWaiters())
+	require.True(t, q.IsClosed())
+	require.ErrorIs(t, q.AddRateLimited(testObject{"foo", 1}), fifo.ErrFIFOClosed)
+
+	_, err := q.Pop(nil)
+	require.ErrorIs(t, err, fifo.ErrFIFOClosed)
+}
+
+func Test_RateLimitingQueue_PopContext(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	limiter := NewItemExponentialFailureRateLimiter(10*time.Millisecond, 1*time.Second)
+	q := NewRateLimitingQueue(testObjectKeyFunc, limiter, WithClock(fakeClock))
+	defer q.Close()
+
+	require.NoError(t, q.Add(testObject{"foo", 1}))
+	_, err := q.PopContext(context.Background(), func(testObject) error {
+		return fifo.ErrRequeue{}
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, q.NumRequeues(testObject{name: "foo"}))
+
+	_, err = q.TryPop(nil)
+	require.ErrorIs(t, err, fifo.ErrFIFOEmpty)
+
+	fakeClock.Step(10 * time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, exists, _ := q.GetByKey("foo")
+		return exists
+	}, time.Second, time.Millisecond)
+
+	obj, err := q.TryPop(func(testObject) error { return nil })
+	require.NoError(t, err)
+	require.Equal(t, testObject{"foo", 1}, obj)
+	require.Equal(t, 0, q.NumRequeues(testObject{name: "foo"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = q.PopContext(ctx, nil)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func Test_RateLimitingQueue_Run(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	limiter := NewItemExponentialFailureRateLimiter(10*time.Millisecond, 1*time.Second)
+	q := NewRateLimitingQueue(testObjectKeyFunc, limiter, WithClock(fakeClock))
+
+	var attempts atomic.Int64
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- fifo.Run(ctx, fifo.Queue[testObject](q), 1, func(context.Context, testObject) error {
+			attempts.Add(1)
+			return fifo.ErrRequeue{Err: errors.New("test error")}
+		})
+	}()
+
+	require.NoError(t, q.Add(testObject{"foo", 1}))
+	require.Eventually(t, func() bool { return q.NumRequeues(testObject{name: "foo"}) == 1 }, time.Second, time.Millisecond)
+	// not retried until the rate limiter says it's ok.
+	require.Never(t, func() bool { return attempts.Load() > 1 }, 50*time.Millisecond, time.Millisecond)
+
+	fakeClock.Step(10 * time.Millisecond)
+	require.Eventually(t, func() bool { return q.NumRequeues(testObject{name: "foo"}) == 2 }, time.Second, time.Millisecond)
+	require.EqualValues(t, 2, attempts.Load())
+
+	// the backoff doubles.
+	fakeClock.Step(10 * time.Millisecond)
+	require.Never(t, func() bool { return attempts.Load() > 2 }, 50*time.Millisecond, time.Millisecond)
+	fakeClock.Step(10 * time.Millisecond)
+	require.Eventually(t, func() bool { return attempts.Load() == 3 }, time.Second, time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func Test_RateLimitingQueue_RunDrain(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	limiter := NewItemExponentialFailureRateLimiter(10*time.Millisecond, 1*time.Second)
+	q := NewRateLimitingQueue(testObjectKeyFunc, limiter, WithClock(fakeClock))
+
+	var attempts atomic.Int64
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- fifo.Run(ctx, fifo.Queue[testObject](q), 1, func(context.Context, testObject) error {
+			if attempts.Add(1) == 1 {
+				return fifo.ErrRequeue{Err: errors.New("test error")}
+			}
+			return nil
+		}, fifo.WithDrain[testObject](time.Second))
+	}()
+
+	require.NoError(t, q.Add(testObject{"foo", 1}))
+	require.Eventually(t, func() bool { return q.NumRequeues(testObject{name: "foo"}) == 1 }, time.Second, time.Millisecond)
+
+	// the pending retry is drained once it is due.
+	cancel()
+	require.Never(t, func() bool { return len(done) > 0 }, 20*time.Millisecond, time.Millisecond)
+	fakeClock.Step(10 * time.Millisecond)
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the queue is drained")
+	}
+	require.EqualValues(t, 2, attempts.Load())
+	require.False(t, fakeClock.HasWaiters())
+}
+
+type testCounter struct{ n atomic.Int64 }
+
+func (c *testCounter) Inc() { c.n.Add(1) }
+
+type testGauge struct{ v atomic.Int64 }
+
+func (g *testGauge) Set(f float64) { g.v.Store(int64(f)) }
+
+type testHistogram struct{ n atomic.Int64 }
+
+func (h *testHistogram) Observe(float64) { h.n.Add(1) }
+
+type testMetricsProvider struct {
+	depth        testGauge
+	adds         testCounter
+	latency      testHistogram
+	workDuration testHistogram
+	unfinished   testGauge
+	retries      testCounter
+}
+
+func (m *testMetricsProvider) NewDepthMetric(string) fifo.GaugeMetric       { return &m.depth }
+func (m *testMetricsProvider) NewAddsMetric(string) fifo.CounterMetric      { return &m.adds }
+func (m *testMetricsProvider) NewLatencyMetric(string) fifo.HistogramMetric { return &m.latency }
+func (m *testMetricsProvider) NewWorkDurationMetric(string) fifo.HistogramMetric {
+	return &m.workDuration
+}
+func (m *testMetricsProvider) NewUnfinishedWorkSecondsMetric(string) fifo.GaugeMetric {
+	return &m.unfinished
+}
+func (m *testMetricsProvider) NewLongestRunningProcessorSecondsMetric(string) fifo.GaugeMetric {
+	return &testGauge{}
+}
+func (m *testMetricsProvider) NewRetriesMetric(string) fifo.CounterMetric { return &m.retries }
+
+func Test_RateLimitingQueue_metrics(t *testing.T) {
+	fakeClock := clock.NewFakeClock(time.Now())
+	mp := &testMetricsProvider{}
+	limiter := NewItemExponentialFailureRateLimiter(10*time.Millisecond, 1*time.Second)
+	q := NewRateLimitingQueue(testObjectKeyFunc, limiter, WithClock(fakeClock), WithMetrics("test", mp))
+	defer q.Close()
+
+	require.NoError(t, q.Add(testObject{"foo", 1}))
+	require.EqualValues(t, 1, mp.adds.n.Load())
+	require.EqualValues(t, 1, mp.depth.v.Load())
+
+	_, err := q.Pop(func(testObject) error { return fifo.ErrRequeue{} })
+	require.NoError(t, err)
+	require.EqualValues(t, 1, mp.retries.n.Load())
+	require.EqualValues(t, 0, mp.depth.v.Load())
+
+	fakeClock.Step(10 * time.Millisecond)
+	require.Eventually(t, func() bool { return mp.depth.v.Load() == 1 }, time.Second, time.Millisecond)
+	require.EqualValues(t, 2, mp.adds.n.Load())
+}
+
+func Test_RateLimitingQueue_metricsRetriesCountedOnce(t *testing.T) {
+	mp := &testMetricsProvider{}
+	// no delay, the item is requeued into the FIFO at once.
+	limiter := NewItemExponentialFailureRateLimiter(0, 0)
+	q := NewRateLimitingQueue(testObjectKeyFunc, limiter, WithMetrics("test", mp))
+	defer q.Close()
+
+	require.NoError(t, q.Add(testObject{"foo", 1}))
+	_, err := q.Pop(func(testObject) error { return fifo.ErrRequeue{} })
+	require.NoError(t, err)
+	_, exists, _ := q.GetByKey("foo")
+	require.True(t, exists)
+	require.EqualValues(t, 1, mp.retries.n.Load())
+}
@@ -15,7 +15,7 @@ import (
 // the last given object, or empty after Delete, and thus the Store's
 // behavior is simple storage.
 //
-// Reflector knows how to watch a server and update a Store.  This
+// cache.Reflector knows how to watch a server and update a Store.  This
 // package provides a variety of implementations of Store.
 type Store[T any] interface {
 